@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"time"
+)
+
+// Errors returned when an authorization code cannot be exchanged, all of
+// which are the invalid_grant error of RFC 6749 section 5.2.
+var (
+	ErrInvalidAuthorizationCode = fmt.Errorf("invalid authorization code")
+	ErrRedirectURIMismatch      = fmt.Errorf("redirect_uri does not match the authorization request")
+	ErrInvalidCodeVerifier      = fmt.Errorf("code_verifier does not match the code challenge")
+)
+
+type AuthorizationCodeController struct {
+	AuthorizationCodeRepository repositories.IAuthorizationCodeRepository
+}
+
+// IssueAuthorizationCode stores the authorization the user gave the client,
+// returning the code the client exchanges for it, which is only stored
+// hashed.
+func (ac AuthorizationCodeController) IssueAuthorizationCode(authorizationCode models.AuthorizationCode) (string, error) {
+	code, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > authorization_code.go > IssueAuthorizationCode > failed to generate authorization code")
+		return "", err
+	}
+
+	authorizationCode.CodeHash = utils.HashToken(code)
+	authorizationCode.ExpiresAt = time.Now().Add(models.AuthorizationCodeLifetime)
+	if err := ac.AuthorizationCodeRepository.AddAuthorizationCode(authorizationCode); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// RedeemAuthorizationCode exchanges a code for the authorization it was
+// issued for. Each code can only be redeemed once, by the client it was
+// issued to, with the redirect URI of the authorization request, including
+// when it was omitted there, and with the PKCE code verifier.
+func (ac AuthorizationCodeController) RedeemAuthorizationCode(client models.Client, code string, redirectURI string, codeVerifier string) (models.AuthorizationCode, error) {
+	authorizationCode, err := ac.AuthorizationCodeRepository.ConsumeAuthorizationCode(utils.HashToken(code))
+	if err == repositories.ErrAuthorizationCodeNotFound {
+		return models.AuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	if err != nil {
+		return models.AuthorizationCode{}, err
+	}
+
+	if authorizationCode.ClientID != client.ID || time.Now().After(authorizationCode.ExpiresAt) {
+		return models.AuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	if redirectURI != authorizationCode.RedirectURI {
+		return models.AuthorizationCode{}, ErrRedirectURIMismatch
+	}
+	if !authorizationCode.VerifyCodeVerifier(codeVerifier) {
+		return models.AuthorizationCode{}, ErrInvalidCodeVerifier
+	}
+
+	return authorizationCode, nil
+}
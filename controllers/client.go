@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidClientCredentials    = fmt.Errorf("invalid client credentials")
+	ErrClientCredentialsNotAllowed = fmt.Errorf("the client_credentials grant requires a confidential client")
+	ErrClientScopeNotAllowed       = fmt.Errorf("the client is not allowed to request this scope")
+)
+
+type ClientController struct {
+	ClientRepository repositories.IClientRepository
+}
+
+func (cc ClientController) GetClientByID(id string) (models.Client, error) {
+	return cc.ClientRepository.GetClientByID(id)
+}
+
+func (cc ClientController) GetClients() ([]models.Client, error) {
+	return cc.ClientRepository.GetClients()
+}
+
+// AddClient registers a new client under a generated client ID. Confidential
+// clients are also given a secret, which is returned in plain text this once
+// and only stored hashed.
+func (cc ClientController) AddClient(client models.Client, confidential bool) (models.Client, string, models.ErrorResponse) {
+	if errors := validateClient(client, confidential); errors != nil {
+		return client, "", models.ErrorResponse{ErrorMessage: "validation errors occurred", Errors: errors}
+	}
+
+	clientID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		log.Printf("controllers > client.go > AddClient > failed to generate client ID")
+		return client, "", models.ErrorResponse{ErrorMessage: "failed to generate client ID"}
+	}
+	client.ID = clientID
+	client.SecretHash = ""
+	if client.SubjectType == "" {
+		client.SubjectType = models.SubjectTypePublic
+	}
+	client.CreatedAt = time.Now()
+
+	var clientSecret string
+	if confidential {
+		clientSecret, client.SecretHash, err = newClientSecret()
+		if err != nil {
+			return client, "", models.ErrorResponse{ErrorMessage: "failed to generate client secret"}
+		}
+	}
+
+	addedClient, err := cc.ClientRepository.AddClient(client)
+	if err != nil {
+		return addedClient, "", models.ErrorResponse{ErrorMessage: err.Error()}
+	}
+
+	return addedClient, clientSecret, models.ErrorResponse{}
+}
+
+// RegisterClient adds a client that registered itself through dynamic client
+// registration (RFC 7591). Besides the client secret for confidential
+// clients, it returns the registration access token the client uses to
+// manage its registration, which is only stored hashed too.
+func (cc ClientController) RegisterClient(client models.Client, confidential bool) (models.Client, string, string, models.ErrorResponse) {
+	registrationToken, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > client.go > RegisterClient > failed to generate registration access token")
+		return client, "", "", models.ErrorResponse{ErrorMessage: "failed to generate registration access token"}
+	}
+	client.RegistrationTokenHash = utils.HashToken(registrationToken)
+
+	addedClient, clientSecret, errResp := cc.AddClient(client, confidential)
+	if errResp.ErrorMessage != "" {
+		return addedClient, "", "", errResp
+	}
+
+	return addedClient, clientSecret, registrationToken, models.ErrorResponse{}
+}
+
+// AuthenticateRegistration returns the client whose registration the
+// registration access token lets the caller manage (RFC 7592). Clients
+// added by an admin have no registration access token.
+func (cc ClientController) AuthenticateRegistration(clientID string, registrationToken string) (models.Client, error) {
+	client, err := cc.ClientRepository.GetClientByID(clientID)
+	if err != nil || client.RegistrationTokenHash == "" {
+		return models.Client{}, fmt.Errorf("invalid registration access token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.RegistrationTokenHash), []byte(utils.HashToken(registrationToken))) != 1 {
+		return models.Client{}, fmt.Errorf("invalid registration access token")
+	}
+
+	return client, nil
+}
+
+// UpdateClient replaces the metadata of an existing client, keeping its
+// secret, registration access token and creation time.
+func (cc ClientController) UpdateClient(client models.Client) (models.Client, models.ErrorResponse) {
+	existingClient, err := cc.ClientRepository.GetClientByID(client.ID)
+	if err != nil {
+		return client, models.ErrorResponse{ErrorMessage: err.Error()}
+	}
+	client.RegistrationTokenHash = existingClient.RegistrationTokenHash
+	if errors := validateClient(client, !existingClient.IsPublic()); errors != nil {
+		return client, models.ErrorResponse{ErrorMessage: "validation errors occurred", Errors: errors}
+	}
+
+	if client.SubjectType == "" {
+		client.SubjectType = models.SubjectTypePublic
+	}
+	client.SecretHash = existingClient.SecretHash
+	client.CreatedAt = existingClient.CreatedAt
+
+	if err := cc.ClientRepository.UpdateClient(client); err != nil {
+		return client, models.ErrorResponse{ErrorMessage: err.Error()}
+	}
+
+	return client, models.ErrorResponse{}
+}
+
+// RotateClientSecret replaces the secret of a confidential client, returning
+// the new secret in plain text. The previous secret stops working at once.
+func (cc ClientController) RotateClientSecret(id string) (string, error) {
+	client, err := cc.ClientRepository.GetClientByID(id)
+	if err != nil {
+		return "", err
+	}
+	if client.IsPublic() {
+		return "", fmt.Errorf("public clients do not have a secret")
+	}
+
+	clientSecret, secretHash, err := newClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := cc.ClientRepository.UpdateClientSecret(id, secretHash); err != nil {
+		return "", err
+	}
+
+	return clientSecret, nil
+}
+
+func (cc ClientController) DeleteClient(id string) error {
+	return cc.ClientRepository.DeleteClient(id)
+}
+
+// AuthenticateClient checks the credentials of a confidential client. Errors
+// other than ErrInvalidClientCredentials mean the client could not be looked
+// up.
+func (cc ClientController) AuthenticateClient(clientID string, clientSecret string) (models.Client, error) {
+	client, err := cc.ClientRepository.GetClientByID(clientID)
+	if err == repositories.ErrClientNotFound || (err == nil && client.SecretHash == "") {
+		return models.Client{}, ErrInvalidClientCredentials
+	}
+	if err != nil {
+		return models.Client{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(clientSecret)); err != nil {
+		return models.Client{}, ErrInvalidClientCredentials
+	}
+
+	return client, nil
+}
+
+// IdentifyClient checks the credentials of a confidential client, or accepts
+// the client ID alone for public clients that have no secret to present.
+func (cc ClientController) IdentifyClient(clientID string, clientSecret string) (models.Client, error) {
+	client, err := cc.ClientRepository.GetClientByID(clientID)
+	if err == repositories.ErrClientNotFound {
+		return models.Client{}, ErrInvalidClientCredentials
+	}
+	if err != nil {
+		return models.Client{}, err
+	}
+
+	if client.IsPublic() {
+		if clientSecret != "" {
+			return models.Client{}, ErrInvalidClientCredentials
+		}
+		return client, nil
+	}
+
+	return cc.AuthenticateClient(clientID, clientSecret)
+}
+
+// IssueClientCredentialsToken issues an access token to the client itself,
+// for services acting on their own behalf (RFC 6749 section 4.4). Without a
+// requested scope the client gets all of its allowed scopes. It returns the
+// token along with the scope it was issued with.
+func (cc ClientController) IssueClientCredentialsToken(client models.Client, scope string) (models.TokenPair, string, error) {
+	if client.IsPublic() {
+		return models.TokenPair{}, "", ErrClientCredentialsNotAllowed
+	}
+	if !client.AllowsScope(scope) {
+		return models.TokenPair{}, "", ErrClientScopeNotAllowed
+	}
+	if scope == "" {
+		scope = strings.Join(client.Scopes, " ")
+	}
+
+	expiresAt := time.Now().Add(client.AccessTokenTTL())
+	accessToken, err := models.MintToken(models.NewClientAccessTokenClaims(client, scope, expiresAt))
+	if err != nil {
+		log.Printf("controllers > client.go > IssueClientCredentialsToken > failed to mint token for client %s", client.ID)
+		return models.TokenPair{}, "", err
+	}
+
+	return models.TokenPair{AccessToken: accessToken, AccessTokenExpiresAt: expiresAt}, scope, nil
+}
+
+// validateClient validates the client's metadata, also checking that only
+// confidential clients are allowed grants that authenticate the client alone.
+func validateClient(client models.Client, confidential bool) []string {
+	validationErrors := client.Validate()
+	if !confidential && client.AllowsGrantType(models.GrantTypeClientCredentials) {
+		validationErrors = append(validationErrors, "the client_credentials grant requires a confidential client")
+	}
+
+	return validationErrors
+}
+
+// newClientSecret returns a random client secret along with its bcrypt hash.
+func newClientSecret() (string, string, error) {
+	clientSecret, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > client.go > newClientSecret > failed to generate client secret")
+		return "", "", err
+	}
+
+	secretHash, err := bcrypt.GenerateFromPassword([]byte(clientSecret), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("controllers > client.go > newClientSecret > failed to hash client secret")
+		return "", "", err
+	}
+
+	return clientSecret, string(secretHash), nil
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"time"
+)
+
+// ErrConsentNotFound is returned when revoking consent the user never gave
+// the client.
+var ErrConsentNotFound = fmt.Errorf("consent not found")
+
+type ConsentController struct {
+	ConsentRepository repositories.IConsentRepository
+	SessionRepository repositories.ISessionRepository
+	LogoutNotifier    LogoutNotifier
+}
+
+// HasConsent reports whether the user has allowed the client every scope it
+// asks for. First party clients do not need consent.
+func (cc ConsentController) HasConsent(userID int, client models.Client, scope string) bool {
+	if !client.RequiresConsent() {
+		return true
+	}
+
+	consent, err := cc.ConsentRepository.GetConsent(userID, client.ID)
+	if err != nil {
+		return false
+	}
+
+	return consent.Covers(scope)
+}
+
+func (cc ConsentController) GetConsentsForUser(userID int) ([]models.Consent, error) {
+	return cc.ConsentRepository.GetConsentsForUser(userID)
+}
+
+// GrantConsent records that the user allowed the client the scopes, in
+// addition to any scopes they allowed it before.
+func (cc ConsentController) GrantConsent(userID int, clientID string, scope string) error {
+	now := time.Now()
+	consent := models.Consent{UserID: userID, ClientID: clientID, CreatedAt: now}
+
+	if existing, err := cc.ConsentRepository.GetConsent(userID, clientID); err == nil {
+		consent = existing
+	}
+
+	consent.Scope = models.MergeScopes(consent.Scope, scope)
+	consent.UpdatedAt = now
+
+	return cc.ConsentRepository.SaveConsent(consent)
+}
+
+// RevokeConsent withdraws the user's consent for the client and ends the
+// client's sessions for the user, so its refresh and access tokens stop
+// working and the client is told about the logout.
+func (cc ConsentController) RevokeConsent(userID int, clientID string) error {
+	err := cc.ConsentRepository.DeleteConsent(userID, clientID)
+	if err == repositories.ErrConsentNotFound {
+		return ErrConsentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	sessions, err := cc.SessionRepository.GetSessionsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := cc.SessionRepository.DeleteClientSessionsForUser(userID, clientID); err != nil {
+		log.Printf("controllers > consent.go > RevokeConsent > failed to end sessions of client %s for user ID %d", clientID, userID)
+		return err
+	}
+
+	if cc.LogoutNotifier != nil {
+		var clientSessions []models.Session
+		for _, session := range sessions {
+			if session.ClientID == clientID {
+				clientSessions = append(clientSessions, session)
+			}
+		}
+		cc.LogoutNotifier.NotifyLogout(clientSessions)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"time"
+)
+
+// Errors returned while a device polls for its tokens, matching the error
+// codes of RFC 8628 section 3.5.
+var (
+	ErrAuthorizationPending = fmt.Errorf("authorization pending")
+	ErrSlowDown             = fmt.Errorf("polling too fast")
+	ErrAccessDenied         = fmt.Errorf("authorization denied")
+	ErrExpiredToken         = fmt.Errorf("device code expired")
+	ErrInvalidDeviceCode    = fmt.Errorf("invalid device code")
+)
+
+type DeviceAuthorizationController struct {
+	DeviceAuthorizationRepository repositories.IDeviceAuthorizationRepository
+}
+
+// StartDeviceAuthorization creates a device authorization for the client,
+// returning it with the device code, which is only stored hashed.
+func (dc DeviceAuthorizationController) StartDeviceAuthorization(client models.Client, scope string) (string, models.DeviceAuthorization, error) {
+	deviceCode, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > device_authorization.go > StartDeviceAuthorization > failed to generate device code")
+		return "", models.DeviceAuthorization{}, err
+	}
+
+	authorization := models.DeviceAuthorization{
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		ClientID:       client.ID,
+		Scope:          scope,
+		Status:         models.DeviceAuthorizationPending,
+		PollInterval:   models.DevicePollInterval,
+		ExpiresAt:      time.Now().Add(models.DeviceCodeLifetime),
+	}
+
+	// user codes are short enough to collide now and then, so retry with a new one
+	for attempt := 0; attempt < 3; attempt++ {
+		authorization.UserCode, err = utils.GenerateUserCode(8)
+		if err != nil {
+			log.Printf("controllers > device_authorization.go > StartDeviceAuthorization > failed to generate user code")
+			return "", authorization, err
+		}
+
+		err = dc.DeviceAuthorizationRepository.AddDeviceAuthorization(authorization)
+		if err != repositories.ErrUserCodeTaken {
+			break
+		}
+	}
+	if err != nil {
+		return "", authorization, err
+	}
+
+	return deviceCode, authorization, nil
+}
+
+// GetPendingDeviceAuthorization returns the device authorization a user
+// entered the user code of, as long as it is still waiting for a decision.
+func (dc DeviceAuthorizationController) GetPendingDeviceAuthorization(userCode string) (models.DeviceAuthorization, error) {
+	authorization, err := dc.DeviceAuthorizationRepository.GetDeviceAuthorizationByUserCode(models.NormalizeUserCode(userCode))
+	if err != nil {
+		return authorization, fmt.Errorf("invalid user code")
+	}
+	if authorization.Status != models.DeviceAuthorizationPending || time.Now().After(authorization.ExpiresAt) {
+		return authorization, fmt.Errorf("invalid user code")
+	}
+
+	return authorization, nil
+}
+
+// ResolveDeviceAuthorization records whether the user approved or denied the
+// device authorization with the user code.
+func (dc DeviceAuthorizationController) ResolveDeviceAuthorization(userCode string, userID int, approved bool) error {
+	authorization, err := dc.GetPendingDeviceAuthorization(userCode)
+	if err != nil {
+		return err
+	}
+
+	status := models.DeviceAuthorizationDenied
+	if approved {
+		status = models.DeviceAuthorizationApproved
+	}
+
+	return dc.DeviceAuthorizationRepository.ResolveDeviceAuthorization(authorization.UserCode, status, userID)
+}
+
+// PollDeviceAuthorization checks on the device authorization for a device
+// code presented by the client. Once approved it is returned and deleted, so
+// tokens are only issued for the first successful poll. A device polling more
+// often than its interval allows has the interval raised by 5 seconds.
+func (dc DeviceAuthorizationController) PollDeviceAuthorization(deviceCode string, clientID string) (models.DeviceAuthorization, error) {
+	deviceCodeHash := utils.HashToken(deviceCode)
+	now := time.Now()
+
+	authorization, err := dc.DeviceAuthorizationRepository.GetDeviceAuthorizationByDeviceCodeHash(deviceCodeHash)
+	if err != nil || authorization.ClientID != clientID {
+		return models.DeviceAuthorization{}, ErrInvalidDeviceCode
+	}
+
+	if now.After(authorization.ExpiresAt) {
+		_ = dc.DeviceAuthorizationRepository.DeleteDeviceAuthorization(deviceCodeHash)
+		return models.DeviceAuthorization{}, ErrExpiredToken
+	}
+
+	tooFast := !authorization.LastPolledAt.IsZero() &&
+		now.Sub(authorization.LastPolledAt) < time.Duration(authorization.PollInterval)*time.Second
+	if tooFast {
+		authorization.PollInterval += 5
+	}
+	if err := dc.DeviceAuthorizationRepository.UpdateDeviceAuthorizationPoll(deviceCodeHash, now, authorization.PollInterval); err != nil {
+		return models.DeviceAuthorization{}, err
+	}
+	if tooFast {
+		return models.DeviceAuthorization{}, ErrSlowDown
+	}
+
+	switch authorization.Status {
+	case models.DeviceAuthorizationApproved:
+		if err := dc.DeviceAuthorizationRepository.DeleteDeviceAuthorization(deviceCodeHash); err != nil {
+			// another poll has already exchanged the device code
+			return models.DeviceAuthorization{}, ErrInvalidDeviceCode
+		}
+		return authorization, nil
+	case models.DeviceAuthorizationDenied:
+		_ = dc.DeviceAuthorizationRepository.DeleteDeviceAuthorization(deviceCodeHash)
+		return models.DeviceAuthorization{}, ErrAccessDenied
+	default:
+		return models.DeviceAuthorization{}, ErrAuthorizationPending
+	}
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrInvalidVerificationToken   = fmt.Errorf("invalid or expired verification token")
+	ErrEmailAlreadyVerified       = fmt.Errorf("email address has already been verified")
+	ErrVerificationEmailThrottled = fmt.Errorf("a verification email was sent recently")
+)
+
+type EmailVerificationController struct {
+	UserRepository repositories.IUserRepository
+	Mailer         models.Mailer
+}
+
+// SendVerificationEmail emails the user a link to verifyURL that verifies
+// their address. Only one email is sent per EmailVerificationResendInterval,
+// so the endpoints sending them cannot be used to flood an inbox.
+func (vc EmailVerificationController) SendVerificationEmail(user models.User, verifyURL string) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	ok, err := vc.UserRepository.MarkVerificationEmailSent(user.ID, time.Now().Add(-models.EmailVerificationResendInterval))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerificationEmailThrottled
+	}
+
+	token, err := models.MintEmailVerificationToken(models.NewEmailVerificationClaims(user))
+	if err != nil {
+		log.Printf("controllers > email_verification.go > SendVerificationEmail > failed to mint verification token for user ID %d", user.ID)
+		return err
+	}
+
+	link := verifyURL + "?token=" + url.QueryEscape(token)
+	return vc.Mailer.SendMail(utils.Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open the link below to verify your email address. It expires in %d hours.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+			int(models.EmailVerificationTokenLifetime.Hours()), link),
+	})
+}
+
+// ResendVerificationEmail sends another verification email to the user with
+// the address.
+func (vc EmailVerificationController) ResendVerificationEmail(email string, verifyURL string) error {
+	user, err := vc.UserRepository.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	return vc.SendVerificationEmail(user, verifyURL)
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified. Each token can only be used once, as the address is verified
+// afterwards, and stops working if the user's address changes.
+func (vc EmailVerificationController) VerifyEmail(token string) (models.User, error) {
+	claims, err := models.ValidateEmailVerificationToken(token)
+	if err != nil {
+		return models.User{}, ErrInvalidVerificationToken
+	}
+
+	userID, err := vc.UserRepository.GetUserIDForSubject(claims.Subject)
+	if err != nil {
+		return models.User{}, ErrInvalidVerificationToken
+	}
+	user, err := vc.UserRepository.GetUserByID(userID)
+	if err != nil || user.Email != claims.Email {
+		return models.User{}, ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return user, ErrEmailAlreadyVerified
+	}
+
+	if err := vc.UserRepository.SetEmailVerified(user.ID); err != nil {
+		return user, err
+	}
+	user.EmailVerified = true
+
+	return user, nil
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// LogoutNotifier tells clients that sessions they were issued tokens for have
+// ended, so they can sign the user out too.
+type LogoutNotifier interface {
+	NotifyLogout([]models.Session)
+}
+
+// DefaultBackchannelRetryDelays are how long delivery of a logout token waits
+// before each retry.
+var DefaultBackchannelRetryDelays = []time.Duration{time.Second * 5, time.Second * 30, time.Minute * 5}
+
+// BackchannelLogout implements OpenID Connect Back-Channel Logout 1.0 by
+// POSTing a logout token to the backchannel logout URI of each client whose
+// session ended. Delivery happens in the background and is retried after
+// each of RetryDelays while the client cannot be reached, but retries do not
+// survive a restart of the service. Logout tokens of self registered clients
+// are sent with PublicHTTPClient, which should only reach public addresses,
+// since anyone may have registered their backchannel logout URI.
+type BackchannelLogout struct {
+	ClientRepository repositories.IClientRepository
+	UserRepository   repositories.IUserRepository
+	HTTPClient       *http.Client
+	PublicHTTPClient *http.Client
+	RetryDelays      []time.Duration
+}
+
+// NotifyLogout starts delivering logout tokens for the sessions. Sessions of
+// the same client under the same browser session get the same logout token,
+// so it is only sent once.
+func (bl BackchannelLogout) NotifyLogout(sessions []models.Session) {
+	notified := map[string]bool{}
+	for _, session := range sessions {
+		key := session.ClientID + " " + session.ParentSessionID
+		if session.ClientID == "" || notified[key] {
+			continue
+		}
+		notified[key] = true
+
+		client, err := bl.ClientRepository.GetClientByID(session.ClientID)
+		if err != nil || client.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		go func(client models.Client, session models.Session) {
+			if err := bl.DeliverLogoutToken(client, session); err != nil {
+				log.Printf("controllers > logout.go > NotifyLogout > could not deliver logout token for session %s to client %s: %s", session.ID, client.ID, err.Error())
+			}
+		}(client, session)
+	}
+}
+
+// DeliverLogoutToken POSTs a logout token for the session to the client's
+// backchannel logout URI, retrying while the request fails or the client
+// responds with a server error.
+func (bl BackchannelLogout) DeliverLogoutToken(client models.Client, session models.Session) error {
+	user, err := bl.UserRepository.GetUserByID(session.UserID)
+	if err != nil {
+		log.Printf("controllers > logout.go > DeliverLogoutToken > could not get user %d of session %s", session.UserID, session.ID)
+		return err
+	}
+	subject, err := UserController{UserRepository: bl.UserRepository}.GetSubjectForClient(user, client)
+	if err != nil {
+		log.Printf("controllers > logout.go > DeliverLogoutToken > failed to get subject of user %d for client %s", user.ID, client.ID)
+		return err
+	}
+
+	logoutToken, err := models.MintLogoutToken(models.NewLogoutTokenClaims(client.ID, subject, session))
+	if err != nil {
+		log.Printf("controllers > logout.go > DeliverLogoutToken > failed to mint logout token for client %s", client.ID)
+		return err
+	}
+
+	form := url.Values{"logout_token": {logoutToken}}
+	for attempt := 0; ; attempt++ {
+		retry, err := bl.postLogoutToken(bl.httpClientFor(client), client.BackchannelLogoutURI, form)
+		if err == nil || !retry || attempt == len(bl.RetryDelays) {
+			return err
+		}
+
+		time.Sleep(bl.RetryDelays[attempt])
+	}
+}
+
+// postLogoutToken makes one delivery attempt, reporting whether a failed
+// attempt is worth retrying. A 4xx response means the client rejected the
+// token, which sending it again will not change.
+func (bl BackchannelLogout) postLogoutToken(httpClient *http.Client, logoutURI string, form url.Values) (bool, error) {
+	resp, err := httpClient.PostForm(logoutURI, form)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	return resp.StatusCode >= 500, fmt.Errorf("backchannel logout URI responded with status %d", resp.StatusCode)
+}
+
+func (bl BackchannelLogout) httpClientFor(client models.Client) *http.Client {
+	if client.IsSelfRegistered() && bl.PublicHTTPClient != nil {
+		return bl.PublicHTTPClient
+	}
+	if bl.HTTPClient != nil {
+		return bl.HTTPClient
+	}
+
+	return http.DefaultClient
+}
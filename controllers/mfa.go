@@ -0,0 +1,382 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFAAlreadyEnabled    = fmt.Errorf("multi-factor authentication is already enabled")
+	ErrMFANotEnabled        = fmt.Errorf("multi-factor authentication is not enabled")
+	ErrMFARequiredForAdmins = fmt.Errorf("multi-factor authentication is required for admin accounts")
+	ErrInvalidMFACode       = fmt.Errorf("invalid authentication code")
+	ErrInvalidMFAChallenge  = fmt.Errorf("invalid or expired MFA challenge, sign in again")
+	ErrMFALocked            = fmt.Errorf("too many wrong authentication codes, try again later")
+
+	// ErrMFAReauthenticationRequired is returned when a user with MFA changes
+	// their second factors from a session not signed in with one.
+	ErrMFAReauthenticationRequired = fmt.Errorf("sign in with your second factor to change it")
+)
+
+type MFAController struct {
+	MFARepository  repositories.IMFARepository
+	UserRepository repositories.IUserRepository
+	Denylist       models.TokenDenylist
+	WebAuthn       WebAuthnController
+}
+
+// MFAEnabled reports whether the user has to confirm signing in with a
+// second factor, either a code from their authenticator or one of their
+// passkeys.
+func (mc MFAController) MFAEnabled(userID int) (bool, error) {
+	enabled, err := mc.totpEnabled(userID)
+	if err != nil || enabled {
+		return enabled, err
+	}
+	if mc.WebAuthn.WebAuthnRepository == nil {
+		return false, nil
+	}
+
+	credentials, err := mc.WebAuthn.GetCredentials(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(credentials) > 0, nil
+}
+
+// totpEnabled reports whether the user has confirmed an authenticator.
+func (mc MFAController) totpEnabled(userID int) (bool, error) {
+	enrollment, err := mc.MFARepository.GetTOTPEnrollment(userID)
+	if err == repositories.ErrTOTPNotEnrolled {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return enrollment.Confirmed, nil
+}
+
+// AuthorizeFactorChange checks the user may add or remove second factors
+// from their session. Once they have MFA, only sessions signed in with a
+// second factor may, so a stolen password is not enough to replace it.
+func (mc MFAController) AuthorizeFactorChange(userID int, usedMFA bool) error {
+	if usedMFA {
+		return nil
+	}
+
+	enabled, err := mc.MFAEnabled(userID)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return ErrMFAReauthenticationRequired
+	}
+
+	return nil
+}
+
+// BeginTOTPEnrollment generates a new TOTP secret for the user, returning it
+// encoded for typing into an authenticator app along with the otpauth:// URI
+// for scanning. It only takes effect once confirmed with
+// ConfirmTOTPEnrollment. usedMFA tells whether the user's session was signed
+// in with a second factor, see AuthorizeFactorChange.
+func (mc MFAController) BeginTOTPEnrollment(user models.User, usedMFA bool) (string, string, error) {
+	enabled, err := mc.totpEnabled(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	if err := mc.AuthorizeFactorChange(user.ID, usedMFA); err != nil {
+		return "", "", err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("controllers > mfa.go > BeginTOTPEnrollment > failed to generate TOTP secret for user ID %d", user.ID)
+		return "", "", err
+	}
+	encryptedSecret, err := utils.EncryptSecret(secret)
+	if err != nil {
+		log.Printf("controllers > mfa.go > BeginTOTPEnrollment > failed to encrypt TOTP secret for user ID %d", user.ID)
+		return "", "", err
+	}
+
+	err = mc.MFARepository.SetTOTPEnrollment(models.TOTPEnrollment{UserID: user.ID, Secret: encryptedSecret, CreatedAt: time.Now()})
+	if err != nil {
+		return "", "", err
+	}
+
+	encodedSecret := utils.EncodeTOTPSecret(secret)
+	return encodedSecret, models.TOTPKeyURI(user.Email, encodedSecret, utils.TOTPDigits, utils.TOTPPeriod), nil
+}
+
+// ConfirmTOTPEnrollment turns on MFA for the user once they enter a code
+// from the authenticator they set up, which shows it was set up correctly.
+// It returns the user's recovery codes, which are only stored hashed and
+// cannot be shown again.
+func (mc MFAController) ConfirmTOTPEnrollment(userID int, code string) ([]string, error) {
+	enrollment, err := mc.MFARepository.GetTOTPEnrollment(userID)
+	if err == repositories.ErrTOTPNotEnrolled {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.Confirmed {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if enrollment.IsLocked() {
+		return nil, ErrMFALocked
+	}
+
+	secret, err := utils.DecryptSecret(enrollment.Secret)
+	if err != nil {
+		log.Printf("controllers > mfa.go > ConfirmTOTPEnrollment > failed to decrypt TOTP secret of user ID %d", userID)
+		return nil, err
+	}
+	step, ok := utils.MatchTOTPCode(secret, code, time.Now())
+	if !ok {
+		return nil, mc.rejectCode(userID)
+	}
+
+	recoveryCodes, err := mc.replaceRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mc.MFARepository.ConfirmTOTPEnrollment(userID, step); err != nil {
+		return nil, err
+	}
+	if err := mc.MFARepository.ResetFailedAttempts(userID); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns off MFA for the user, who has to confirm it with a code.
+// Admins cannot turn it off.
+func (mc MFAController) DisableTOTP(user models.User, code string) error {
+	if user.HasRole(models.AdminRole) {
+		return ErrMFARequiredForAdmins
+	}
+	if _, err := mc.VerifyCode(user.ID, code); err != nil {
+		return err
+	}
+
+	return mc.MFARepository.DeleteTOTPEnrollment(user.ID)
+}
+
+// RegenerateRecoveryCodes gives the user new recovery codes, for when they
+// have used up or lost the ones they had. The old codes stop working.
+func (mc MFAController) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if _, err := mc.VerifyCode(userID, code); err != nil {
+		return nil, err
+	}
+
+	return mc.replaceRecoveryCodes(userID)
+}
+
+// VerifyCode checks a code the user entered, either from their authenticator
+// or one of their recovery codes, neither of which can be used again. It
+// returns the authentication methods the code counts as. Users who enter too
+// many wrong codes are locked out for a while.
+func (mc MFAController) VerifyCode(userID int, code string) ([]string, error) {
+	enrollment, err := mc.MFARepository.GetTOTPEnrollment(userID)
+	if err == repositories.ErrTOTPNotEnrolled || (err == nil && !enrollment.Confirmed) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.IsLocked() {
+		return nil, ErrMFALocked
+	}
+
+	methods, err := mc.matchCode(enrollment, code)
+	if err == ErrInvalidMFACode {
+		return nil, mc.rejectCode(userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.FailedAttempts > 0 {
+		if err := mc.MFARepository.ResetFailedAttempts(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return methods, nil
+}
+
+// matchCode uses up the code if it is the current one of the user's
+// authenticator or one of their recovery codes.
+func (mc MFAController) matchCode(enrollment models.TOTPEnrollment, code string) ([]string, error) {
+	secret, err := utils.DecryptSecret(enrollment.Secret)
+	if err != nil {
+		log.Printf("controllers > mfa.go > matchCode > failed to decrypt TOTP secret of user ID %d", enrollment.UserID)
+		return nil, err
+	}
+	if step, ok := utils.MatchTOTPCode(secret, code, time.Now()); ok {
+		ok, err := mc.MFARepository.UseTOTPStep(enrollment.UserID, step)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidMFACode
+		}
+
+		return []string{models.AuthMethodOTP, models.AuthMethodMFA}, nil
+	}
+
+	codeHash, err := hashRecoveryCode(code)
+	if err != nil {
+		log.Printf("controllers > mfa.go > matchCode > failed to hash recovery code of user ID %d", enrollment.UserID)
+		return nil, err
+	}
+	ok, err := mc.MFARepository.ConsumeRecoveryCode(enrollment.UserID, codeHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	log.Printf("controllers > mfa.go > matchCode > recovery code used by user ID %d", enrollment.UserID)
+
+	return []string{models.AuthMethodMFA}, nil
+}
+
+// rejectCode counts a wrong code the user entered, returning the error to
+// answer it with.
+func (mc MFAController) rejectCode(userID int) error {
+	if err := mc.MFARepository.RecordFailedAttempt(userID, models.MaxFailedMFAAttempts, time.Now().Add(models.MFALockoutDuration)); err != nil {
+		return err
+	}
+
+	return ErrInvalidMFACode
+}
+
+// StartChallenge returns the token a user with MFA is given after signing in
+// with their password, to exchange for tokens along with a code.
+func (mc MFAController) StartChallenge(user models.User, deviceLabel string) (string, time.Time, error) {
+	claims := models.NewMFAChallengeClaims(user, deviceLabel)
+	token, err := models.MintMFAChallengeToken(claims)
+	if err != nil {
+		log.Printf("controllers > mfa.go > StartChallenge > failed to mint MFA challenge token for user ID %d", user.ID)
+		return "", time.Time{}, err
+	}
+
+	return token, claims.ExpiresAt.Time, nil
+}
+
+// CompleteChallenge checks the code entered for an MFA challenge, returning
+// the user who signed in, the methods they signed in with and the device
+// label they signed in with. Each challenge allows a single attempt, so codes
+// cannot be guessed without knowing the password.
+func (mc MFAController) CompleteChallenge(challengeToken string, code string) (models.User, []string, string, error) {
+	user, claims, err := mc.consumeChallenge(challengeToken)
+	if err != nil {
+		return models.User{}, nil, "", err
+	}
+
+	methods, err := mc.VerifyCode(user.ID, code)
+	if err == ErrMFANotEnabled {
+		// users with only passkeys have no code to enter
+		return models.User{}, nil, "", ErrInvalidMFACode
+	}
+	if err != nil {
+		return models.User{}, nil, "", err
+	}
+
+	return user, append([]string{models.AuthMethodPassword}, methods...), claims.DeviceLabel, nil
+}
+
+// CompletePasskeyChallenge is CompleteChallenge for users who confirm their
+// sign in with one of their passkeys instead of a code.
+func (mc MFAController) CompletePasskeyChallenge(challengeToken string, response models.AssertionResponse) (models.User, []string, string, error) {
+	user, claims, err := mc.consumeChallenge(challengeToken)
+	if err != nil {
+		return models.User{}, nil, "", err
+	}
+
+	methods, err := mc.WebAuthn.FinishSecondFactor(user.ID, response)
+	if err != nil {
+		return models.User{}, nil, "", err
+	}
+
+	return user, append([]string{models.AuthMethodPassword}, methods...), claims.DeviceLabel, nil
+}
+
+// consumeChallenge validates an MFA challenge token and uses it up, returning
+// the user it was issued to.
+func (mc MFAController) consumeChallenge(challengeToken string) (models.User, models.MFAChallengeClaims, error) {
+	claims, err := models.ValidateMFAChallengeToken(challengeToken)
+	if err != nil {
+		return models.User{}, claims, ErrInvalidMFAChallenge
+	}
+
+	revoked, err := mc.Denylist.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return models.User{}, claims, err
+	}
+	if revoked {
+		return models.User{}, claims, ErrInvalidMFAChallenge
+	}
+	if err := mc.Denylist.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		return models.User{}, claims, err
+	}
+
+	userID, err := mc.UserRepository.GetUserIDForSubject(claims.Subject)
+	if err != nil {
+		return models.User{}, claims, ErrInvalidMFAChallenge
+	}
+	user, err := mc.UserRepository.GetUserByID(userID)
+	if err != nil {
+		return models.User{}, claims, ErrInvalidMFAChallenge
+	}
+
+	return user, claims, nil
+}
+
+func (mc MFAController) replaceRecoveryCodes(userID int) ([]string, error) {
+	recoveryCodes := make([]string, models.RecoveryCodeCount)
+	codeHashes := make([]string, models.RecoveryCodeCount)
+	for i := range recoveryCodes {
+		code, err := utils.GenerateUserCode(10)
+		if err != nil {
+			log.Printf("controllers > mfa.go > replaceRecoveryCodes > failed to generate recovery code for user ID %d", userID)
+			return nil, err
+		}
+
+		codeHash, err := hashRecoveryCode(code)
+		if err != nil {
+			log.Printf("controllers > mfa.go > replaceRecoveryCodes > failed to hash recovery code for user ID %d", userID)
+			return nil, err
+		}
+
+		recoveryCodes[i] = code[:5] + "-" + code[5:]
+		codeHashes[i] = codeHash
+	}
+
+	if err := mc.MFARepository.ReplaceRecoveryCodes(userID, codeHashes); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// hashRecoveryCode returns the hash a recovery code is stored as, ignoring
+// how the user formatted the code when typing it. Recovery codes are short
+// enough to be guessed from a plain hash, so the hash is keyed.
+func hashRecoveryCode(code string) (string, error) {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return utils.KeyedHash("recovery code", normalized)
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrInvalidPasswordResetToken = fmt.Errorf("invalid or expired password reset token")
+	ErrInvalidPassword           = fmt.Errorf("password does not meet the requirements")
+	ErrPasswordResetThrottled    = fmt.Errorf("a password reset email was sent recently")
+)
+
+type PasswordResetController struct {
+	UserRepository          repositories.IUserRepository
+	PasswordResetRepository repositories.IPasswordResetRepository
+	SessionController       SessionController
+	Mailer                  models.Mailer
+}
+
+// SendPasswordResetEmail emails the user with the address a link to resetURL
+// that lets them choose a new password. Links sent before stop working, so
+// only the latest email can be used. Only one email is sent per
+// PasswordResetResendInterval, so the endpoint cannot be used to flood an
+// inbox.
+func (prc PasswordResetController) SendPasswordResetEmail(email string, resetURL string) error {
+	user, err := prc.UserRepository.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	ok, err := prc.UserRepository.MarkPasswordResetEmailSent(user.ID, time.Now().Add(-models.PasswordResetResendInterval))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPasswordResetThrottled
+	}
+
+	token, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > password_reset.go > SendPasswordResetEmail > failed to generate password reset token")
+		return err
+	}
+
+	if err := prc.PasswordResetRepository.DeletePasswordResetTokensForUser(user.ID); err != nil {
+		return err
+	}
+	now := time.Now()
+	err = prc.PasswordResetRepository.AddPasswordResetToken(models.PasswordResetToken{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(models.PasswordResetTokenLifetime),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := resetURL + "?token=" + url.QueryEscape(token)
+	return prc.Mailer.SendMail(utils.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Open the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you did not ask to reset your password, you can ignore this email.\n",
+			int(models.PasswordResetTokenLifetime.Minutes()), link),
+	})
+}
+
+// ResetPassword sets a new password for the user a reset token was sent to.
+// The token is used up, and every session of the user is revoked, as whoever
+// knew the old password may be signed in.
+func (prc PasswordResetController) ResetPassword(token string, password string) error {
+	if errors := models.ValidatePassword(password); errors != nil {
+		return ErrInvalidPassword
+	}
+
+	resetToken, err := prc.PasswordResetRepository.ConsumePasswordResetToken(utils.HashToken(token))
+	if err != nil || time.Now().After(resetToken.ExpiresAt) {
+		return ErrInvalidPasswordResetToken
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		log.Printf("controllers > password_reset.go > ResetPassword > failed to hash password for user ID %d", resetToken.UserID)
+		return err
+	}
+	if err := prc.UserRepository.UpdatePassword(resetToken.UserID, passwordHash); err != nil {
+		return err
+	}
+
+	if err := prc.PasswordResetRepository.DeletePasswordResetTokensForUser(resetToken.UserID); err != nil {
+		log.Printf("controllers > password_reset.go > ResetPassword > could not delete other reset tokens for user ID %d", resetToken.UserID)
+	}
+	// receiving the link proves the user owns the address
+	if err := prc.UserRepository.SetEmailVerified(resetToken.UserID); err != nil {
+		log.Printf("controllers > password_reset.go > ResetPassword > could not mark email of user ID %d as verified", resetToken.UserID)
+	}
+
+	return prc.SessionController.RevokeAllSessions(resetToken.UserID)
+}
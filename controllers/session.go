@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"time"
+)
+
+var (
+	// ErrRefreshTokenReused is returned when a refresh token that has already
+	// been rotated is presented again. The token family has been revoked by then.
+	ErrRefreshTokenReused  = fmt.Errorf("refresh token reuse detected")
+	ErrInvalidRefreshToken = fmt.Errorf("invalid refresh token")
+	ErrSessionNotFound     = fmt.Errorf("session not found")
+)
+
+type SessionController struct {
+	SessionRepository repositories.ISessionRepository
+	UserRepository    repositories.IUserRepository
+	LogoutNotifier    LogoutNotifier
+}
+
+// GetSessionForRefreshToken returns the session a presented refresh token
+// belongs to. Each session is a token family: every refresh rotates its token,
+// and presenting a token the family has already rotated past revokes the whole
+// family, as recommended by the OAuth 2.0 Security BCP.
+func (sc SessionController) GetSessionForRefreshToken(refreshToken string) (models.Session, error) {
+	refreshTokenHash := utils.HashToken(refreshToken)
+
+	session, err := sc.SessionRepository.GetSessionByRefreshTokenHash(refreshTokenHash)
+	if err != nil {
+		rotatedSession, rotatedErr := sc.SessionRepository.GetSessionByRotatedRefreshTokenHash(refreshTokenHash)
+		if rotatedErr != nil {
+			return models.Session{}, fmt.Errorf("session not found")
+		}
+
+		sc.RevokeTokenFamily(rotatedSession)
+		return models.Session{}, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return models.Session{}, fmt.Errorf("session expired")
+	}
+
+	return session, nil
+}
+
+// RefreshSession exchanges a refresh token for a new token pair, returning
+// the user and session it was issued for. Sessions of an OAuth client can only
+// be refreshed by that client, and first party sessions only with an empty
+// client. A token rotated by a concurrent request counts as reuse.
+func (sc SessionController) RefreshSession(client models.Client, refreshToken string, userAgent string, ipAddress string) (models.User, models.Session, models.TokenPair, error) {
+	session, err := sc.GetSessionForRefreshToken(refreshToken)
+	if err == ErrRefreshTokenReused {
+		return models.User{}, models.Session{}, models.TokenPair{}, err
+	}
+	if err != nil || session.ClientID != client.ID {
+		return models.User{}, models.Session{}, models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := sc.UserRepository.GetUserByID(session.UserID)
+	if err != nil {
+		log.Printf("controllers > session.go > RefreshSession > could not get user with ID %d", session.UserID)
+		return models.User{}, models.Session{}, models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	session.UserAgent = userAgent
+	session.IPAddress = ipAddress
+
+	tokens, err := sc.IssueClientTokens(client, user, session)
+	if err == repositories.ErrRefreshTokenRotated {
+		// another request rotated the token first, so it has been presented twice
+		sc.RevokeTokenFamily(session)
+		return models.User{}, models.Session{}, models.TokenPair{}, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return models.User{}, models.Session{}, models.TokenPair{}, err
+	}
+
+	return user, session, tokens, nil
+}
+
+// IssueTokens mints a new access/refresh token pair for the session, storing
+// new sessions and rotating the refresh token of existing ones.
+func (sc SessionController) IssueTokens(user models.User, session models.Session) (models.TokenPair, error) {
+	return sc.IssueClientTokens(models.Client{}, user, session)
+}
+
+// IssueClientTokens works like IssueTokens for a session of an OAuth client,
+// using the token lifetimes configured for the client.
+func (sc SessionController) IssueClientTokens(client models.Client, user models.User, session models.Session) (models.TokenPair, error) {
+	now := time.Now()
+	isNewSession := session.ID == ""
+	if isNewSession {
+		sessionID, err := utils.GenerateRandomString(24)
+		if err != nil {
+			log.Printf("controllers > session.go > IssueClientTokens > failed to generate session ID")
+			return models.TokenPair{}, err
+		}
+		session.ID = sessionID
+		session.CreatedAt = now
+	}
+
+	accessTokenExpiration := now.Add(client.AccessTokenTTL())
+	claims := models.NewAccessTokenClaims(user, session, accessTokenExpiration)
+	if client.IsPairwise() {
+		subject, err := UserController{UserRepository: sc.UserRepository}.GetSubjectForClient(user, client)
+		if err != nil {
+			log.Printf("controllers > session.go > IssueClientTokens > failed to get pairwise subject for client %s", client.ID)
+			return models.TokenPair{}, err
+		}
+		claims.Subject = subject
+	}
+	if session.ClientID != "" && !client.FirstParty {
+		// third party clients act with the scopes the user consented to, not the user's roles
+		claims.UserRoles = nil
+	}
+
+	accessTokenString, err := models.MintToken(claims)
+	if err != nil {
+		log.Printf("controllers > session.go > IssueClientTokens > failed to mint auth token")
+		return models.TokenPair{}, err
+	}
+
+	refreshTokenExpiration := now.Add(client.RefreshTokenTTL())
+	refreshTokenString, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > session.go > IssueClientTokens > failed to generate refresh token")
+		return models.TokenPair{}, err
+	}
+
+	previousRefreshTokenHash := session.RefreshTokenHash
+	session.RefreshTokenHash = utils.HashToken(refreshTokenString)
+	session.LastUsedAt = now
+	session.ExpiresAt = refreshTokenExpiration
+
+	if isNewSession {
+		_, err = sc.SessionRepository.AddSession(session)
+	} else {
+		err = sc.SessionRepository.RotateSessionRefreshToken(session, previousRefreshTokenHash)
+	}
+	if err != nil {
+		log.Printf("controllers > session.go > IssueClientTokens > failed to store session %s", session.ID)
+		return models.TokenPair{}, err
+	}
+
+	return models.TokenPair{
+		SessionID:             session.ID,
+		AccessToken:           accessTokenString,
+		AccessTokenExpiresAt:  accessTokenExpiration,
+		RefreshToken:          refreshTokenString,
+		RefreshTokenExpiresAt: refreshTokenExpiration,
+	}, nil
+}
+
+func (sc SessionController) GetSessions(userID int) ([]models.Session, error) {
+	return sc.SessionRepository.GetSessionsForUser(userID)
+}
+
+// RevokeSession ends one of the user's sessions, as EndSession does. Sessions
+// of other users are reported as not found.
+func (sc SessionController) RevokeSession(userID int, sessionID string) error {
+	session, err := sc.SessionRepository.GetSessionByID(sessionID)
+	if err != nil || session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	_, err = sc.EndSession(session)
+	return err
+}
+
+// RevokeTokenFamily ends the session after refresh token reuse, invalidating
+// the current refresh token along with every token rotated before it.
+func (sc SessionController) RevokeTokenFamily(session models.Session) {
+	log.Printf("controllers > session.go > RevokeTokenFamily > SECURITY EVENT: refresh token reuse detected for session %s (user ID %d), revoking token family\n",
+		session.ID, session.UserID)
+
+	if err := sc.SessionRepository.DeleteSession(session.ID); err != nil {
+		log.Printf("controllers > session.go > RevokeTokenFamily > failed to revoke session %s: %s\n", session.ID, err.Error())
+		return
+	}
+
+	sc.notifyLogout([]models.Session{session})
+}
+
+// EndSession ends the session along with the client sessions that were
+// authorized from it, telling those clients about the logout. It returns
+// every session that was ended.
+func (sc SessionController) EndSession(session models.Session) ([]models.Session, error) {
+	childSessions, err := sc.SessionRepository.GetChildSessions(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	endedSessions := append([]models.Session{session}, childSessions...)
+	for _, endedSession := range endedSessions {
+		if err := sc.SessionRepository.DeleteSession(endedSession.ID); err != nil {
+			log.Printf("controllers > session.go > EndSession > failed to delete session %s", endedSession.ID)
+			return nil, err
+		}
+	}
+
+	sc.notifyLogout(endedSessions)
+
+	return endedSessions, nil
+}
+
+// RevokeAllSessions ends every session of the user and bumps their token
+// version so access tokens that were already issued stop being accepted.
+func (sc SessionController) RevokeAllSessions(userID int) error {
+	sessions, err := sc.SessionRepository.GetSessionsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.UserRepository.IncrementTokenVersion(userID); err != nil {
+		return err
+	}
+
+	if err := sc.SessionRepository.DeleteSessionsForUser(userID); err != nil {
+		return err
+	}
+
+	sc.notifyLogout(sessions)
+
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user except the current
+// one, such as after a password change.
+func (sc SessionController) RevokeOtherSessions(userID int, currentSessionID string) error {
+	sessions, err := sc.SessionRepository.GetSessionsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	var endedSessions []models.Session
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := sc.SessionRepository.DeleteSession(session.ID); err != nil {
+			log.Printf("controllers > session.go > RevokeOtherSessions > failed to delete session %s", session.ID)
+			return err
+		}
+		endedSessions = append(endedSessions, session)
+	}
+
+	sc.notifyLogout(endedSessions)
+
+	return nil
+}
+
+func (sc SessionController) notifyLogout(sessions []models.Session) {
+	if sc.LogoutNotifier != nil {
+		sc.LogoutNotifier.NotifyLogout(sessions)
+	}
+}
@@ -0,0 +1,367 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Errors returned when a token exchange is refused, matching the error codes
+// of RFC 8693 section 2.2.2.
+var (
+	ErrInvalidSubjectToken = fmt.Errorf("invalid subject token")
+	ErrAudienceNotAllowed  = fmt.Errorf("the client may not exchange tokens for this audience")
+	ErrScopeNotAllowed     = fmt.Errorf("the requested scope exceeds the subject token or the client's scopes")
+)
+
+// ErrTokenStateUnavailable is returned when it cannot be checked whether a
+// token has been revoked, such as when the database cannot be reached. It does
+// not mean the token is invalid.
+var ErrTokenStateUnavailable = fmt.Errorf("could not check whether the token has been revoked")
+
+// ErrNotFirstPartyToken is returned for tokens held by OAuth clients or other
+// audiences where only tokens issued to the user directly are accepted.
+var ErrNotFirstPartyToken = fmt.Errorf("token was not issued to the user")
+
+type TokenController struct {
+	UserRepository    repositories.IUserRepository
+	ClientRepository  repositories.IClientRepository
+	SessionRepository repositories.ISessionRepository
+	Denylist          models.TokenDenylist
+}
+
+// ValidateAccessToken validates an access token and checks that it has not
+// been revoked, either directly by its ID, by the user's last "log out
+// everywhere", by the end of the session it was issued for or by the
+// deletion of the client it was issued to.
+func (tc TokenController) ValidateAccessToken(tokenStr string) (models.TokenClaims, error) {
+	token, claims, err := models.ValidateToken(tokenStr)
+	if err != nil {
+		return claims, err
+	}
+	// ID, logout, MFA challenge and email verification tokens are signed with
+	// the same keys, and must not be taken for access tokens
+	if typ, _ := token.Header["typ"].(string); (typ != "" && typ != "JWT") || claims.TokenType != models.AccessToken {
+		return claims, fmt.Errorf("not an access token")
+	}
+
+	if claims.IsClientSubject() {
+		if err := tc.validateClientSubject(claims); err != nil {
+			return claims, err
+		}
+	} else if err := tc.validateUserSubject(&claims); err != nil {
+		return claims, err
+	} else if err := tc.validateSession(claims); err != nil {
+		return claims, err
+	}
+
+	if tc.Denylist != nil {
+		revoked, err := tc.Denylist.IsTokenRevoked(claims.ID)
+		if err != nil {
+			log.Printf("controllers > token.go > ValidateAccessToken > could not check denylist for token %s: %s", claims.ID, err.Error())
+			return claims, ErrTokenStateUnavailable
+		}
+		if revoked {
+			return claims, fmt.Errorf("token has been revoked")
+		}
+	}
+
+	return claims, nil
+}
+
+// ValidateFirstPartyAccessToken works like ValidateAccessToken for the
+// service's own endpoints, such as those managing the user's account and
+// sessions, which refuse tokens issued to OAuth clients.
+func (tc TokenController) ValidateFirstPartyAccessToken(tokenStr string) (models.TokenClaims, error) {
+	_, claims, err := models.ValidateToken(tokenStr)
+	if err != nil {
+		return claims, err
+	}
+	if claims.ClientID != "" || len(claims.Audience) > 0 {
+		return claims, ErrNotFirstPartyToken
+	}
+
+	return tc.ValidateAccessToken(tokenStr)
+}
+
+// validateUserSubject resolves the subject to the user it identifies and
+// checks the token has not been revoked by bumping the user's token version.
+func (tc TokenController) validateUserSubject(claims *models.TokenClaims) error {
+	userID, err := tc.UserRepository.GetUserIDForSubject(claims.Subject)
+	if err != nil {
+		userID, err = tc.legacySubjectUserID(*claims)
+		if err != nil {
+			return fmt.Errorf("invalid token subject")
+		}
+	}
+
+	tokenVersion, err := tc.UserRepository.GetTokenVersion(userID)
+	if err != nil {
+		log.Printf("controllers > token.go > validateUserSubject > could not get token version of user ID %d: %s", userID, err.Error())
+		return ErrTokenStateUnavailable
+	}
+	if tokenVersion != claims.TokenVersion {
+		return fmt.Errorf("token has been revoked")
+	}
+
+	claims.SetUserID(userID)
+	return nil
+}
+
+// legacySubjectUserID resolves the subject of an access token minted before
+// public IDs were introduced, which is the user's ID itself.
+func (tc TokenController) legacySubjectUserID(claims models.TokenClaims) (int, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	userID, ok := models.LegacySubjectUserID(claims.Subject, issuedAt)
+	if !ok {
+		return 0, fmt.Errorf("not a legacy subject")
+	}
+	if _, err := tc.UserRepository.GetUserByID(userID); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// validateSession checks the session the token was issued for has not ended,
+// so revoking a session, or a client's consent, stops its access tokens too.
+func (tc TokenController) validateSession(claims models.TokenClaims) error {
+	if tc.SessionRepository == nil || claims.SessionID == "" {
+		return nil
+	}
+
+	_, err := tc.SessionRepository.GetSessionByID(claims.SessionID)
+	if err == repositories.ErrSessionNotFound {
+		return fmt.Errorf("token has been revoked")
+	}
+	if err != nil {
+		log.Printf("controllers > token.go > validateSession > could not get session %s: %s", claims.SessionID, err.Error())
+		return ErrTokenStateUnavailable
+	}
+
+	return nil
+}
+
+func (tc TokenController) validateClientSubject(claims models.TokenClaims) error {
+	// exchanged tokens are held by the acting client rather than the subject
+	if claims.Subject == "" || (claims.Actor == nil && claims.Subject != claims.ClientID) {
+		return fmt.Errorf("invalid token subject")
+	}
+
+	if tc.ClientRepository != nil {
+		_, err := tc.ClientRepository.GetClientByID(claims.Subject)
+		if err == repositories.ErrClientNotFound {
+			return fmt.Errorf("token has been revoked")
+		}
+		if err != nil {
+			log.Printf("controllers > token.go > validateClientSubject > could not get client %s: %s", claims.Subject, err.Error())
+			return ErrTokenStateUnavailable
+		}
+	}
+
+	return nil
+}
+
+// ExchangeToken implements RFC 8693 token exchange: it validates the subject
+// token and mints a token for the same subject that the client can use on
+// the subject's behalf, restricted to the audience and with at most the
+// subject token's scope. The client is recorded as the actor, and the new
+// token expires no later than the subject token.
+func (tc TokenController) ExchangeToken(client models.Client, subjectToken string, audience string, scope string) (string, models.TokenClaims, error) {
+	subject, err := tc.ValidateAccessToken(subjectToken)
+	if err == ErrTokenStateUnavailable {
+		return "", models.TokenClaims{}, err
+	}
+	if err != nil {
+		return "", models.TokenClaims{}, ErrInvalidSubjectToken
+	}
+	// a token restricted to an audience can only be passed on by that audience
+	if len(subject.Audience) > 0 && !subject.VerifyAudience(client.ID, true) {
+		return "", models.TokenClaims{}, ErrInvalidSubjectToken
+	}
+
+	if !client.AllowsAudience(audience) {
+		return "", models.TokenClaims{}, ErrAudienceNotAllowed
+	}
+
+	if scope == "" {
+		scope = subject.Scope
+	}
+	if !models.ScopeCovers(subject.Scope, scope) || !client.AllowsScope(scope) {
+		return "", models.TokenClaims{}, ErrScopeNotAllowed
+	}
+
+	expiresAt := time.Now().Add(client.AccessTokenTTL())
+	if subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	claims := subject
+	claims.ID = ""
+	claims.Audience = jwt.ClaimStrings{audience}
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.ClientID = client.ID
+	claims.Scope = scope
+	claims.Actor = &models.ActorClaim{Subject: client.ID, Actor: subject.Actor}
+	if !client.FirstParty {
+		// third party clients act with scopes only, as with tokens issued to them directly
+		claims.UserRoles = nil
+	}
+
+	token, err := models.MintToken(claims)
+	if err != nil {
+		log.Printf("controllers > token.go > ExchangeToken > failed to mint token for client %s", client.ID)
+		return "", models.TokenClaims{}, err
+	}
+
+	return token, claims, nil
+}
+
+// IntrospectToken describes an access or refresh token for RFC 7662 token
+// introspection. The hint only decides which kind of token is looked up first.
+// Errors are only returned when the token could not be looked up, not for
+// inactive tokens.
+func (tc TokenController) IntrospectToken(token string, tokenTypeHint string) (models.TokenIntrospection, error) {
+	introspectors := []func(string) (models.TokenIntrospection, error){tc.introspectAccessToken, tc.introspectRefreshToken}
+	if tokenTypeHint == "refresh_token" {
+		introspectors = []func(string) (models.TokenIntrospection, error){tc.introspectRefreshToken, tc.introspectAccessToken}
+	}
+
+	for _, introspect := range introspectors {
+		introspection, err := introspect(token)
+		if err != nil || introspection.Active {
+			return introspection, err
+		}
+	}
+
+	return models.TokenIntrospection{Active: false}, nil
+}
+
+func (tc TokenController) introspectAccessToken(token string) (models.TokenIntrospection, error) {
+	claims, err := tc.ValidateAccessToken(token)
+	if err == ErrTokenStateUnavailable {
+		return models.TokenIntrospection{}, err
+	}
+	if err != nil {
+		return models.TokenIntrospection{Active: false}, nil
+	}
+
+	return models.TokenIntrospection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Aud:       claims.Audience,
+		Act:       claims.Actor,
+		TokenType: "access_token",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Roles:     claims.UserRoles,
+	}, nil
+}
+
+func (tc TokenController) introspectRefreshToken(token string) (models.TokenIntrospection, error) {
+	session, err := tc.SessionRepository.GetSessionByRefreshTokenHash(utils.HashToken(token))
+	if err != nil || time.Now().After(session.ExpiresAt) {
+		return models.TokenIntrospection{Active: false}, nil
+	}
+
+	// the subject is the one the session's access tokens identify the user by
+	var client models.Client
+	if session.ClientID != "" {
+		client, err = tc.ClientRepository.GetClientByID(session.ClientID)
+		if err == repositories.ErrClientNotFound {
+			return models.TokenIntrospection{Active: false}, nil
+		}
+		if err != nil {
+			return models.TokenIntrospection{}, err
+		}
+	}
+	userController := UserController{UserRepository: tc.UserRepository}
+	user, err := userController.GetUserByID(session.UserID)
+	if err != nil {
+		return models.TokenIntrospection{Active: false}, nil
+	}
+	subject, err := userController.GetSubjectForClient(user, client)
+	if err != nil {
+		log.Printf("controllers > token.go > introspectRefreshToken > failed to get subject of user %d for session %s", user.ID, session.ID)
+		return models.TokenIntrospection{}, err
+	}
+
+	return models.TokenIntrospection{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID,
+		TokenType: "refresh_token",
+		Exp:       session.ExpiresAt.Unix(),
+		Iat:       session.LastUsedAt.Unix(),
+		Sub:       subject,
+	}, nil
+}
+
+// RevokeToken implements RFC 7009 token revocation for an access or refresh
+// token. Clients can only revoke tokens that were issued to them, so tokens of
+// other clients and first party tokens are left alone, as are unknown tokens.
+// The hint only decides which kind of token is looked up first.
+func (tc TokenController) RevokeToken(client models.Client, token string, tokenTypeHint string) error {
+	revokers := []func(models.Client, string) (bool, error){tc.revokeAccessToken, tc.revokeRefreshToken}
+	if tokenTypeHint == "refresh_token" {
+		revokers = []func(models.Client, string) (bool, error){tc.revokeRefreshToken, tc.revokeAccessToken}
+	}
+
+	for _, revoke := range revokers {
+		revoked, err := revoke(client, token)
+		if err != nil || revoked {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeAccessToken denylists an access token issued to the client.
+func (tc TokenController) revokeAccessToken(client models.Client, token string) (bool, error) {
+	_, claims, err := models.ValidateToken(token)
+	if err != nil || claims.TokenType != models.AccessToken || claims.ExpiresAt == nil {
+		return false, nil
+	}
+	if claims.ClientID != client.ID {
+		return false, nil
+	}
+
+	if err := tc.Denylist.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Printf("controllers > token.go > revokeAccessToken > could not revoke token %s", claims.ID)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// revokeRefreshToken ends the session of a refresh token issued to the client.
+func (tc TokenController) revokeRefreshToken(client models.Client, token string) (bool, error) {
+	session, err := tc.SessionRepository.GetSessionByRefreshTokenHash(utils.HashToken(token))
+	if err != nil {
+		return false, nil
+	}
+	if session.ClientID != client.ID {
+		return false, nil
+	}
+
+	if err := tc.SessionRepository.DeleteSession(session.ID); err != nil {
+		log.Printf("controllers > token.go > revokeRefreshToken > could not delete session %s", session.ID)
+		return false, err
+	}
+
+	return true, nil
+}
@@ -1,12 +1,26 @@
 package controllers
 
 import (
+	"fmt"
 	"jwt-auth-service/models"
 	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrIncorrectPassword is returned when a signed in user confirms a change
+// with the wrong password.
+var ErrIncorrectPassword = fmt.Errorf("current password is incorrect")
+
+// Errors returned for access tokens that cannot be used at the userinfo
+// endpoint, both of which are the insufficient_scope error of RFC 6750.
+var (
+	ErrOpenIDScopeRequired = fmt.Errorf("the access token was not granted the openid scope")
+	ErrNotUserToken        = fmt.Errorf("the access token was not issued for a user")
+)
+
 type UserController struct {
 	UserRepository repositories.IUserRepository
 }
@@ -23,12 +37,19 @@ func (uc UserController) AddUser(user models.User) (models.User, models.ErrorRes
 	if errors := user.Validate(); errors != nil {
 		return user, models.ErrorResponse{ErrorMessage: "validation errors occurred", Errors: errors}
 	}
-	hashedPass, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+	hashedPass, err := hashPassword(user.Password)
 	if err != nil {
 		return user, models.ErrorResponse{ErrorMessage: "failed to encrypt password"}
 	}
 
-	user.Password = string(hashedPass)
+	user.Password = hashedPass
+	user.EmailVerified = false
+
+	publicID, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return user, models.ErrorResponse{ErrorMessage: "failed to generate user ID"}
+	}
+	user.PublicID = publicID
 
 	addedUser, err := uc.UserRepository.AddUser(user)
 	if err != nil {
@@ -45,3 +66,94 @@ func (uc UserController) GetUserWithCredentials(email string, password string) (
 func (uc UserController) DeleteUser(id int) error {
 	return uc.UserRepository.DeleteUser(id)
 }
+
+// GetSubjectForClient returns the sub claim identifying the user to the
+// client. Pairwise subjects are recorded, as they cannot be reversed when the
+// client presents a token.
+func (uc UserController) GetSubjectForClient(user models.User, client models.Client) (string, error) {
+	subject, err := client.SubjectFor(user)
+	if err != nil || !client.IsPairwise() {
+		return subject, err
+	}
+
+	if err := uc.UserRepository.AddPairwiseSubject(subject, user.ID, client.Sector()); err != nil {
+		return "", err
+	}
+
+	return subject, nil
+}
+
+// GetUserInfo returns the claims about the user of an access token that the
+// client it was issued to may see, see OpenID Connect Core 1.0 section 5.3.
+// The token's subject already identifies the user to that client.
+func (uc UserController) GetUserInfo(claims models.TokenClaims) (models.UserInfo, error) {
+	if !claims.HasScope("openid") {
+		return models.UserInfo{}, ErrOpenIDScopeRequired
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return models.UserInfo{}, ErrNotUserToken
+	}
+
+	user, err := uc.UserRepository.GetUserByID(userID)
+	if err != nil {
+		return models.UserInfo{}, err
+	}
+
+	return models.NewUserInfo(claims.Subject, user, claims.Scope), nil
+}
+
+// IssueIDToken returns the ID token telling the client who signed in for an
+// authorization code issued with the openid scope, under the subject
+// identifying the user to that client.
+func (uc UserController) IssueIDToken(user models.User, client models.Client, authorizationCode models.AuthorizationCode) (string, error) {
+	subject, err := uc.GetSubjectForClient(user, client)
+	if err != nil {
+		log.Printf("controllers > user.go > IssueIDToken > failed to get subject of user %d for client %s", user.ID, client.ID)
+		return "", err
+	}
+
+	claims := models.NewIDTokenClaims(models.NewUserInfo(subject, user, authorizationCode.Scope), client.ID, authorizationCode.Nonce, authorizationCode.AuthTime, authorizationCode.SessionID)
+	idToken, err := models.MintIDToken(claims)
+	if err != nil {
+		log.Printf("controllers > user.go > IssueIDToken > failed to mint ID token for client %s", client.ID)
+		return "", err
+	}
+
+	return idToken, nil
+}
+
+// ChangePassword replaces the password of a signed in user, who has to
+// confirm the change with their current password.
+func (uc UserController) ChangePassword(userID int, currentPassword string, newPassword string) error {
+	user, err := uc.UserRepository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	// checked the same way as when signing in
+	if user, err = uc.UserRepository.GetUserWithCredentials(user.Email, currentPassword); err != nil || user.ID != userID {
+		return ErrIncorrectPassword
+	}
+	if errors := models.ValidatePassword(newPassword); errors != nil {
+		return ErrInvalidPassword
+	}
+
+	passwordHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return uc.UserRepository.UpdatePassword(userID, passwordHash)
+}
+
+// hashPassword returns the bcrypt hash a password is stored as.
+func hashPassword(password string) (string, error) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashedPass), nil
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidPasskey  = fmt.Errorf("passkey could not be verified")
+	ErrPasskeyNotFound = fmt.Errorf("passkey not found")
+)
+
+type WebAuthnController struct {
+	WebAuthnRepository repositories.IWebAuthnRepository
+	UserRepository     repositories.IUserRepository
+}
+
+// BeginRegistration starts registering a passkey for the user, returning the
+// options to create it with.
+func (wc WebAuthnController) BeginRegistration(user models.User) (models.CredentialCreationOptions, error) {
+	rp, err := models.CurrentRelyingParty()
+	if err != nil {
+		return models.CredentialCreationOptions{}, err
+	}
+
+	credentials, err := wc.WebAuthnRepository.GetCredentialsForUser(user.ID)
+	if err != nil {
+		return models.CredentialCreationOptions{}, err
+	}
+
+	challenge, err := wc.newChallenge(user.ID, models.CeremonyRegistration)
+	if err != nil {
+		return models.CredentialCreationOptions{}, err
+	}
+
+	return models.NewCredentialCreationOptions(rp, user, challenge, credentials), nil
+}
+
+// FinishRegistration verifies the passkey the user's authenticator created
+// and stores it under the given name, see WebAuthn Level 2 section 7.1.
+func (wc WebAuthnController) FinishRegistration(user models.User, response models.RegistrationResponse, name string) (models.WebAuthnCredential, error) {
+	rp, err := models.CurrentRelyingParty()
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	clientDataJSON, err := models.DecodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+	if err := wc.verifyClientData(rp, clientDataJSON, "webauthn.create", models.CeremonyRegistration, user.ID); err != nil {
+		log.Printf("controllers > webauthn.go > FinishRegistration > rejected passkey of user ID %d: %s", user.ID, err.Error())
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	attestationObject, err := models.DecodeBase64URL(response.Response.AttestationObject)
+	if err != nil {
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+	format, rawAuthData, err := models.ParseAttestationObject(attestationObject)
+	if err != nil || format != "none" {
+		log.Printf("controllers > webauthn.go > FinishRegistration > rejected attestation of format %q for user ID %d", format, user.ID)
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	authData, err := models.ParseAuthenticatorData(rawAuthData)
+	if err == nil {
+		err = rp.VerifyAuthenticatorData(authData, false)
+	}
+	if err == nil && authData.CredentialID == nil {
+		err = fmt.Errorf("no attested credential data")
+	}
+	if err == nil {
+		_, err = models.ParseCOSEKey(authData.CredentialPublicKey)
+	}
+	if err != nil {
+		log.Printf("controllers > webauthn.go > FinishRegistration > rejected passkey of user ID %d: %s", user.ID, err.Error())
+		return models.WebAuthnCredential{}, ErrInvalidPasskey
+	}
+
+	credential := models.WebAuthnCredential{
+		ID:        authData.CredentialID,
+		UserID:    user.ID,
+		PublicKey: authData.CredentialPublicKey,
+		SignCount: authData.SignCount,
+		AAGUID:    authData.AAGUID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	if err := wc.WebAuthnRepository.AddCredential(credential); err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	return credential, nil
+}
+
+// BeginLogin starts signing in with a passkey instead of a password. Any of
+// the user's passkeys can be picked, and the user is only known once they
+// have picked one.
+func (wc WebAuthnController) BeginLogin() (models.CredentialRequestOptions, error) {
+	return wc.beginAssertion(0, models.CeremonyLogin)
+}
+
+// FinishLogin verifies the passkey a user signed in with, returning the user
+// and the methods they signed in with.
+func (wc WebAuthnController) FinishLogin(response models.AssertionResponse) (models.User, []string, error) {
+	return wc.finishAssertion(response, models.CeremonyLogin, 0)
+}
+
+// BeginSecondFactor starts confirming a sign in of the user with one of their
+// passkeys, after they entered their password.
+func (wc WebAuthnController) BeginSecondFactor(userID int) (models.CredentialRequestOptions, error) {
+	return wc.beginAssertion(userID, models.CeremonySecondFactor)
+}
+
+// FinishSecondFactor verifies the passkey the user confirmed their sign in
+// with, returning the methods it counts as along with their password.
+func (wc WebAuthnController) FinishSecondFactor(userID int, response models.AssertionResponse) ([]string, error) {
+	if _, _, err := wc.finishAssertion(response, models.CeremonySecondFactor, userID); err != nil {
+		return nil, err
+	}
+
+	return []string{models.AuthMethodHardwareKey, models.AuthMethodMFA}, nil
+}
+
+func (wc WebAuthnController) GetCredentials(userID int) ([]models.WebAuthnCredential, error) {
+	return wc.WebAuthnRepository.GetCredentialsForUser(userID)
+}
+
+func (wc WebAuthnController) DeleteCredential(userID int, credentialID []byte) error {
+	if err := wc.WebAuthnRepository.DeleteCredential(userID, credentialID); err != nil {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+func (wc WebAuthnController) beginAssertion(userID int, ceremony string) (models.CredentialRequestOptions, error) {
+	rp, err := models.CurrentRelyingParty()
+	if err != nil {
+		return models.CredentialRequestOptions{}, err
+	}
+
+	var credentials []models.WebAuthnCredential
+	if userID != 0 {
+		credentials, err = wc.WebAuthnRepository.GetCredentialsForUser(userID)
+		if err != nil {
+			return models.CredentialRequestOptions{}, err
+		}
+		if len(credentials) == 0 {
+			return models.CredentialRequestOptions{}, ErrPasskeyNotFound
+		}
+	}
+
+	challenge, err := wc.newChallenge(userID, ceremony)
+	if err != nil {
+		return models.CredentialRequestOptions{}, err
+	}
+
+	return models.NewCredentialRequestOptions(rp, challenge, ceremony, credentials), nil
+}
+
+// finishAssertion verifies an assertion of a passkey, see WebAuthn Level 2
+// section 7.2. The signature counter must have increased since the passkey
+// was last used, unless the authenticator does not keep one, as otherwise
+// the passkey may have been cloned.
+func (wc WebAuthnController) finishAssertion(response models.AssertionResponse, ceremony string, userID int) (models.User, []string, error) {
+	rp, err := models.CurrentRelyingParty()
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	clientDataJSON, err := models.DecodeBase64URL(response.Response.ClientDataJSON)
+	if err != nil {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	if err := wc.verifyClientData(rp, clientDataJSON, "webauthn.get", ceremony, userID); err != nil {
+		log.Printf("controllers > webauthn.go > finishAssertion > rejected %s: %s", ceremony, err.Error())
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+
+	credentialID, err := models.DecodeBase64URL(response.RawID)
+	if err != nil {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	credential, err := wc.WebAuthnRepository.GetCredential(credentialID)
+	if err != nil || (userID != 0 && credential.UserID != userID) {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	user, err := wc.UserRepository.GetUserByID(credential.UserID)
+	if err != nil {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	if response.Response.UserHandle != "" {
+		userHandle, err := models.DecodeBase64URL(response.Response.UserHandle)
+		if err != nil || !bytes.Equal(userHandle, []byte(user.PublicID)) {
+			return models.User{}, nil, ErrInvalidPasskey
+		}
+	}
+
+	rawAuthData, err := models.DecodeBase64URL(response.Response.AuthenticatorData)
+	if err != nil {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	signature, err := models.DecodeBase64URL(response.Response.Signature)
+	if err != nil {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+
+	authData, err := models.ParseAuthenticatorData(rawAuthData)
+	if err == nil {
+		err = rp.VerifyAuthenticatorData(authData, ceremony == models.CeremonyLogin)
+	}
+	if err == nil {
+		var publicKey models.COSEKey
+		publicKey, err = models.ParseCOSEKey(credential.PublicKey)
+		if err == nil {
+			clientDataHash := sha256.Sum256(clientDataJSON)
+			err = publicKey.Verify(append(rawAuthData[:len(rawAuthData):len(rawAuthData)], clientDataHash[:]...), signature)
+		}
+	}
+	if err != nil {
+		log.Printf("controllers > webauthn.go > finishAssertion > rejected passkey of user ID %d: %s", user.ID, err.Error())
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		log.Printf("controllers > webauthn.go > finishAssertion > SECURITY EVENT: signature counter of a passkey of user ID %d went from %d to %d, it may have been cloned",
+			user.ID, credential.SignCount, authData.SignCount)
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+	ok, err := wc.WebAuthnRepository.UpdateSignCount(credential.ID, credential.SignCount, authData.SignCount)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	if !ok {
+		return models.User{}, nil, ErrInvalidPasskey
+	}
+
+	// a passkey that verified the user is a factor of its own along with the device
+	methods := []string{models.AuthMethodHardwareKey}
+	if authData.UserVerified() {
+		methods = append(methods, models.AuthMethodMFA)
+	}
+
+	return user, methods, nil
+}
+
+// verifyClientData checks the client data is for the ceremony and answers a
+// challenge issued for it, which is used up.
+func (wc WebAuthnController) verifyClientData(rp models.RelyingParty, clientDataJSON []byte, ceremonyType string, ceremony string, userID int) error {
+	clientData, err := models.ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+
+	challenge, err := wc.WebAuthnRepository.ConsumeChallenge(utils.HashToken(clientData.Challenge))
+	if err != nil {
+		return fmt.Errorf("unknown challenge")
+	}
+	if challenge.Ceremony != ceremony || challenge.UserID != userID || time.Now().After(challenge.ExpiresAt) {
+		return fmt.Errorf("challenge was not issued for this %s", ceremony)
+	}
+
+	return rp.VerifyClientData(clientData, ceremonyType)
+}
+
+func (wc WebAuthnController) newChallenge(userID int, ceremony string) (string, error) {
+	challenge, err := utils.GenerateRandomString(32)
+	if err != nil {
+		log.Printf("controllers > webauthn.go > newChallenge > failed to generate %s challenge", ceremony)
+		return "", err
+	}
+
+	err = wc.WebAuthnRepository.AddChallenge(models.WebAuthnChallenge{
+		ChallengeHash: utils.HashToken(challenge),
+		UserID:        userID,
+		Ceremony:      ceremony,
+		ExpiresAt:     time.Now().Add(models.WebAuthnCeremonyLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
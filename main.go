@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"jwt-auth-service/middleware"
 	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
 	"jwt-auth-service/routes"
+	"jwt-auth-service/utils"
 	"log"
 	"os"
 
@@ -16,13 +18,18 @@ import (
 func main() {
 	initializeEnv()
 
+	if err := models.LoadSigningKeys(); err != nil {
+		log.Fatal(err)
+	}
+
 	//initialize db
 	cfg := mysql.Config{
-		User:   os.Getenv("JWT_AUTH_SERVICE_DB_USER"),
-		Passwd: os.Getenv("JWT_AUTH_SERVICE_DB_PASS"),
-		Net:    "tcp",
-		Addr:   os.Getenv("JWT_AUTH_SERVICE_DB_ADDR"),
-		DBName: os.Getenv("JWT_AUTH_SERVICE_DB_NAME"),
+		User:      os.Getenv("JWT_AUTH_SERVICE_DB_USER"),
+		Passwd:    os.Getenv("JWT_AUTH_SERVICE_DB_PASS"),
+		Net:       "tcp",
+		Addr:      os.Getenv("JWT_AUTH_SERVICE_DB_ADDR"),
+		DBName:    os.Getenv("JWT_AUTH_SERVICE_DB_NAME"),
+		ParseTime: true,
 	}
 
 	db, err := sql.Open("mysql", cfg.FormatDSN())
@@ -30,13 +37,20 @@ func main() {
 		log.Fatal(err)
 	}
 
-	env := &models.Env{DB: db}
+	env := &models.Env{DB: db, Denylist: newTokenDenylist(db), Mailer: newMailer()}
 
 	router := gin.Default()
 	router.Use(middleware.EnvMiddleware(*env))
 
+	routes.AddWellKnownRoutes(router.Group(""))
+
 	pubv1 := router.Group("/v1")
 	routes.AddAuthRoutes(pubv1)
+	routes.AddSessionRoutes(pubv1)
+	routes.AddConsentRoutes(pubv1)
+	routes.AddAccountRoutes(pubv1)
+	routes.AddAdminRoutes(pubv1)
+	routes.AddOAuthRoutes(pubv1)
 
 	router.Run(":8080")
 }
@@ -47,3 +61,40 @@ func initializeEnv() {
 		log.Fatal("Error loading .env file")
 	}
 }
+
+func newTokenDenylist(db *sql.DB) models.TokenDenylist {
+	switch os.Getenv("JWT_AUTH_SERVICE_TOKEN_DENYLIST") {
+	case "memory":
+		return repositories.NewMemoryTokenDenylist()
+	case "", "sql":
+		return repositories.TokenDenylistRepository{DBConn: db}
+	default:
+		log.Fatal("JWT_AUTH_SERVICE_TOKEN_DENYLIST must be one of: memory, sql")
+		return nil
+	}
+}
+
+func newMailer() models.Mailer {
+	from := os.Getenv("JWT_AUTH_SERVICE_MAIL_FROM")
+
+	switch os.Getenv("JWT_AUTH_SERVICE_MAILER") {
+	case "smtp":
+		return utils.SMTPMailer{
+			Addr:     os.Getenv("JWT_AUTH_SERVICE_SMTP_ADDR"),
+			Username: os.Getenv("JWT_AUTH_SERVICE_SMTP_USER"),
+			Password: os.Getenv("JWT_AUTH_SERVICE_SMTP_PASS"),
+			From:     from,
+		}
+	case "", "file":
+		dir := os.Getenv("JWT_AUTH_SERVICE_MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return utils.FileMailer{Dir: dir, From: from}
+	case "memory":
+		return utils.NewMemoryMailer()
+	default:
+		log.Fatal("JWT_AUTH_SERVICE_MAILER must be one of: smtp, file, memory")
+		return nil
+	}
+}
@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"jwt-auth-service/controllers"
 	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
 	"jwt-auth-service/utils"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,26 +13,29 @@ import (
 
 func CookieTokenAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authTokenStr, _, err := utils.GetAuthCookiesFromContext(c)
+		authTokenStr, err := utils.GetAuthTokenCookieFromContext(c)
 		if err != nil {
-			c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: "Could not parse auth token(s)"})
+			c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: "Could not parse auth token"})
 			c.Abort()
 			return
 		}
 
-		_, _, err = models.ValidateToken(authTokenStr)
-
-		if err != nil {
-			c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
-			c.Abort()
-			return
-		}
-
-		c.Next()
+		authenticateToken(c, authTokenStr, true)
 	}
 }
 
 func BearerTokenAuth() gin.HandlerFunc {
+	return bearerTokenAuth(false)
+}
+
+// FirstPartyTokenAuth works like BearerTokenAuth for routes only the user
+// may call, such as those managing their account and sessions. Tokens issued
+// to OAuth clients are refused, even those of first party clients.
+func FirstPartyTokenAuth() gin.HandlerFunc {
+	return bearerTokenAuth(true)
+}
+
+func bearerTokenAuth(firstPartyOnly bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authTokenStr, err := utils.GetBearerTokenFromContext(c)
 		if err != nil {
@@ -38,14 +44,46 @@ func BearerTokenAuth() gin.HandlerFunc {
 			return
 		}
 
-		_, _, err = models.ValidateToken(authTokenStr)
+		authenticateToken(c, authTokenStr, firstPartyOnly)
+	}
+}
 
-		if err != nil {
-			c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
-			c.Abort()
-			return
-		}
+// authenticateToken validates an access token and checks that it has not been
+// revoked before letting the request through.
+func authenticateToken(c *gin.Context, authTokenStr string, firstPartyOnly bool) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("middleware > authentication.go > authenticateToken > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		c.Abort()
+		return
+	}
 
-		c.Next()
+	tokenController := controllers.TokenController{
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		ClientRepository:  repositories.ClientRepository{DBConn: env.DB},
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		Denylist:          env.Denylist,
 	}
+
+	validate := tokenController.ValidateAccessToken
+	if firstPartyOnly {
+		validate = tokenController.ValidateFirstPartyAccessToken
+	}
+
+	claims, err := validate(authTokenStr)
+	if err == controllers.ErrTokenStateUnavailable {
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		c.Abort()
+		return
+	}
+	// tokens restricted to an audience by token exchange are meant for that audience, not this service
+	if err != nil || len(claims.Audience) > 0 {
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		c.Abort()
+		return
+	}
+
+	c.Set("claims", claims)
+	c.Next()
 }
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"jwt-auth-service/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through requests whose auth token carries the role.
+// It must run after BearerTokenAuth or CookieTokenAuth.
+func RequireRole(role models.Roles) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(models.TokenClaims)
+		for _, userRole := range claims.UserRoles {
+			if userRole == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		c.Abort()
+	}
+}
+
+// RequireMFA only lets through requests whose auth token was issued to a
+// session signed in with a second factor. It must run after BearerTokenAuth
+// or CookieTokenAuth.
+func RequireMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(models.TokenClaims)
+		if claims.UsedMFA() {
+			c.Next()
+			return
+		}
+
+		c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: "multi-factor authentication is required, sign in with your authenticator"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,22 @@
+CREATE TABLE SESSIONS (
+    ID            VARCHAR(64)  NOT NULL PRIMARY KEY,
+    USER_ID       INT          NOT NULL,
+    DEVICE_LABEL  VARCHAR(255) NOT NULL DEFAULT '',
+    USER_AGENT    VARCHAR(512) NOT NULL DEFAULT '',
+    IP_ADDRESS    VARCHAR(45)  NOT NULL DEFAULT '',
+    REFRESH_TOKEN TEXT         NOT NULL,
+    CREATED_AT    DATETIME     NOT NULL,
+    LAST_USED_AT  DATETIME     NOT NULL,
+    EXPIRES_AT    DATETIME     NOT NULL,
+    INDEX SESSIONS_USER_ID (USER_ID),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
+
+-- refresh tokens now live on their session, one row per device. Each user's
+-- current refresh token becomes a session of its own, so nobody is signed out
+INSERT INTO SESSIONS (ID, USER_ID, DEVICE_LABEL, REFRESH_TOKEN, CREATED_AT, LAST_USED_AT, EXPIRES_AT)
+SELECT SHA2(CONCAT(UUID(), RAND()), 256), USER_ID, 'Existing sign-in', REFRESH_TOKEN, NOW(), NOW(), NOW() + INTERVAL 7 DAY
+FROM REFRESH_TOKENS
+WHERE REFRESH_TOKEN IS NOT NULL AND REFRESH_TOKEN <> '';
+
+DROP TABLE REFRESH_TOKENS;
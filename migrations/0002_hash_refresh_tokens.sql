@@ -0,0 +1,16 @@
+ALTER TABLE SESSIONS ADD COLUMN REFRESH_TOKEN_HASH CHAR(64) NOT NULL DEFAULT '' AFTER IP_ADDRESS;
+
+-- the JWT refresh tokens sessions hold so far, including those carried over
+-- from REFRESH_TOKENS, keep working, they are looked up by hash like opaque ones
+UPDATE SESSIONS SET REFRESH_TOKEN_HASH = SHA2(REFRESH_TOKEN, 256);
+
+ALTER TABLE SESSIONS
+    DROP COLUMN REFRESH_TOKEN,
+    ADD UNIQUE INDEX SESSIONS_REFRESH_TOKEN_HASH (REFRESH_TOKEN_HASH);
+
+CREATE TABLE ROTATED_REFRESH_TOKENS (
+    REFRESH_TOKEN_HASH CHAR(64)    NOT NULL PRIMARY KEY,
+    SESSION_ID         VARCHAR(64) NOT NULL,
+    ROTATED_AT         DATETIME    NOT NULL,
+    FOREIGN KEY (SESSION_ID) REFERENCES SESSIONS (ID) ON DELETE CASCADE
+);
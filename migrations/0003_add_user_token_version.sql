@@ -0,0 +1 @@
+ALTER TABLE USERS ADD COLUMN TOKEN_VERSION INT NOT NULL DEFAULT 0;
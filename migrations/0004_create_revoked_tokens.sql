@@ -0,0 +1,5 @@
+CREATE TABLE REVOKED_TOKENS (
+    JTI        VARCHAR(64) NOT NULL PRIMARY KEY,
+    EXPIRES_AT DATETIME    NOT NULL,
+    INDEX REVOKED_TOKENS_EXPIRES_AT (EXPIRES_AT)
+);
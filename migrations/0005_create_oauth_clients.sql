@@ -0,0 +1,6 @@
+CREATE TABLE OAUTH_CLIENTS (
+    ID          VARCHAR(64)  NOT NULL PRIMARY KEY,
+    NAME        VARCHAR(255) NOT NULL DEFAULT '',
+    SECRET_HASH VARCHAR(255) NOT NULL DEFAULT '',
+    CREATED_AT  DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,18 @@
+ALTER TABLE OAUTH_CLIENTS ADD COLUMN REDIRECT_URIS TEXT NOT NULL;
+
+ALTER TABLE SESSIONS
+    ADD COLUMN CLIENT_ID VARCHAR(64)   NOT NULL DEFAULT '' AFTER USER_ID,
+    ADD COLUMN SCOPE     VARCHAR(1024) NOT NULL DEFAULT '' AFTER CLIENT_ID;
+
+CREATE TABLE OAUTH_AUTHORIZATION_CODES (
+    CODE_HASH             CHAR(64)      NOT NULL PRIMARY KEY,
+    CLIENT_ID             VARCHAR(64)   NOT NULL,
+    USER_ID               INT           NOT NULL,
+    REDIRECT_URI          TEXT          NOT NULL,
+    SCOPE                 VARCHAR(1024) NOT NULL DEFAULT '',
+    CODE_CHALLENGE        VARCHAR(128)  NOT NULL,
+    CODE_CHALLENGE_METHOD VARCHAR(16)   NOT NULL,
+    EXPIRES_AT            DATETIME      NOT NULL,
+    FOREIGN KEY (CLIENT_ID) REFERENCES OAUTH_CLIENTS (ID) ON DELETE CASCADE,
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+ALTER TABLE OAUTH_CLIENTS
+    ADD COLUMN GRANT_TYPES            VARCHAR(255) NOT NULL DEFAULT 'authorization_code refresh_token' AFTER REDIRECT_URIS,
+    ADD COLUMN SCOPES                 TEXT         NOT NULL AFTER GRANT_TYPES,
+    ADD COLUMN ACCESS_TOKEN_LIFETIME  INT          NOT NULL DEFAULT 0 AFTER SCOPES,
+    ADD COLUMN REFRESH_TOKEN_LIFETIME INT          NOT NULL DEFAULT 0 AFTER ACCESS_TOKEN_LIFETIME;
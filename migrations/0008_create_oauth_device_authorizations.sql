@@ -0,0 +1,13 @@
+CREATE TABLE OAUTH_DEVICE_AUTHORIZATIONS (
+    DEVICE_CODE_HASH CHAR(64)      NOT NULL PRIMARY KEY,
+    USER_CODE        VARCHAR(16)   NOT NULL UNIQUE,
+    CLIENT_ID        VARCHAR(64)   NOT NULL,
+    SCOPE            VARCHAR(1024) NOT NULL DEFAULT '',
+    USER_ID          INT           NULL,
+    STATUS           VARCHAR(16)   NOT NULL DEFAULT 'pending',
+    POLL_INTERVAL    INT           NOT NULL,
+    LAST_POLLED_AT   DATETIME      NULL,
+    EXPIRES_AT       DATETIME      NOT NULL,
+    FOREIGN KEY (CLIENT_ID) REFERENCES OAUTH_CLIENTS (ID) ON DELETE CASCADE,
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+ALTER TABLE OAUTH_AUTHORIZATION_CODES
+    ADD COLUMN NONCE     VARCHAR(255) NOT NULL DEFAULT '' AFTER CODE_CHALLENGE_METHOD,
+    ADD COLUMN AUTH_TIME DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP AFTER NONCE;
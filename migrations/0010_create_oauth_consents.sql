@@ -0,0 +1,12 @@
+ALTER TABLE OAUTH_CLIENTS ADD COLUMN FIRST_PARTY BOOLEAN NOT NULL DEFAULT FALSE AFTER REFRESH_TOKEN_LIFETIME;
+
+CREATE TABLE OAUTH_CONSENTS (
+    USER_ID    INT           NOT NULL,
+    CLIENT_ID  VARCHAR(64)   NOT NULL,
+    SCOPE      VARCHAR(1024) NOT NULL DEFAULT '',
+    CREATED_AT DATETIME      NOT NULL,
+    UPDATED_AT DATETIME      NOT NULL,
+    PRIMARY KEY (USER_ID, CLIENT_ID),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE,
+    FOREIGN KEY (CLIENT_ID) REFERENCES OAUTH_CLIENTS (ID) ON DELETE CASCADE
+);
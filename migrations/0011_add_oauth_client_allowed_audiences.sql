@@ -0,0 +1 @@
+ALTER TABLE OAUTH_CLIENTS ADD COLUMN ALLOWED_AUDIENCES TEXT NOT NULL AFTER FIRST_PARTY;
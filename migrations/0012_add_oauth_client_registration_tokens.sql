@@ -0,0 +1 @@
+ALTER TABLE OAUTH_CLIENTS ADD COLUMN REGISTRATION_TOKEN_HASH CHAR(64) NOT NULL DEFAULT '' AFTER ALLOWED_AUDIENCES;
@@ -0,0 +1,10 @@
+ALTER TABLE OAUTH_CLIENTS
+    ADD COLUMN BACKCHANNEL_LOGOUT_URI  TEXT NOT NULL AFTER ALLOWED_AUDIENCES,
+    ADD COLUMN FRONTCHANNEL_LOGOUT_URI TEXT NOT NULL AFTER BACKCHANNEL_LOGOUT_URI;
+
+-- client sessions remember the browser session they were authorized from, so signing out there signs out of the clients too
+ALTER TABLE SESSIONS
+    ADD COLUMN PARENT_SESSION_ID VARCHAR(64) NOT NULL DEFAULT '' AFTER SCOPE,
+    ADD INDEX SESSIONS_PARENT_SESSION_ID (PARENT_SESSION_ID);
+
+ALTER TABLE OAUTH_AUTHORIZATION_CODES ADD COLUMN SESSION_ID VARCHAR(64) NOT NULL DEFAULT '' AFTER AUTH_TIME;
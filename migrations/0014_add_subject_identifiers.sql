@@ -0,0 +1,20 @@
+-- users are identified to clients by an opaque public ID instead of their row ID; existing users get a random one
+-- access tokens issued before this still name the row ID, and are accepted while JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE is set to the time it ran
+ALTER TABLE USERS ADD COLUMN PUBLIC_ID VARCHAR(64) NULL AFTER ID;
+UPDATE USERS SET PUBLIC_ID = LEFT(SHA2(CONCAT(UUID(), RAND(), ID), 256), 32) WHERE PUBLIC_ID IS NULL;
+ALTER TABLE USERS
+    MODIFY COLUMN PUBLIC_ID VARCHAR(64) NOT NULL,
+    ADD UNIQUE INDEX USERS_PUBLIC_ID (PUBLIC_ID);
+
+ALTER TABLE OAUTH_CLIENTS
+    ADD COLUMN SUBJECT_TYPE      VARCHAR(16)  NOT NULL DEFAULT 'public' AFTER ALLOWED_AUDIENCES,
+    ADD COLUMN SECTOR_IDENTIFIER VARCHAR(255) NOT NULL DEFAULT '' AFTER SUBJECT_TYPE;
+
+-- pairwise subjects cannot be reversed, so the user each one was issued for is recorded
+CREATE TABLE OAUTH_PAIRWISE_SUBJECTS (
+    SUBJECT           CHAR(64)     NOT NULL,
+    USER_ID           INT          NOT NULL,
+    SECTOR_IDENTIFIER VARCHAR(255) NOT NULL,
+    PRIMARY KEY (SUBJECT),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+-- existing users are unverified too, which only stops them signing in when JWT_AUTH_SERVICE_REQUIRE_VERIFIED_EMAIL is set
+ALTER TABLE USERS
+    ADD COLUMN EMAIL_VERIFIED             BOOLEAN  NOT NULL DEFAULT FALSE AFTER EMAIL,
+    ADD COLUMN VERIFICATION_EMAIL_SENT_AT DATETIME NULL AFTER EMAIL_VERIFIED;
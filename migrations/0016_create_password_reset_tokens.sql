@@ -0,0 +1,8 @@
+CREATE TABLE PASSWORD_RESET_TOKENS (
+    TOKEN_HASH CHAR(64) NOT NULL PRIMARY KEY,
+    USER_ID    INT      NOT NULL,
+    EXPIRES_AT DATETIME NOT NULL,
+    CREATED_AT DATETIME NOT NULL,
+    INDEX PASSWORD_RESET_TOKENS_USER_ID (USER_ID),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+CREATE TABLE MFA_TOTP (
+    USER_ID        INT          NOT NULL PRIMARY KEY,
+    SECRET         VARCHAR(128) NOT NULL,
+    CONFIRMED      BOOLEAN      NOT NULL DEFAULT FALSE,
+    LAST_USED_STEP BIGINT       NOT NULL DEFAULT 0,
+    CREATED_AT     DATETIME     NOT NULL,
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
+
+CREATE TABLE MFA_RECOVERY_CODES (
+    CODE_HASH  CHAR(64) NOT NULL PRIMARY KEY,
+    USER_ID    INT      NOT NULL,
+    CREATED_AT DATETIME NOT NULL,
+    INDEX MFA_RECOVERY_CODES_USER_ID (USER_ID),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
+
+-- the methods a session was signed in with, space separated, e.g. "pwd otp mfa"
+ALTER TABLE SESSIONS
+    ADD COLUMN AMR VARCHAR(64) NOT NULL DEFAULT '' AFTER IP_ADDRESS;
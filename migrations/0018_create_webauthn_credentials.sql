@@ -0,0 +1,21 @@
+CREATE TABLE WEBAUTHN_CREDENTIALS (
+    ID           VARBINARY(1023) NOT NULL PRIMARY KEY,
+    USER_ID      INT             NOT NULL,
+    PUBLIC_KEY   BLOB            NOT NULL,
+    SIGN_COUNT   INT UNSIGNED    NOT NULL DEFAULT 0,
+    AAGUID       BINARY(16)      NOT NULL,
+    NAME         VARCHAR(64)     NOT NULL DEFAULT '',
+    CREATED_AT   DATETIME        NOT NULL,
+    LAST_USED_AT DATETIME        NULL,
+    INDEX WEBAUTHN_CREDENTIALS_USER_ID (USER_ID),
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
+
+-- USER_ID is NULL for challenges of passkey logins, where the user picks their passkey
+CREATE TABLE WEBAUTHN_CHALLENGES (
+    CHALLENGE_HASH CHAR(64)    NOT NULL PRIMARY KEY,
+    USER_ID        INT         NULL,
+    CEREMONY       VARCHAR(16) NOT NULL,
+    EXPIRES_AT     DATETIME    NOT NULL,
+    FOREIGN KEY (USER_ID) REFERENCES USERS (ID) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+-- wrong codes are counted per user, who is locked out for a while after too many in a row
+ALTER TABLE MFA_TOTP
+    ADD COLUMN FAILED_ATTEMPTS INT      NOT NULL DEFAULT 0 AFTER LAST_USED_STEP,
+    ADD COLUMN LOCKED_UNTIL    DATETIME NULL AFTER FAILED_ATTEMPTS;
@@ -0,0 +1,3 @@
+-- password reset emails are throttled per user like verification emails
+ALTER TABLE USERS
+    ADD COLUMN PASSWORD_RESET_EMAIL_SENT_AT DATETIME NULL AFTER VERIFICATION_EMAIL_SENT_AT;
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"time"
+)
+
+const AuthorizationCodeLifetime = time.Minute * 10
+
+var codeVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              int
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	SessionID           string
+	ExpiresAt           time.Time
+}
+
+// VerifyCodeVerifier checks a PKCE code verifier (RFC 7636) against the
+// challenge the code was issued for. Only the S256 method is supported.
+func (code AuthorizationCode) VerifyCodeVerifier(verifier string) bool {
+	if code.CodeChallengeMethod != "S256" || !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) == 1
+}
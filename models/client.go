@@ -0,0 +1,238 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const RefreshTokenLifetime = time.Hour * 168 // 1 week
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+var supportedGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials, GrantTypeDeviceCode, GrantTypeTokenExchange}
+
+type Client struct {
+	ID                    string    `json:"client_id"`
+	Name                  string    `json:"client_name"`
+	SecretHash            string    `json:"-"`
+	RegistrationTokenHash string    `json:"-"` // only set for clients that registered themselves, see RFC 7592
+	RedirectURIs          []string  `json:"redirect_uris"`
+	GrantTypes            []string  `json:"grant_types"`
+	Scopes                []string  `json:"scopes"`
+	AccessTokenLifetime   int       `json:"access_token_lifetime,omitempty"`
+	RefreshTokenLifetime  int       `json:"refresh_token_lifetime,omitempty"`
+	FirstParty            bool      `json:"first_party"`
+	AllowedAudiences      []string  `json:"allowed_audiences"`
+	SubjectType           string    `json:"subject_type"`
+	SectorIdentifier      string    `json:"sector_identifier,omitempty"`
+	BackchannelLogoutURI  string    `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutURI string    `json:"frontchannel_logout_uri,omitempty"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// IsPublic reports whether the client has no secret, e.g. a native or
+// browser based app that cannot keep one.
+func (client Client) IsPublic() bool {
+	return client.SecretHash == ""
+}
+
+// IsSelfRegistered reports whether the client registered itself through
+// dynamic client registration rather than being added by an admin.
+func (client Client) IsSelfRegistered() bool {
+	return client.RegistrationTokenHash != ""
+}
+
+// HasRedirectURI reports whether uri exactly matches one of the client's
+// registered redirect URIs.
+func (client Client) HasRedirectURI(uri string) bool {
+	return ContainsString(client.RedirectURIs, uri)
+}
+
+// RequiresConsent reports whether users must approve the scopes the client
+// asks for. Only the service's own first party apps are trusted without.
+func (client Client) RequiresConsent() bool {
+	return !client.FirstParty
+}
+
+func (client Client) AllowsGrantType(grantType string) bool {
+	return ContainsString(client.GrantTypes, grantType)
+}
+
+// AllowsScope reports whether every scope in the space separated scope
+// string is one the client is allowed to request.
+func (client Client) AllowsScope(scope string) bool {
+	for _, requested := range strings.Fields(scope) {
+		if !ContainsString(client.Scopes, requested) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AllowsAudience reports whether the client may exchange tokens for tokens
+// restricted to the audience.
+func (client Client) AllowsAudience(audience string) bool {
+	return ContainsString(client.AllowedAudiences, audience)
+}
+
+// AccessTokenTTL returns how long the client's access tokens are valid, which
+// is AccessTokenLifetime seconds if set and the service default otherwise.
+func (client Client) AccessTokenTTL() time.Duration {
+	if client.AccessTokenLifetime > 0 {
+		return time.Duration(client.AccessTokenLifetime) * time.Second
+	}
+
+	return AccessTokenLifetime
+}
+
+// RefreshTokenTTL returns how long the client's refresh tokens are valid,
+// which is RefreshTokenLifetime seconds if set and the service default
+// otherwise.
+func (client Client) RefreshTokenTTL() time.Duration {
+	if client.RefreshTokenLifetime > 0 {
+		return time.Duration(client.RefreshTokenLifetime) * time.Second
+	}
+
+	return RefreshTokenLifetime
+}
+
+func (client Client) Validate() []string {
+	var validationErrors []string
+	const missingRequiredFieldMsg = "missing required field %s"
+
+	if len(strings.TrimSpace(client.Name)) == 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf(missingRequiredFieldMsg, "client_name"))
+	}
+	if len(client.GrantTypes) == 0 {
+		validationErrors = append(validationErrors, fmt.Sprintf(missingRequiredFieldMsg, "grant_types"))
+	}
+	for _, grantType := range client.GrantTypes {
+		if !ContainsString(supportedGrantTypes, grantType) {
+			validationErrors = append(validationErrors, fmt.Sprintf("unsupported grant type: %s", grantType))
+		}
+	}
+	if client.AllowsGrantType(GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		validationErrors = append(validationErrors, "the authorization_code grant requires at least one redirect URI")
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid redirect URI %q: %s", redirectURI, err.Error()))
+		}
+	}
+	for _, scope := range client.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \"\\") {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid scope: %q", scope))
+		}
+	}
+	for _, audience := range client.AllowedAudiences {
+		if audience == "" || strings.ContainsAny(audience, " \t\n") {
+			validationErrors = append(validationErrors, fmt.Sprintf("invalid audience: %q", audience))
+		}
+	}
+	if client.SubjectType != "" && !ContainsString(supportedSubjectTypes, client.SubjectType) {
+		validationErrors = append(validationErrors, fmt.Sprintf("unsupported subject type: %s", client.SubjectType))
+	}
+	if client.IsPairwise() && client.SectorIdentifier == "" && !client.IsSelfRegistered() && len(client.redirectURIHosts()) > 1 {
+		validationErrors = append(validationErrors, "pairwise clients with redirect URIs on more than one host require a sector identifier")
+	}
+	if err := validateLogoutURI(client.BackchannelLogoutURI); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid backchannel logout URI %q: %s", client.BackchannelLogoutURI, err.Error()))
+	}
+	if err := validateLogoutURI(client.FrontchannelLogoutURI); err != nil {
+		validationErrors = append(validationErrors, fmt.Sprintf("invalid frontchannel logout URI %q: %s", client.FrontchannelLogoutURI, err.Error()))
+	}
+	if client.AccessTokenLifetime < 0 || client.RefreshTokenLifetime < 0 {
+		validationErrors = append(validationErrors, "token lifetimes cannot be negative")
+	}
+
+	return validationErrors
+}
+
+// unsafeURISchemes are never accepted for redirect or logout URIs, as the
+// browser would run or read them locally instead of navigating to the client.
+var unsafeURISchemes = []string{"javascript", "data", "vbscript", "file"}
+
+// validateRedirectURI checks a redirect URI is absolute and has no fragment,
+// as required by RFC 6749 section 3.1.2. Following RFC 8252, it must use
+// https, http on a loopback address, or a private-use scheme named after a
+// domain the client controls in reverse order, such as com.example.app.
+func validateRedirectURI(redirectURI string) error {
+	return validateClientURI(redirectURI, true)
+}
+
+// validateLogoutURI checks an optional logout URI, which has the same rules
+// as a redirect URI, except that it cannot use a private-use scheme as it is
+// requested by the service or loaded in a frame.
+func validateLogoutURI(logoutURI string) error {
+	if logoutURI == "" {
+		return nil
+	}
+
+	return validateClientURI(logoutURI, false)
+}
+
+func validateClientURI(clientURI string, allowPrivateUseScheme bool) error {
+	u, err := url.Parse(clientURI)
+	if err != nil {
+		return fmt.Errorf("not a valid URL")
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("must be an absolute URL")
+	}
+	if u.Fragment != "" || strings.Contains(clientURI, "#") {
+		return fmt.Errorf("must not contain a fragment")
+	}
+	if strings.ContainsAny(clientURI, " \t\n") {
+		return fmt.Errorf("must not contain whitespace")
+	}
+
+	switch {
+	case ContainsString(unsafeURISchemes, u.Scheme):
+		return fmt.Errorf("scheme %s is not allowed", u.Scheme)
+	case u.Scheme == "https":
+		if u.Hostname() == "" {
+			return fmt.Errorf("must have a host")
+		}
+	case u.Scheme == "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return fmt.Errorf("http is only allowed on loopback addresses, use https")
+		}
+	case allowPrivateUseScheme && strings.Contains(u.Scheme, "."):
+		// private-use schemes of native apps, see RFC 8252 section 7.1
+	default:
+		return fmt.Errorf("scheme %s is not allowed", u.Scheme)
+	}
+
+	return nil
+}
+
+// isLoopbackHost reports whether the host is localhost or a loopback
+// address, which native apps listen on for redirects.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ContainsString reports whether the value is one of the values.
+func ContainsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Consent records the scopes a user has allowed a client to access.
+type Consent struct {
+	UserID     int       `json:"-"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scope      string    `json:"scope"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Covers reports whether the user already consented to every scope in the
+// space separated scope string.
+func (consent Consent) Covers(scope string) bool {
+	return ScopeCovers(consent.Scope, scope)
+}
+
+// MergeScopes returns the union of two space separated scope strings,
+// keeping the order scopes were first granted in.
+func MergeScopes(scope string, additional string) string {
+	merged := strings.Fields(scope)
+	for _, s := range strings.Fields(additional) {
+		if !ScopeIncludes(scope, s) {
+			merged = append(merged, s)
+		}
+	}
+
+	return strings.Join(merged, " ")
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithms passkeys can be registered with, see RFC 9053.
+const (
+	COSEAlgorithmES256 = -7
+	COSEAlgorithmEdDSA = -8
+	COSEAlgorithmRS256 = -257
+)
+
+// COSE key parameters, see RFC 9052 section 7 and RFC 9053 section 7.
+const (
+	coseKeyType      = 1
+	coseKeyAlgorithm = 3
+	coseKeyCurve     = -1 // EC2 and OKP keys
+	coseKeyX         = -2
+	coseKeyY         = -3
+	coseKeyModulus   = -1 // RSA keys
+	coseKeyExponent  = -2
+
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveEd25519 = 6
+)
+
+// COSEKey is a public key a passkey signs with.
+type COSEKey struct {
+	Algorithm int
+	PublicKey crypto.PublicKey
+}
+
+// ParseCOSEKey parses a COSE encoded public key of one of the supported
+// algorithms.
+func ParseCOSEKey(data []byte) (COSEKey, error) {
+	var params map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(data, &params); err != nil {
+		return COSEKey{}, fmt.Errorf("invalid COSE key: %w", err)
+	}
+
+	var keyType, algorithm int
+	if err := unmarshalCOSEParam(params, coseKeyType, &keyType); err != nil {
+		return COSEKey{}, err
+	}
+	if err := unmarshalCOSEParam(params, coseKeyAlgorithm, &algorithm); err != nil {
+		return COSEKey{}, err
+	}
+
+	switch {
+	case keyType == coseKeyTypeEC2 && algorithm == COSEAlgorithmES256:
+		var curve int
+		var x, y []byte
+		if err := unmarshalCOSEParams(params, map[int]interface{}{coseKeyCurve: &curve, coseKeyX: &x, coseKeyY: &y}); err != nil {
+			return COSEKey{}, err
+		}
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return COSEKey{}, fmt.Errorf("ES256 keys must be on the P-256 curve")
+		}
+
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return COSEKey{}, fmt.Errorf("ES256 key is not on the P-256 curve")
+		}
+		return COSEKey{Algorithm: algorithm, PublicKey: publicKey}, nil
+
+	case keyType == coseKeyTypeOKP && algorithm == COSEAlgorithmEdDSA:
+		var curve int
+		var x []byte
+		if err := unmarshalCOSEParams(params, map[int]interface{}{coseKeyCurve: &curve, coseKeyX: &x}); err != nil {
+			return COSEKey{}, err
+		}
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return COSEKey{}, fmt.Errorf("EdDSA keys must be Ed25519 keys")
+		}
+		return COSEKey{Algorithm: algorithm, PublicKey: ed25519.PublicKey(x)}, nil
+
+	case keyType == coseKeyTypeRSA && algorithm == COSEAlgorithmRS256:
+		var modulus, exponent []byte
+		if err := unmarshalCOSEParams(params, map[int]interface{}{coseKeyModulus: &modulus, coseKeyExponent: &exponent}); err != nil {
+			return COSEKey{}, err
+		}
+		e := new(big.Int).SetBytes(exponent)
+		if len(modulus) < 256 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return COSEKey{}, fmt.Errorf("RS256 keys must have a modulus of at least 2048 bits")
+		}
+		return COSEKey{Algorithm: algorithm, PublicKey: &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(e.Int64())}}, nil
+	}
+
+	return COSEKey{}, fmt.Errorf("unsupported COSE key type %d with algorithm %d", keyType, algorithm)
+}
+
+// Verify checks a signature made with the key over data.
+func (key COSEKey) Verify(data []byte, signature []byte) error {
+	var valid bool
+	switch publicKey := key.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		valid = ecdsa.VerifyASN1(publicKey, digest[:], signature)
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(publicKey, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func unmarshalCOSEParams(params map[int]cbor.RawMessage, values map[int]interface{}) error {
+	for label, value := range values {
+		if err := unmarshalCOSEParam(params, label, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmarshalCOSEParam(params map[int]cbor.RawMessage, label int, value interface{}) error {
+	raw, ok := params[label]
+	if !ok {
+		return fmt.Errorf("COSE key is missing parameter %d", label)
+	}
+	if err := cbor.Unmarshal(raw, value); err != nil {
+		return fmt.Errorf("invalid COSE key parameter %d: %w", label, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+const DeviceCodeLifetime = time.Minute * 10
+
+// DevicePollInterval is the minimum number of seconds a device waits between
+// token requests, raised by 5 seconds each time it polls too fast.
+const DevicePollInterval = 5
+
+type DeviceAuthorizationStatus string
+
+const (
+	DeviceAuthorizationPending  DeviceAuthorizationStatus = "pending"
+	DeviceAuthorizationApproved DeviceAuthorizationStatus = "approved"
+	DeviceAuthorizationDenied   DeviceAuthorizationStatus = "denied"
+)
+
+// DeviceAuthorization is a pending RFC 8628 device authorization request. The
+// device polls with its device code while the user approves the request on
+// another device by entering the user code.
+type DeviceAuthorization struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	UserID         int
+	Status         DeviceAuthorizationStatus
+	PollInterval   int
+	LastPolledAt   time.Time
+	ExpiresAt      time.Time
+}
+
+// NormalizeUserCode removes the formatting users might type along with a
+// user code, so "bcdf-ghjk" and "BCDF GHJK" both match "BCDFGHJK".
+func NormalizeUserCode(userCode string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, userCode))
+}
+
+// FormatUserCode splits a normalized user code in two halves for display.
+func FormatUserCode(userCode string) string {
+	if len(userCode) < 2 {
+		return userCode
+	}
+
+	return userCode[:len(userCode)/2] + "-" + userCode[len(userCode)/2:]
+}
@@ -3,5 +3,7 @@ package models
 import "database/sql"
 
 type Env struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Denylist TokenDenylist
+	Mailer   Mailer
 }
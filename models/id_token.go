@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const IDTokenLifetime = time.Minute * 10
+
+// IDTokenClaims are the claims of an OpenID Connect ID token, which tells a
+// client who signed in. Unlike access tokens they are not accepted by the
+// auth middlewares, as they carry no token_use claim.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	SessionID     string `json:"sid,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// UserInfo holds the claims about a user released for the granted scopes,
+// shared by ID tokens and the userinfo endpoint.
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// NewUserInfo returns the claims about the user a client may see with the
+// scope it was granted, under the subject identifying the user to that
+// client. The email claims need the email scope.
+func NewUserInfo(subject string, user User, scope string) UserInfo {
+	info := UserInfo{Subject: subject}
+	if ScopeIncludes(scope, "email") {
+		emailVerified := user.EmailVerified
+		info.Email = user.Email
+		info.EmailVerified = &emailVerified
+	}
+
+	return info
+}
+
+// NewIDTokenClaims returns the claims of an ID token for the client. The sid
+// claim is the browser session the user signed in with, which logout tokens
+// refer to when that session ends.
+func NewIDTokenClaims(info UserInfo, clientID string, nonce string, authTime time.Time, sessionID string) IDTokenClaims {
+	return IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   info.Subject,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(IDTokenLifetime)),
+		},
+		Nonce:         nonce,
+		AuthTime:      authTime.Unix(),
+		SessionID:     sessionID,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+	}
+}
+
+// MintIDToken signs the ID token claims with the active key, stamping the
+// issuer and issued-at time.
+func MintIDToken(claims IDTokenClaims) (string, error) {
+	claims.Issuer = TokenIssuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	return signClaims(claims)
+}
@@ -0,0 +1,18 @@
+package models
+
+// TokenIntrospection describes a token to the client that introspects it, see
+// RFC 7662 section 2.2. Inactive tokens are only described as such.
+type TokenIntrospection struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
+	Aud       []string    `json:"aud,omitempty"`
+	Act       *ActorClaim `json:"act,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Exp       int64       `json:"exp,omitempty"`
+	Iat       int64       `json:"iat,omitempty"`
+	Sub       string      `json:"sub,omitempty"`
+	Iss       string      `json:"iss,omitempty"`
+	Jti       string      `json:"jti,omitempty"`
+	Roles     []Roles     `json:"roles,omitempty"`
+}
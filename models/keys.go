@@ -0,0 +1,382 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// SigningKey pairs a JWT signing method with the key material used for it.
+// PrivateKey is nil for verify-only keys, e.g. retired keys or a downstream
+// service that is only given our public key.
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+// KeyRing holds the active signing key and any retired keys that are still
+// accepted when validating tokens, so outstanding tokens survive a rotation.
+type KeyRing struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	keyRingMu sync.RWMutex
+	keyRing   *KeyRing
+)
+
+// LoadSigningKeys configures the keys used by MintToken and ValidateToken from
+// the environment.
+//
+// JWT_AUTH_SERVICE_SIGNING_KEYS_DIR points at a directory of PEM files named
+// <kid>.pem. The key named by JWT_AUTH_SERVICE_ACTIVE_KEY_ID signs new tokens
+// and every other key in the directory is only used for verification. To
+// rotate, add a new key, point the active key ID at it and remove the old file
+// once the longest lived token it signed has expired.
+//
+// JWT_AUTH_SERVICE_SIGNING_KEY_PATH points at a single PEM encoded private key
+// and JWT_AUTH_SERVICE_VERIFICATION_KEY_PATH at a single public key for
+// verify-only instances. If nothing is set, tokens are signed with HS256 and
+// JWT_AUTH_SERVICE_SECRET_KEY.
+func LoadSigningKeys() error {
+	if dir := os.Getenv("JWT_AUTH_SERVICE_SIGNING_KEYS_DIR"); dir != "" {
+		ring, err := LoadKeyRingFromDir(dir, os.Getenv("JWT_AUTH_SERVICE_ACTIVE_KEY_ID"))
+		if err != nil {
+			return err
+		}
+		SetKeyRing(ring)
+		return nil
+	}
+
+	if path := os.Getenv("JWT_AUTH_SERVICE_SIGNING_KEY_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read signing key: %w", err)
+		}
+		key, err := ParseSigningKeyPEM(data)
+		if err != nil {
+			return err
+		}
+		SetSigningKey(key)
+		return nil
+	}
+
+	if path := os.Getenv("JWT_AUTH_SERVICE_VERIFICATION_KEY_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read verification key: %w", err)
+		}
+		key, err := ParseVerificationKeyPEM(data)
+		if err != nil {
+			return err
+		}
+		SetSigningKey(key)
+		return nil
+	}
+
+	SetKeyRing(nil)
+	return nil
+}
+
+// LoadKeyRingFromDir loads every <kid>.pem file in dir. Private keys and public
+// keys are both accepted; only the key named activeKeyID is used for signing.
+// With an empty activeKeyID the ring is verify-only.
+func LoadKeyRingFromDir(dir string, activeKeyID string) (*KeyRing, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	var active *SigningKey
+	var verifying []*SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %s: %w", path, err)
+		}
+
+		key, err := ParseSigningKeyPEM(data)
+		if err != nil {
+			key, err = ParseVerificationKeyPEM(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key %s: %w", path, err)
+		}
+		key.ID = strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		if key.ID == activeKeyID {
+			active = key
+		} else {
+			verifying = append(verifying, key)
+		}
+	}
+
+	if activeKeyID != "" {
+		if active == nil {
+			return nil, fmt.Errorf("active key %s not found in %s", activeKeyID, dir)
+		}
+		if active.PrivateKey == nil {
+			return nil, fmt.Errorf("active key %s is not a private key", activeKeyID)
+		}
+	}
+
+	return NewKeyRing(active, verifying...), nil
+}
+
+// NewKeyRing builds a key ring that signs with active and verifies with active
+// and every retired key. active may be nil for a verify-only ring.
+func NewKeyRing(active *SigningKey, retired ...*SigningKey) *KeyRing {
+	ring := &KeyRing{active: active, keys: make(map[string]*SigningKey)}
+	for _, key := range retired {
+		ring.keys[key.ID] = &SigningKey{ID: key.ID, Method: key.Method, PublicKey: key.PublicKey}
+	}
+	if active != nil {
+		ring.keys[active.ID] = active
+	}
+
+	return ring
+}
+
+// SetKeyRing replaces the keys used to mint and validate tokens. A nil ring
+// restores the HS256 shared secret behaviour.
+func SetKeyRing(ring *KeyRing) {
+	keyRingMu.Lock()
+	defer keyRingMu.Unlock()
+	keyRing = ring
+}
+
+// SetSigningKey replaces the keys used to mint and validate tokens with a
+// single key. Keys without an ID are given their RFC 7638 thumbprint.
+func SetSigningKey(key *SigningKey) {
+	if key == nil {
+		SetKeyRing(nil)
+		return
+	}
+	if key.ID == "" {
+		key.ID = key.Thumbprint()
+	}
+
+	if key.PrivateKey == nil {
+		SetKeyRing(NewKeyRing(nil, key))
+		return
+	}
+	SetKeyRing(NewKeyRing(key))
+}
+
+// CurrentKeyRing returns the keys used to mint and validate tokens.
+func CurrentKeyRing() *KeyRing {
+	keyRingMu.RLock()
+	defer keyRingMu.RUnlock()
+	if keyRing != nil {
+		return keyRing
+	}
+
+	return NewKeyRing(NewHMACSigningKey([]byte(os.Getenv("JWT_AUTH_SERVICE_SECRET_KEY"))))
+}
+
+func NewHMACSigningKey(secret []byte) *SigningKey {
+	return &SigningKey{Method: jwt.SigningMethodHS256, PrivateKey: secret, PublicKey: secret}
+}
+
+// Active returns the key new tokens are signed with, or nil for a verify-only ring.
+func (ring *KeyRing) Active() *SigningKey {
+	return ring.active
+}
+
+// Lookup returns the key a token with the given kid header was signed with.
+// Tokens without a kid are checked against the active key.
+func (ring *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		if ring.active == nil {
+			return nil, false
+		}
+		return ring.active, true
+	}
+
+	key, ok := ring.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public half of every asymmetric key in the ring. Shared
+// secrets are never published.
+func (ring *KeyRing) JWKS() JSONWebKeySet {
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ring.keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+
+	return jwks
+}
+
+// JWK returns the public key as a JSON Web Key, or false for HMAC keys.
+func (key *SigningKey) JWK() (JSONWebKey, bool) {
+	jwk := JSONWebKey{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+	switch k := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	default:
+		return JSONWebKey{}, false
+	}
+
+	return jwk, true
+}
+
+// Thumbprint returns the RFC 7638 JWK thumbprint of the public key, which is
+// used as the key ID when none is configured.
+func (key *SigningKey) Thumbprint() string {
+	jwk, ok := key.JWK()
+	if !ok {
+		return ""
+	}
+
+	// RFC 7638 requires the required members only, in lexicographic order
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseSigningKeyPEM parses a PKCS#1, SEC 1 or PKCS#8 private key and picks the
+// signing method from the key type: RS256 for RSA, ES256 for P-256 and EdDSA
+// for Ed25519.
+func ParseSigningKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in signing key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing key PEM type %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse signing key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA signing keys must be at least 2048 bits")
+		}
+		return &SigningKey{Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only P-256 ECDSA signing keys are supported")
+		}
+		return &SigningKey{Method: jwt.SigningMethodES256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{Method: jwt.SigningMethodEdDSA, PrivateKey: k, PublicKey: k.Public().(ed25519.PublicKey)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// ParseVerificationKeyPEM parses a PKIX public key into a verify-only SigningKey.
+func ParseVerificationKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in verification key")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported verification key PEM type %s", block.Type)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse verification key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &SigningKey{Method: jwt.SigningMethodRS256, PublicKey: k}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only P-256 ECDSA verification keys are supported")
+		}
+		return &SigningKey{Method: jwt.SigningMethodES256, PublicKey: k}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{Method: jwt.SigningMethodEdDSA, PublicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported verification key type %T", key)
+	}
+}
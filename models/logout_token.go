@@ -0,0 +1,56 @@
+package models
+
+import (
+	"jwt-auth-service/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// BackchannelLogoutEvent identifies logout tokens in their events claim, see
+// OpenID Connect Back-Channel Logout 1.0 section 2.4.
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+const LogoutTokenLifetime = time.Minute * 2
+
+// LogoutTokenClaims are the claims of a logout token, which tells a client
+// that a user's session has ended. They carry no nonce or token_use claim, so
+// they cannot be mistaken for ID or access tokens.
+type LogoutTokenClaims struct {
+	jwt.RegisteredClaims
+	SessionID string              `json:"sid,omitempty"`
+	Events    map[string]struct{} `json:"events"`
+}
+
+// NewLogoutTokenClaims returns the claims of a logout token for a client
+// session that has ended, naming the user by the subject their tokens for the
+// client carried. The sid claim is the browser session the client's
+// ID tokens named, so sessions that were not authorized from a browser
+// session, such as device sessions, are identified by the user alone.
+func NewLogoutTokenClaims(clientID string, subject string, session Session) LogoutTokenClaims {
+	return LogoutTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(LogoutTokenLifetime)),
+		},
+		SessionID: session.ParentSessionID,
+		Events:    map[string]struct{}{BackchannelLogoutEvent: {}},
+	}
+}
+
+// MintLogoutToken signs the logout token claims with the active key,
+// stamping the issuer, issued-at time and a unique token ID that lets the
+// client detect replays.
+func MintLogoutToken(claims LogoutTokenClaims) (string, error) {
+	claims.Issuer = TokenIssuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	jti, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	claims.ID = jti
+
+	return signTypedClaims(claims, "logout+jwt")
+}
@@ -0,0 +1,8 @@
+package models
+
+import "jwt-auth-service/utils"
+
+// Mailer sends emails to users, such as the links that verify their address.
+type Mailer interface {
+	SendMail(utils.Email) error
+}
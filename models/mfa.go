@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"jwt-auth-service/utils"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Authentication methods a session was signed in with, as listed in the amr
+// claim of its tokens, see RFC 8176.
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+	AuthMethodMFA      = "mfa"
+)
+
+// MFAChallengeLifetime is how long a user has to enter their code after
+// signing in with their password.
+const MFAChallengeLifetime = time.Minute * 5
+
+// RecoveryCodeCount is how many recovery codes a user is given at a time.
+const RecoveryCodeCount = 10
+
+// MaxFailedMFAAttempts is how many wrong codes a user can enter in a row
+// before they are locked out for MFALockoutDuration, which keeps the codes
+// from being guessed.
+const (
+	MaxFailedMFAAttempts = 5
+	MFALockoutDuration   = time.Minute * 15
+)
+
+const mfaChallengeTokenType = "mfa-challenge+jwt"
+
+// TOTPEnrollment is a user's TOTP authenticator. Secret is encrypted, see
+// utils.EncryptSecret, and the authenticator only counts as a second factor
+// once the user has confirmed it with a code.
+type TOTPEnrollment struct {
+	UserID         int
+	Secret         string
+	Confirmed      bool
+	LastUsedStep   int64 // the period of the last code accepted, so codes cannot be used twice
+	FailedAttempts int   // wrong codes entered since the last accepted one
+	LockedUntil    time.Time
+	CreatedAt      time.Time
+}
+
+// IsLocked reports whether the user entered too many wrong codes to be let
+// try another one yet.
+func (enrollment TOTPEnrollment) IsLocked() bool {
+	return time.Now().Before(enrollment.LockedUntil)
+}
+
+// TOTPKeyURI returns the otpauth:// URI authenticator apps are set up with,
+// usually by scanning it as a QR code.
+func TOTPKeyURI(accountName string, encodedSecret string, digits int, period time.Duration) string {
+	params := url.Values{}
+	params.Set("secret", encodedSecret)
+	params.Set("issuer", defaultIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", strconv.Itoa(digits))
+	params.Set("period", strconv.Itoa(int(period.Seconds())))
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + defaultIssuer + ":" + accountName, RawQuery: params.Encode()}
+	return u.String()
+}
+
+// MFAChallengeClaims are the claims of the token a user is given after
+// signing in with their password, which is exchanged for tokens along with
+// their second factor.
+type MFAChallengeClaims struct {
+	jwt.RegisteredClaims
+	DeviceLabel string `json:"device_label,omitempty"`
+}
+
+func NewMFAChallengeClaims(user User, deviceLabel string) MFAChallengeClaims {
+	return MFAChallengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.PublicID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFAChallengeLifetime)),
+		},
+		DeviceLabel: deviceLabel,
+	}
+}
+
+// MintMFAChallengeToken signs the challenge claims with the active key. The
+// typ header keeps it from being accepted as an access token.
+func MintMFAChallengeToken(claims MFAChallengeClaims) (string, error) {
+	claims.Issuer = TokenIssuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	jti, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+	claims.ID = jti
+
+	return signTypedClaims(claims, mfaChallengeTokenType)
+}
+
+// ValidateMFAChallengeToken checks the signature, expiry, issuer and type of
+// an MFA challenge token.
+func ValidateMFAChallengeToken(tokenStr string) (MFAChallengeClaims, error) {
+	claims := MFAChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, keyForToken)
+	if err != nil {
+		return claims, err
+	}
+	if token.Header["typ"] != mfaChallengeTokenType || claims.Issuer != TokenIssuer() {
+		return claims, fmt.Errorf("not an MFA challenge token")
+	}
+
+	return claims, nil
+}
+
+// UsedMFA reports whether the token was issued to a session signed in with a
+// second factor.
+func (claims TokenClaims) UsedMFA() bool {
+	for _, method := range claims.AuthMethods {
+		if method == AuthMethodMFA {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,37 @@
+package models
+
+import "strings"
+
+// TokenTypeAccessToken identifies access tokens in RFC 8693 token exchange.
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// OAuthErrorResponse is the error body defined by RFC 6749 section 5.2, used by
+// the OAuth endpoints instead of ErrorResponse.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// ScopeIncludes reports whether the space separated scope string contains
+// the given scope.
+func ScopeIncludes(scope string, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ScopeCovers reports whether every scope in the space separated requested
+// scope string is also in the granted one.
+func ScopeCovers(granted string, requested string) bool {
+	for _, s := range strings.Fields(requested) {
+		if !ScopeIncludes(granted, s) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const PasswordResetTokenLifetime = time.Minute * 30
+
+// PasswordResetResendInterval is how long a user has to wait before another
+// password reset email is sent to them.
+const PasswordResetResendInterval = time.Minute * 2
+
+// PasswordResetToken lets the holder of an emailed link choose a new
+// password. Only the hash of the token is stored.
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
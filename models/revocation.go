@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// TokenDenylist records the IDs of revoked access tokens. Entries only need
+// to be kept until the token would have expired anyway.
+type TokenDenylist interface {
+	RevokeToken(jti string, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID               string    `json:"id"`
+	UserID           int       `json:"user_id"`
+	ClientID         string    `json:"client_id,omitempty"`
+	Scope            string    `json:"scope,omitempty"`
+	ParentSessionID  string    `json:"parent_session_id,omitempty"` // the browser session a client session was authorized from
+	DeviceLabel      string    `json:"device_label"`
+	UserAgent        string    `json:"user_agent"`
+	IPAddress        string    `json:"ip_address"`
+	AuthMethods      []string  `json:"amr,omitempty"` // how the user signed in, see AuthMethodPassword
+	RefreshTokenHash string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastUsedAt       time.Time `json:"last_used_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
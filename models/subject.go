@@ -0,0 +1,111 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Subject types a client can be registered with, see OpenID Connect Core 1.0
+// section 8. Public subjects are the same for every client, pairwise subjects
+// differ between clients of different sectors so they cannot correlate users.
+const (
+	SubjectTypePublic   = "public"
+	SubjectTypePairwise = "pairwise"
+)
+
+var supportedSubjectTypes = []string{SubjectTypePublic, SubjectTypePairwise}
+
+// PairwiseSubject returns the sub claim identifying the user to clients of
+// the sector. It is a keyed hash of both, keyed by
+// JWT_AUTH_SERVICE_PAIRWISE_SECRET, or JWT_AUTH_SERVICE_SECRET_KEY when that
+// is not set. Changing the key changes every pairwise subject.
+func PairwiseSubject(userID int, sectorIdentifier string) (string, error) {
+	key := os.Getenv("JWT_AUTH_SERVICE_PAIRWISE_SECRET")
+	if key == "" {
+		key = os.Getenv("JWT_AUTH_SERVICE_SECRET_KEY")
+	}
+	if key == "" {
+		return "", fmt.Errorf("no key configured for pairwise subjects")
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(sectorIdentifier + "\x00" + strconv.Itoa(userID)))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// LegacySubjectUserID returns the user ID that tokens minted before public
+// IDs were introduced carry as their subject, so users signed in back then
+// are not signed out by the upgrade. It only accepts tokens issued before
+// JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE, the RFC 3339 time public IDs were
+// deployed, and none once it is unset. Public IDs and pairwise subjects are
+// too long to be read as one.
+func LegacySubjectUserID(subject string, issuedAt time.Time) (int, bool) {
+	cutoff, err := time.Parse(time.RFC3339, os.Getenv("JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE"))
+	if err != nil || issuedAt.IsZero() || !issuedAt.Before(cutoff) {
+		return 0, false
+	}
+
+	userID, err := strconv.Atoi(subject)
+	if err != nil || userID <= 0 || strconv.Itoa(userID) != subject {
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// IsPairwise reports whether the client is issued pairwise subjects.
+func (client Client) IsPairwise() bool {
+	return client.SubjectType == SubjectTypePairwise
+}
+
+// Sector returns what pairwise subjects are computed for, so clients of the
+// same sector see the same subjects. It is the client's sector identifier if
+// an admin set one, otherwise the host of its redirect URIs, and the client
+// itself when those do not share one host. Clients that registered
+// themselves are always a sector of their own, as anyone can register a
+// redirect URI on a host to see the subjects of its clients.
+func (client Client) Sector() string {
+	if client.SectorIdentifier != "" {
+		return client.SectorIdentifier
+	}
+	if client.IsSelfRegistered() {
+		return client.ID
+	}
+	if hosts := client.redirectURIHosts(); len(hosts) == 1 {
+		return hosts[0]
+	}
+
+	return client.ID
+}
+
+// SubjectFor returns the sub claim identifying the user to the client.
+func (client Client) SubjectFor(user User) (string, error) {
+	if client.IsPairwise() {
+		return PairwiseSubject(user.ID, client.Sector())
+	}
+	if user.PublicID == "" {
+		return "", fmt.Errorf("user %d has no public ID", user.ID)
+	}
+
+	return user.PublicID, nil
+}
+
+func (client Client) redirectURIHosts() []string {
+	var hosts []string
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Host == "" || ContainsString(hosts, u.Hostname()) {
+			continue
+		}
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return hosts
+}
@@ -1,50 +1,197 @@
 package models
 
 import (
+	"fmt"
+	"jwt-auth-service/utils"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
+const AccessTokenLifetime = time.Minute * 30
+
+const defaultIssuer = "jwt-auth-service"
+
+type TokenType string
+
+const (
+	AccessToken TokenType = "access"
+)
+
+// SubjectType tells what kind of principal the sub claim identifies.
+type SubjectType string
+
+const (
+	UserSubject   SubjectType = "user"
+	ClientSubject SubjectType = "client"
+)
+
+// ActorClaim is the RFC 8693 act claim, naming the party acting on behalf of
+// the token's subject. Each further exchange nests the previous actor.
+type ActorClaim struct {
+	Subject string      `json:"sub"`
+	Actor   *ActorClaim `json:"act,omitempty"`
+}
+
 type ClientReadableToken struct {
 	ExpiresAt int64   `json:"expires_at"`
 	UserRoles []Roles `json:"roles"`
 }
 type TokenClaims struct {
 	jwt.RegisteredClaims
-	UserRoles []Roles `json:"roles"`
+	UserRoles    []Roles     `json:"roles,omitempty"`
+	TokenType    TokenType   `json:"token_use,omitempty"`
+	SubjectType  SubjectType `json:"sub_type,omitempty"`
+	SessionID    string      `json:"sid,omitempty"`
+	TokenVersion int         `json:"ver,omitempty"`
+	ClientID     string      `json:"client_id,omitempty"`
+	Scope        string      `json:"scope,omitempty"`
+	Actor        *ActorClaim `json:"act,omitempty"`
+	AuthMethods  []string    `json:"amr,omitempty"`
+	userID       int
+}
+
+type TokenPair struct {
+	SessionID             string
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+func NewAccessTokenClaims(user User, session Session, expires time.Time) TokenClaims {
+	return TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.PublicID,
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		UserRoles:    user.UserRoles,
+		TokenType:    AccessToken,
+		SubjectType:  UserSubject,
+		SessionID:    session.ID,
+		TokenVersion: user.TokenVersion,
+		ClientID:     session.ClientID,
+		Scope:        session.Scope,
+		AuthMethods:  session.AuthMethods,
+	}
 }
 
-func MintToken(userid int, userroles []Roles, expires time.Time) (string, error) {
-	claims := TokenClaims{
-		jwt.RegisteredClaims{
-			Issuer:    "jwt-auth-service",
-			Subject:   strconv.Itoa(userid),
+// NewClientAccessTokenClaims returns the claims of a token a client obtains
+// for itself, whose subject is the client and whose scopes take the place of
+// user roles.
+func NewClientAccessTokenClaims(client Client, scope string, expires time.Time) TokenClaims {
+	return TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   client.ID,
 			ExpiresAt: jwt.NewNumericDate(expires),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
-		userroles,
+		TokenType:   AccessToken,
+		SubjectType: ClientSubject,
+		ClientID:    client.ID,
+		Scope:       scope,
+	}
+}
+
+// MintToken signs the claims with the active key, stamping the issuer,
+// issued-at time and a unique token ID that can be used to revoke it.
+func MintToken(claims TokenClaims) (string, error) {
+	claims.Issuer = TokenIssuer()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	if claims.ID == "" {
+		jti, err := utils.GenerateRandomString(16)
+		if err != nil {
+			return "", err
+		}
+		claims.ID = jti
+	}
+
+	return signClaims(claims)
+}
+
+// TokenIssuer returns the iss claim of issued tokens. OpenID Connect requires
+// it to be the URL the discovery document is served under, so it is
+// JWT_AUTH_SERVICE_BASE_URL when that is set.
+func TokenIssuer() string {
+	if baseURL := os.Getenv("JWT_AUTH_SERVICE_BASE_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"iss":   claims.Issuer,
-		"sub":   claims.Subject,
-		"exp":   claims.ExpiresAt,
-		"iat":   claims.IssuedAt,
-		"roles": claims.UserRoles,
-	})
+	return defaultIssuer
+}
+
+func signClaims(claims jwt.Claims) (string, error) {
+	return signTypedClaims(claims, "")
+}
+
+// signTypedClaims signs the claims with the active key, setting the typ
+// header for tokens that must not be mistaken for other JWTs.
+func signTypedClaims(claims jwt.Claims, tokenType string) (string, error) {
+	key := CurrentKeyRing().Active()
+	if key == nil || key.PrivateKey == nil {
+		return "", fmt.Errorf("no private key configured for signing tokens")
+	}
 
-	return token.SignedString([]byte(os.Getenv("JWT_AUTH_SERVICE_SECRET_KEY")))
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	if tokenType != "" {
+		token.Header["typ"] = tokenType
+	}
 
+	return token.SignedString(key.PrivateKey)
 }
 
 func ValidateToken(tokenStr string) (*jwt.Token, TokenClaims, error) {
 	claims := TokenClaims{}
-	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_AUTH_SERVICE_SECRET_KEY")), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, keyForToken)
 
 	return token, claims, err
 }
+
+// keyForToken returns the key that verifies the token, found by its kid
+// header in the current key ring.
+func keyForToken(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := CurrentKeyRing().Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return key.PublicKey, nil
+}
+
+// IsClientSubject reports whether the token was issued to a client acting on
+// its own behalf rather than to a user.
+func (claims TokenClaims) IsClientSubject() bool {
+	return claims.SubjectType == ClientSubject
+}
+
+func (claims TokenClaims) HasScope(scope string) bool {
+	return ScopeIncludes(claims.Scope, scope)
+}
+
+// UserID returns the ID of the user the token was issued to. Subjects are
+// opaque, so the ID is only known once validating the token has resolved the
+// subject, see SetUserID. Tokens minted before subject types were introduced
+// have no sub_type and are user tokens.
+func (claims TokenClaims) UserID() (int, error) {
+	if claims.IsClientSubject() {
+		return 0, fmt.Errorf("token subject is a client, not a user")
+	}
+	if claims.userID == 0 {
+		return 0, fmt.Errorf("token subject has not been resolved to a user")
+	}
+
+	return claims.userID, nil
+}
+
+// SetUserID records the user the token's subject was resolved to.
+func (claims *TokenClaims) SetUserID(userID int) {
+	claims.userID = userID
+}
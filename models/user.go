@@ -7,10 +7,13 @@ import (
 )
 
 type User struct {
-	ID        int     `json:"id"`
-	Email     string  `json:"email"`
-	Password  string  `json:"password"`
-	UserRoles []Roles `json:"roles"`
+	ID            int     `json:"id"`
+	PublicID      string  `json:"-"` // the subject of the user's tokens, see Client.SubjectFor
+	Email         string  `json:"email"`
+	Password      string  `json:"password"`
+	UserRoles     []Roles `json:"roles"`
+	TokenVersion  int     `json:"-"`
+	EmailVerified bool    `json:"-"`
 }
 
 func (u User) Validate() []string {
@@ -26,9 +29,27 @@ func (u User) Validate() []string {
 			validationErrors = append(validationErrors, fmt.Sprintf("invalid email: %s", errStr))
 		}
 	}
-	if len(strings.Trim(u.Password, " ")) == 0 {
-		validationErrors = append(validationErrors, fmt.Sprintf(missingRequiredFieldMsg, "password"))
-	}
+	validationErrors = append(validationErrors, ValidatePassword(u.Password)...)
 
 	return validationErrors
 }
+
+// ValidatePassword checks a password a user chose, when registering or
+// changing their password.
+func ValidatePassword(password string) []string {
+	if len(strings.Trim(password, " ")) == 0 {
+		return []string{"missing required field password"}
+	}
+
+	return nil
+}
+
+func (u User) HasRole(role Roles) bool {
+	for _, userRole := range u.UserRoles {
+		if userRole == role {
+			return true
+		}
+	}
+
+	return false
+}
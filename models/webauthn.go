@@ -0,0 +1,366 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// WebAuthnCeremonyLifetime is how long a user has to complete a passkey
+// registration or sign in once it has started.
+const WebAuthnCeremonyLifetime = time.Minute * 5
+
+// AuthMethodHardwareKey is the amr value of sessions signed in with a
+// passkey, proof of possession of a key held by an authenticator.
+const AuthMethodHardwareKey = "hwk"
+
+// Ceremonies a WebAuthn challenge is issued for. A passkey used to sign in on
+// its own has to verify the user, with a PIN or biometrics, while a passkey
+// used as a second factor after a password only has to be present.
+const (
+	CeremonyRegistration = "registration"
+	CeremonyLogin        = "login"
+	CeremonySecondFactor = "second-factor"
+)
+
+// flags of the authenticator data, see WebAuthn Level 2 section 6.1
+const (
+	authenticatorFlagUserPresent        = 0x01
+	authenticatorFlagUserVerified       = 0x04
+	authenticatorFlagAttestedCredential = 0x40
+)
+
+// WebAuthnCredential is a passkey registered to a user. PublicKey is the
+// COSE encoded key the authenticator signs with.
+type WebAuthnCredential struct {
+	ID         []byte
+	UserID     int
+	PublicKey  []byte
+	SignCount  uint32
+	AAGUID     []byte
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// WebAuthnChallenge is a challenge given to an authenticator, stored hashed
+// until the ceremony it was issued for completes. UserID is 0 for challenges
+// of passkey logins, where the user is not known until they pick a passkey.
+type WebAuthnChallenge struct {
+	ChallengeHash string
+	UserID        int
+	Ceremony      string
+	ExpiresAt     time.Time
+}
+
+// RelyingParty is this service as WebAuthn sees it. Passkeys are bound to its
+// ID, a domain, and only accepted from its origins.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// CurrentRelyingParty returns the relying party configured by
+// JWT_AUTH_SERVICE_WEBAUTHN_RP_ID and JWT_AUTH_SERVICE_WEBAUTHN_ORIGINS, a
+// space separated list. Both default to the host and origin of
+// JWT_AUTH_SERVICE_BASE_URL.
+func CurrentRelyingParty() (RelyingParty, error) {
+	rp := RelyingParty{
+		ID:      os.Getenv("JWT_AUTH_SERVICE_WEBAUTHN_RP_ID"),
+		Name:    defaultIssuer,
+		Origins: strings.Fields(os.Getenv("JWT_AUTH_SERVICE_WEBAUTHN_ORIGINS")),
+	}
+
+	if baseURL, err := url.Parse(os.Getenv("JWT_AUTH_SERVICE_BASE_URL")); err == nil && baseURL.Host != "" {
+		if rp.ID == "" {
+			rp.ID = baseURL.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{baseURL.Scheme + "://" + baseURL.Host}
+		}
+	}
+	if rp.ID == "" || len(rp.Origins) == 0 {
+		return rp, fmt.Errorf("JWT_AUTH_SERVICE_BASE_URL or JWT_AUTH_SERVICE_WEBAUTHN_RP_ID and JWT_AUTH_SERVICE_WEBAUTHN_ORIGINS must be set to use passkeys")
+	}
+
+	return rp, nil
+}
+
+// The options passed to navigator.credentials.create() and .get(), in the
+// JSON form of WebAuthn Level 3, where binary values are base64url encoded.
+
+type CredentialCreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+type CredentialRequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// RegistrationResponse is the credential navigator.credentials.create()
+// resolves to, as serialized by its toJSON().
+type RegistrationResponse struct {
+	ID       string                           `json:"id"`
+	RawID    string                           `json:"rawId"`
+	Type     string                           `json:"type"`
+	Response AuthenticatorAttestationResponse `json:"response"`
+}
+
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+// AssertionResponse is the credential navigator.credentials.get() resolves
+// to, as serialized by its toJSON().
+type AssertionResponse struct {
+	ID       string                         `json:"id"`
+	RawID    string                         `json:"rawId"`
+	Type     string                         `json:"type"`
+	Response AuthenticatorAssertionResponse `json:"response"`
+}
+
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// NewCredentialCreationOptions returns the options for registering a passkey
+// for the user. The user handle is their public ID, which tells nothing about
+// them, and their existing passkeys are excluded so an authenticator does
+// not register twice. Only attestation "none" is asked for, as which
+// authenticator holds the passkey does not matter to this service.
+func NewCredentialCreationOptions(rp RelyingParty, user User, challenge string, credentials []WebAuthnCredential) CredentialCreationOptions {
+	return CredentialCreationOptions{
+		RP:        RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:      UserEntity{ID: EncodeBase64URL([]byte(user.PublicID)), Name: user.Email, DisplayName: user.Email},
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Algorithm: COSEAlgorithmES256},
+			{Type: "public-key", Algorithm: COSEAlgorithmEdDSA},
+			{Type: "public-key", Algorithm: COSEAlgorithmRS256},
+		},
+		Timeout:                WebAuthnCeremonyLifetime.Milliseconds(),
+		ExcludeCredentials:     credentialDescriptors(credentials),
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "preferred", UserVerification: "preferred"},
+		Attestation:            "none",
+	}
+}
+
+// NewCredentialRequestOptions returns the options for signing in with one of
+// the given passkeys, or with any passkey of the relying party when there are
+// none, letting the user pick theirs.
+func NewCredentialRequestOptions(rp RelyingParty, challenge string, ceremony string, credentials []WebAuthnCredential) CredentialRequestOptions {
+	userVerification := "preferred"
+	if ceremony == CeremonyLogin {
+		userVerification = "required"
+	}
+
+	return CredentialRequestOptions{
+		Challenge:        challenge,
+		Timeout:          WebAuthnCeremonyLifetime.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: userVerification,
+	}
+}
+
+func credentialDescriptors(credentials []WebAuthnCredential) []CredentialDescriptor {
+	descriptors := []CredentialDescriptor{}
+	for _, credential := range credentials {
+		descriptors = append(descriptors, CredentialDescriptor{Type: "public-key", ID: EncodeBase64URL(credential.ID)})
+	}
+
+	return descriptors
+}
+
+// ClientData is the clientDataJSON the browser collects for the
+// authenticator, telling which ceremony was performed for which origin.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func ParseClientData(clientDataJSON []byte) (ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return clientData, fmt.Errorf("invalid client data: %w", err)
+	}
+
+	return clientData, nil
+}
+
+// VerifyClientData checks the client data is for the ceremony type, either
+// webauthn.create or webauthn.get, and comes from one of the relying party's
+// origins, so a passkey cannot be phished by another site.
+func (rp RelyingParty) VerifyClientData(clientData ClientData, ceremonyType string) error {
+	if clientData.Type != ceremonyType {
+		return fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+	if clientData.CrossOrigin {
+		return fmt.Errorf("cross-origin ceremonies are not accepted")
+	}
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unexpected origin %q", clientData.Origin)
+}
+
+// AuthenticatorData is the data the authenticator signs, see WebAuthn Level
+// 2 section 6.1. The credential fields are only set when registering.
+type AuthenticatorData struct {
+	RPIDHash            []byte
+	Flags               byte
+	SignCount           uint32
+	AAGUID              []byte
+	CredentialID        []byte
+	CredentialPublicKey []byte
+}
+
+func ParseAuthenticatorData(data []byte) (AuthenticatorData, error) {
+	var authData AuthenticatorData
+	if len(data) < 37 {
+		return authData, fmt.Errorf("authenticator data is too short")
+	}
+
+	authData.RPIDHash = data[:32]
+	authData.Flags = data[32]
+	authData.SignCount = binary.BigEndian.Uint32(data[33:37])
+	if authData.Flags&authenticatorFlagAttestedCredential == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authData, fmt.Errorf("attested credential data is too short")
+	}
+	authData.AAGUID = rest[:16]
+	credentialIDLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < credentialIDLength {
+		return authData, fmt.Errorf("credential ID is truncated")
+	}
+	authData.CredentialID = rest[:credentialIDLength]
+	rest = rest[credentialIDLength:]
+
+	// the key is followed by extensions, if any, so it ends where its CBOR does
+	var publicKey cbor.RawMessage
+	extensions, err := cbor.UnmarshalFirst(rest, &publicKey)
+	if err != nil {
+		return authData, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	authData.CredentialPublicKey = rest[:len(rest)-len(extensions)]
+
+	return authData, nil
+}
+
+func (authData AuthenticatorData) UserPresent() bool {
+	return authData.Flags&authenticatorFlagUserPresent != 0
+}
+
+func (authData AuthenticatorData) UserVerified() bool {
+	return authData.Flags&authenticatorFlagUserVerified != 0
+}
+
+// VerifyAuthenticatorData checks the authenticator data is for this relying
+// party and that the user was present, and verified if required.
+func (rp RelyingParty) VerifyAuthenticatorData(authData AuthenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("authenticator data is for another relying party")
+	}
+	if !authData.UserPresent() {
+		return fmt.Errorf("user was not present")
+	}
+	if requireUserVerification && !authData.UserVerified() {
+		return fmt.Errorf("user was not verified")
+	}
+
+	return nil
+}
+
+// ParseAttestationObject returns the attestation format and the
+// authenticator data of an attestation object.
+func ParseAttestationObject(attestationObject []byte) (string, []byte, error) {
+	var object struct {
+		Format    string          `cbor:"fmt"`
+		Statement cbor.RawMessage `cbor:"attStmt"`
+		AuthData  []byte          `cbor:"authData"`
+	}
+	if err := cbor.Unmarshal(attestationObject, &object); err != nil {
+		return "", nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+
+	// attestation "none" has an empty statement, see WebAuthn Level 2 section 8.7
+	if object.Format == "none" && !bytes.Equal(object.Statement, []byte{0xa0}) {
+		return "", nil, fmt.Errorf("attestation statement of format none is not empty")
+	}
+
+	return object.Format, object.AuthData, nil
+}
+
+// EncodeBase64URL encodes binary WebAuthn values the way their JSON form
+// does, as unpadded base64url.
+func EncodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64URL decodes binary WebAuthn values, accepting them padded too.
+func DecodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+)
+
+type IAuthorizationCodeRepository interface {
+	AddAuthorizationCode(models.AuthorizationCode) error
+	ConsumeAuthorizationCode(string) (models.AuthorizationCode, error)
+}
+
+var ErrAuthorizationCodeNotFound = fmt.Errorf("authorization code not found")
+
+type AuthorizationCodeRepository struct {
+	DBConn *sql.DB
+}
+
+func (repo AuthorizationCodeRepository) AddAuthorizationCode(code models.AuthorizationCode) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO OAUTH_AUTHORIZATION_CODES (CODE_HASH, CLIENT_ID, USER_ID, REDIRECT_URI, SCOPE, CODE_CHALLENGE, CODE_CHALLENGE_METHOD, NONCE, AUTH_TIME, SESSION_ID, EXPIRES_AT) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime, code.SessionID, code.ExpiresAt)
+	if err != nil {
+		log.Printf("repositories > authorization_code.go > AddAuthorizationCode > error adding code for client %s: %s\n", code.ClientID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ConsumeAuthorizationCode returns the code with the given hash and deletes it,
+// so each code can be exchanged at most once.
+func (repo AuthorizationCodeRepository) ConsumeAuthorizationCode(codeHash string) (models.AuthorizationCode, error) {
+	var code models.AuthorizationCode
+
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > authorization_code.go > ConsumeAuthorizationCode > error starting transaction: %s\n", err.Error())
+		return code, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT CODE_HASH, CLIENT_ID, USER_ID, REDIRECT_URI, SCOPE, CODE_CHALLENGE, CODE_CHALLENGE_METHOD, NONCE, AUTH_TIME, SESSION_ID, EXPIRES_AT FROM OAUTH_AUTHORIZATION_CODES WHERE CODE_HASH = ? FOR UPDATE", codeHash)
+	err = row.Scan(&code.CodeHash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope, &code.CodeChallenge, &code.CodeChallengeMethod, &code.Nonce, &code.AuthTime, &code.SessionID, &code.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return code, ErrAuthorizationCodeNotFound
+		}
+		log.Printf("repositories > authorization_code.go > ConsumeAuthorizationCode > error: %s\n", err.Error())
+		return code, err
+	}
+
+	_, err = tx.Exec("DELETE FROM OAUTH_AUTHORIZATION_CODES WHERE CODE_HASH = ?", codeHash)
+	if err != nil {
+		log.Printf("repositories > authorization_code.go > ConsumeAuthorizationCode > error deleting code: %s\n", err.Error())
+		return code, err
+	}
+
+	return code, tx.Commit()
+}
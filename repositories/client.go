@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type IClientRepository interface {
+	AddClient(models.Client) (models.Client, error)
+	GetClientByID(string) (models.Client, error)
+	GetClients() ([]models.Client, error)
+	UpdateClient(models.Client) error
+	UpdateClientSecret(string, string) error
+	DeleteClient(string) error
+}
+
+var ErrClientNotFound = fmt.Errorf("client not found")
+
+type ClientRepository struct {
+	DBConn *sql.DB
+}
+
+const clientColumns = "ID, NAME, SECRET_HASH, REDIRECT_URIS, GRANT_TYPES, SCOPES, ACCESS_TOKEN_LIFETIME, REFRESH_TOKEN_LIFETIME, FIRST_PARTY, ALLOWED_AUDIENCES, SUBJECT_TYPE, SECTOR_IDENTIFIER, BACKCHANNEL_LOGOUT_URI, FRONTCHANNEL_LOGOUT_URI, REGISTRATION_TOKEN_HASH, CREATED_AT"
+
+func (repo ClientRepository) AddClient(client models.Client) (models.Client, error) {
+	dbConn := repo.DBConn
+
+	// redirect URIs, grant types, scopes and audiences cannot contain spaces, so they are stored space separated
+	_, err := dbConn.Exec("INSERT INTO OAUTH_CLIENTS ("+clientColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		client.ID, client.Name, client.SecretHash, strings.Join(client.RedirectURIs, " "), strings.Join(client.GrantTypes, " "),
+		strings.Join(client.Scopes, " "), client.AccessTokenLifetime, client.RefreshTokenLifetime, client.FirstParty,
+		strings.Join(client.AllowedAudiences, " "), client.SubjectType, client.SectorIdentifier, client.BackchannelLogoutURI, client.FrontchannelLogoutURI,
+		client.RegistrationTokenHash, client.CreatedAt)
+	if err != nil {
+		mysqlerr, _ := err.(*mysql.MySQLError)
+		if mysqlerr != nil && mysqlerr.Number == 1062 {
+			return client, fmt.Errorf("client already exists")
+		}
+
+		log.Printf("repositories > client.go > AddClient > error: %s\n", err.Error())
+		return client, err
+	}
+
+	return client, nil
+}
+
+func (repo ClientRepository) GetClientByID(id string) (models.Client, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+clientColumns+" FROM OAUTH_CLIENTS WHERE ID = ?", id)
+
+	client, err := scanClient(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return client, ErrClientNotFound
+		}
+		log.Printf("repositories > client.go > GetClientByID > error: %s\n", err.Error())
+		return client, err
+	}
+
+	return client, nil
+}
+
+func (repo ClientRepository) GetClients() ([]models.Client, error) {
+	dbConn := repo.DBConn
+
+	rows, err := dbConn.Query("SELECT " + clientColumns + " FROM OAUTH_CLIENTS ORDER BY CREATED_AT")
+	if err != nil {
+		log.Printf("repositories > client.go > GetClients > error: %s\n", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []models.Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			log.Printf("repositories > client.go > GetClients > an error occurred when scanning db rows: %s\n", err.Error())
+			return nil, fmt.Errorf("an unexpected error occurred")
+		}
+
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// UpdateClient stores the client's metadata. The secret is left unchanged,
+// see UpdateClientSecret.
+func (repo ClientRepository) UpdateClient(client models.Client) error {
+	dbConn := repo.DBConn
+
+	// MySQL reports no affected rows when nothing changed, so a missing client is not detected here
+	_, err := dbConn.Exec("UPDATE OAUTH_CLIENTS SET NAME = ?, REDIRECT_URIS = ?, GRANT_TYPES = ?, SCOPES = ?, ACCESS_TOKEN_LIFETIME = ?, REFRESH_TOKEN_LIFETIME = ?, FIRST_PARTY = ?, ALLOWED_AUDIENCES = ?, SUBJECT_TYPE = ?, SECTOR_IDENTIFIER = ?, BACKCHANNEL_LOGOUT_URI = ?, FRONTCHANNEL_LOGOUT_URI = ? WHERE ID = ?",
+		client.Name, strings.Join(client.RedirectURIs, " "), strings.Join(client.GrantTypes, " "), strings.Join(client.Scopes, " "),
+		client.AccessTokenLifetime, client.RefreshTokenLifetime, client.FirstParty, strings.Join(client.AllowedAudiences, " "),
+		client.SubjectType, client.SectorIdentifier, client.BackchannelLogoutURI, client.FrontchannelLogoutURI, client.ID)
+	if err != nil {
+		log.Printf("repositories > client.go > UpdateClient > error updating client %s: %s\n", client.ID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo ClientRepository) UpdateClientSecret(id string, secretHash string) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE OAUTH_CLIENTS SET SECRET_HASH = ? WHERE ID = ?", secretHash, id)
+	if err != nil {
+		log.Printf("repositories > client.go > UpdateClientSecret > error updating client %s: %s\n", id, err.Error())
+		return err
+	}
+
+	return requireClientRowAffected(result)
+}
+
+func (repo ClientRepository) DeleteClient(id string) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("DELETE FROM OAUTH_CLIENTS WHERE ID = ?", id)
+	if err != nil {
+		log.Printf("repositories > client.go > DeleteClient > error deleting client %s: %s\n", id, err.Error())
+		return err
+	}
+
+	return requireClientRowAffected(result)
+}
+
+func scanClient(row rowScanner) (models.Client, error) {
+	var client models.Client
+	var redirectURIs, grantTypes, scopes, allowedAudiences string
+	err := row.Scan(&client.ID, &client.Name, &client.SecretHash, &redirectURIs, &grantTypes, &scopes,
+		&client.AccessTokenLifetime, &client.RefreshTokenLifetime, &client.FirstParty, &allowedAudiences,
+		&client.SubjectType, &client.SectorIdentifier, &client.BackchannelLogoutURI, &client.FrontchannelLogoutURI, &client.RegistrationTokenHash, &client.CreatedAt)
+
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	client.GrantTypes = strings.Fields(grantTypes)
+	client.Scopes = strings.Fields(scopes)
+	client.AllowedAudiences = strings.Fields(allowedAudiences)
+
+	return client, err
+}
+
+// requireClientRowAffected returns a not found error when an UPDATE or
+// DELETE matched no client.
+func requireClientRowAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrClientNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+)
+
+type IConsentRepository interface {
+	GetConsent(int, string) (models.Consent, error)
+	GetConsentsForUser(int) ([]models.Consent, error)
+	SaveConsent(models.Consent) error
+	DeleteConsent(int, string) error
+}
+
+var ErrConsentNotFound = fmt.Errorf("consent not found")
+
+type ConsentRepository struct {
+	DBConn *sql.DB
+}
+
+func (repo ConsentRepository) GetConsent(userID int, clientID string) (models.Consent, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT C.USER_ID, C.CLIENT_ID, O.NAME, C.SCOPE, C.CREATED_AT, C.UPDATED_AT FROM OAUTH_CONSENTS C "+
+		"INNER JOIN OAUTH_CLIENTS O ON O.ID = C.CLIENT_ID WHERE C.USER_ID = ? AND C.CLIENT_ID = ?", userID, clientID)
+
+	var consent models.Consent
+	err := row.Scan(&consent.UserID, &consent.ClientID, &consent.ClientName, &consent.Scope, &consent.CreatedAt, &consent.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return consent, ErrConsentNotFound
+		}
+		log.Printf("repositories > consent.go > GetConsent > error: %s\n", err.Error())
+		return consent, err
+	}
+
+	return consent, nil
+}
+
+func (repo ConsentRepository) GetConsentsForUser(userID int) ([]models.Consent, error) {
+	dbConn := repo.DBConn
+
+	rows, err := dbConn.Query("SELECT C.USER_ID, C.CLIENT_ID, O.NAME, C.SCOPE, C.CREATED_AT, C.UPDATED_AT FROM OAUTH_CONSENTS C "+
+		"INNER JOIN OAUTH_CLIENTS O ON O.ID = C.CLIENT_ID WHERE C.USER_ID = ? ORDER BY C.UPDATED_AT DESC", userID)
+	if err != nil {
+		log.Printf("repositories > consent.go > GetConsentsForUser > error getting consents for user ID %d: %s\n", userID, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := []models.Consent{}
+	for rows.Next() {
+		var consent models.Consent
+		err := rows.Scan(&consent.UserID, &consent.ClientID, &consent.ClientName, &consent.Scope, &consent.CreatedAt, &consent.UpdatedAt)
+		if err != nil {
+			log.Printf("repositories > consent.go > GetConsentsForUser > an error occurred when scanning db rows: %s\n", err.Error())
+			return nil, fmt.Errorf("an unexpected error occurred")
+		}
+
+		consents = append(consents, consent)
+	}
+
+	return consents, rows.Err()
+}
+
+// SaveConsent stores the consent, replacing the scopes of any earlier consent
+// the user gave the client.
+func (repo ConsentRepository) SaveConsent(consent models.Consent) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO OAUTH_CONSENTS (USER_ID, CLIENT_ID, SCOPE, CREATED_AT, UPDATED_AT) VALUES (?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE SCOPE = VALUES(SCOPE), UPDATED_AT = VALUES(UPDATED_AT)",
+		consent.UserID, consent.ClientID, consent.Scope, consent.CreatedAt, consent.UpdatedAt)
+	if err != nil {
+		log.Printf("repositories > consent.go > SaveConsent > error saving consent of user ID %d for client %s: %s\n", consent.UserID, consent.ClientID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo ConsentRepository) DeleteConsent(userID int, clientID string) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("DELETE FROM OAUTH_CONSENTS WHERE USER_ID = ? AND CLIENT_ID = ?", userID, clientID)
+	if err != nil {
+		log.Printf("repositories > consent.go > DeleteConsent > error deleting consent of user ID %d for client %s: %s\n", userID, clientID, err.Error())
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrConsentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type IDeviceAuthorizationRepository interface {
+	AddDeviceAuthorization(models.DeviceAuthorization) error
+	GetDeviceAuthorizationByDeviceCodeHash(string) (models.DeviceAuthorization, error)
+	GetDeviceAuthorizationByUserCode(string) (models.DeviceAuthorization, error)
+	UpdateDeviceAuthorizationPoll(string, time.Time, int) error
+	ResolveDeviceAuthorization(string, models.DeviceAuthorizationStatus, int) error
+	DeleteDeviceAuthorization(string) error
+}
+
+// ErrUserCodeTaken is returned when a new device authorization's user code is
+// already in use by another one.
+var ErrUserCodeTaken = fmt.Errorf("user code already exists")
+
+type DeviceAuthorizationRepository struct {
+	DBConn *sql.DB
+}
+
+const deviceAuthorizationColumns = "DEVICE_CODE_HASH, USER_CODE, CLIENT_ID, SCOPE, USER_ID, STATUS, POLL_INTERVAL, LAST_POLLED_AT, EXPIRES_AT"
+
+func (repo DeviceAuthorizationRepository) AddDeviceAuthorization(authorization models.DeviceAuthorization) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO OAUTH_DEVICE_AUTHORIZATIONS (DEVICE_CODE_HASH, USER_CODE, CLIENT_ID, SCOPE, STATUS, POLL_INTERVAL, EXPIRES_AT) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		authorization.DeviceCodeHash, authorization.UserCode, authorization.ClientID, authorization.Scope, authorization.Status,
+		authorization.PollInterval, authorization.ExpiresAt)
+	if err != nil {
+		mysqlerr, _ := err.(*mysql.MySQLError)
+		if mysqlerr != nil && mysqlerr.Number == 1062 {
+			return ErrUserCodeTaken
+		}
+
+		log.Printf("repositories > device_authorization.go > AddDeviceAuthorization > error adding device authorization for client %s: %s\n", authorization.ClientID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo DeviceAuthorizationRepository) GetDeviceAuthorizationByDeviceCodeHash(hash string) (models.DeviceAuthorization, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+deviceAuthorizationColumns+" FROM OAUTH_DEVICE_AUTHORIZATIONS WHERE DEVICE_CODE_HASH = ?", hash)
+
+	authorization, err := scanDeviceAuthorization(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return authorization, fmt.Errorf("device authorization not found")
+		}
+		log.Printf("repositories > device_authorization.go > GetDeviceAuthorizationByDeviceCodeHash > error: %s\n", err.Error())
+		return authorization, err
+	}
+
+	return authorization, nil
+}
+
+func (repo DeviceAuthorizationRepository) GetDeviceAuthorizationByUserCode(userCode string) (models.DeviceAuthorization, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+deviceAuthorizationColumns+" FROM OAUTH_DEVICE_AUTHORIZATIONS WHERE USER_CODE = ?", userCode)
+
+	authorization, err := scanDeviceAuthorization(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return authorization, fmt.Errorf("device authorization not found")
+		}
+		log.Printf("repositories > device_authorization.go > GetDeviceAuthorizationByUserCode > error: %s\n", err.Error())
+		return authorization, err
+	}
+
+	return authorization, nil
+}
+
+func (repo DeviceAuthorizationRepository) UpdateDeviceAuthorizationPoll(hash string, lastPolledAt time.Time, pollInterval int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE OAUTH_DEVICE_AUTHORIZATIONS SET LAST_POLLED_AT = ?, POLL_INTERVAL = ? WHERE DEVICE_CODE_HASH = ?", lastPolledAt, pollInterval, hash)
+	if err != nil {
+		log.Printf("repositories > device_authorization.go > UpdateDeviceAuthorizationPoll > error: %s\n", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ResolveDeviceAuthorization records the user's decision on a device
+// authorization, failing if it has already been decided.
+func (repo DeviceAuthorizationRepository) ResolveDeviceAuthorization(userCode string, status models.DeviceAuthorizationStatus, userID int) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE OAUTH_DEVICE_AUTHORIZATIONS SET STATUS = ?, USER_ID = ? WHERE USER_CODE = ? AND STATUS = ?",
+		status, userID, userCode, models.DeviceAuthorizationPending)
+	if err != nil {
+		log.Printf("repositories > device_authorization.go > ResolveDeviceAuthorization > error: %s\n", err.Error())
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("device authorization not found")
+	}
+
+	return nil
+}
+
+// DeleteDeviceAuthorization deletes a device authorization, failing if it
+// was already deleted so each device code can be exchanged at most once.
+func (repo DeviceAuthorizationRepository) DeleteDeviceAuthorization(hash string) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("DELETE FROM OAUTH_DEVICE_AUTHORIZATIONS WHERE DEVICE_CODE_HASH = ?", hash)
+	if err != nil {
+		log.Printf("repositories > device_authorization.go > DeleteDeviceAuthorization > error: %s\n", err.Error())
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("device authorization not found")
+	}
+
+	return nil
+}
+
+func scanDeviceAuthorization(row rowScanner) (models.DeviceAuthorization, error) {
+	var authorization models.DeviceAuthorization
+	var userID sql.NullInt64
+	var lastPolledAt sql.NullTime
+	err := row.Scan(&authorization.DeviceCodeHash, &authorization.UserCode, &authorization.ClientID, &authorization.Scope, &userID,
+		&authorization.Status, &authorization.PollInterval, &lastPolledAt, &authorization.ExpiresAt)
+
+	authorization.UserID = int(userID.Int64)
+	authorization.LastPolledAt = lastPolledAt.Time
+
+	return authorization, err
+}
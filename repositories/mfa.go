@@ -0,0 +1,201 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+	"time"
+)
+
+type IMFARepository interface {
+	SetTOTPEnrollment(models.TOTPEnrollment) error
+	GetTOTPEnrollment(int) (models.TOTPEnrollment, error)
+	ConfirmTOTPEnrollment(int, int64) error
+	UseTOTPStep(int, int64) (bool, error)
+	RecordFailedAttempt(int, int, time.Time) error
+	ResetFailedAttempts(int) error
+	DeleteTOTPEnrollment(int) error
+	ReplaceRecoveryCodes(int, []string) error
+	ConsumeRecoveryCode(int, string) (bool, error)
+}
+
+// ErrTOTPNotEnrolled is returned when the user has not set up a TOTP
+// authenticator. It is kept apart from other errors so a failing database
+// is not mistaken for a user without a second factor.
+var ErrTOTPNotEnrolled = fmt.Errorf("no TOTP authenticator enrolled")
+
+type MFARepository struct {
+	DBConn *sql.DB
+}
+
+// SetTOTPEnrollment stores a new, unconfirmed authenticator for the user,
+// replacing one they did not confirm. A lockout for wrong codes is kept, so
+// starting over does not lift it.
+func (repo MFARepository) SetTOTPEnrollment(enrollment models.TOTPEnrollment) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO MFA_TOTP (USER_ID, SECRET, CONFIRMED, LAST_USED_STEP, CREATED_AT) VALUES (?, ?, FALSE, 0, ?) "+
+		"ON DUPLICATE KEY UPDATE SECRET = VALUES(SECRET), CONFIRMED = FALSE, LAST_USED_STEP = 0, CREATED_AT = VALUES(CREATED_AT)",
+		enrollment.UserID, enrollment.Secret, enrollment.CreatedAt)
+	if err != nil {
+		log.Printf("repositories > mfa.go > SetTOTPEnrollment > error storing authenticator for user ID %d: %s\n", enrollment.UserID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo MFARepository) GetTOTPEnrollment(userId int) (models.TOTPEnrollment, error) {
+	dbConn := repo.DBConn
+
+	var enrollment models.TOTPEnrollment
+	var lockedUntil sql.NullTime
+	err := dbConn.QueryRow("SELECT USER_ID, SECRET, CONFIRMED, LAST_USED_STEP, FAILED_ATTEMPTS, LOCKED_UNTIL, CREATED_AT FROM MFA_TOTP WHERE USER_ID = ?", userId).
+		Scan(&enrollment.UserID, &enrollment.Secret, &enrollment.Confirmed, &enrollment.LastUsedStep, &enrollment.FailedAttempts, &lockedUntil, &enrollment.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return enrollment, ErrTOTPNotEnrolled
+		}
+		log.Printf("repositories > mfa.go > GetTOTPEnrollment > error: %s\n", err.Error())
+		return enrollment, err
+	}
+	if lockedUntil.Valid {
+		enrollment.LockedUntil = lockedUntil.Time
+	}
+
+	return enrollment, nil
+}
+
+// ConfirmTOTPEnrollment turns the user's authenticator on, recording the
+// period of the code it was confirmed with as used.
+func (repo MFARepository) ConfirmTOTPEnrollment(userId int, step int64) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE MFA_TOTP SET CONFIRMED = TRUE, LAST_USED_STEP = ? WHERE USER_ID = ?", step, userId)
+	if err != nil {
+		log.Printf("repositories > mfa.go > ConfirmTOTPEnrollment > error confirming authenticator of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that a code of the given period was accepted, unless
+// one of that period or a later one already was. It reports whether the code
+// may be accepted, so a code cannot be used twice, even by concurrent
+// requests.
+func (repo MFARepository) UseTOTPStep(userId int, step int64) (bool, error) {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE MFA_TOTP SET LAST_USED_STEP = ? WHERE USER_ID = ? AND CONFIRMED = TRUE AND LAST_USED_STEP < ?", step, userId, step)
+	if err != nil {
+		log.Printf("repositories > mfa.go > UseTOTPStep > error updating authenticator of user ID %d: %s\n", userId, err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// RecordFailedAttempt counts a wrong code the user entered, locking them out
+// until lockedUntil with every maxAttempts wrong codes in a row. The count
+// is kept in the database so concurrent requests cannot get past it.
+func (repo MFARepository) RecordFailedAttempt(userId int, maxAttempts int, lockedUntil time.Time) error {
+	dbConn := repo.DBConn
+
+	// MySQL assigns from left to right, so LOCKED_UNTIL sees the new count
+	_, err := dbConn.Exec("UPDATE MFA_TOTP SET FAILED_ATTEMPTS = FAILED_ATTEMPTS + 1, "+
+		"LOCKED_UNTIL = IF(FAILED_ATTEMPTS % ? = 0, ?, LOCKED_UNTIL) WHERE USER_ID = ?", maxAttempts, lockedUntil, userId)
+	if err != nil {
+		log.Printf("repositories > mfa.go > RecordFailedAttempt > error counting wrong code of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ResetFailedAttempts clears the count of wrong codes once the user entered
+// a correct one.
+func (repo MFARepository) ResetFailedAttempts(userId int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE MFA_TOTP SET FAILED_ATTEMPTS = 0 WHERE USER_ID = ? AND FAILED_ATTEMPTS > 0", userId)
+	if err != nil {
+		log.Printf("repositories > mfa.go > ResetFailedAttempts > error resetting wrong codes of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// DeleteTOTPEnrollment removes the user's authenticator along with their
+// recovery codes.
+func (repo MFARepository) DeleteTOTPEnrollment(userId int) error {
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > mfa.go > DeleteTOTPEnrollment > error starting transaction: %s\n", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM MFA_RECOVERY_CODES WHERE USER_ID = ?", userId); err != nil {
+		log.Printf("repositories > mfa.go > DeleteTOTPEnrollment > error deleting recovery codes of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM MFA_TOTP WHERE USER_ID = ?", userId); err != nil {
+		log.Printf("repositories > mfa.go > DeleteTOTPEnrollment > error deleting authenticator of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes stores the hashes of the user's new recovery codes,
+// invalidating the codes they had before.
+func (repo MFARepository) ReplaceRecoveryCodes(userId int, codeHashes []string) error {
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > mfa.go > ReplaceRecoveryCodes > error starting transaction: %s\n", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM MFA_RECOVERY_CODES WHERE USER_ID = ?", userId); err != nil {
+		log.Printf("repositories > mfa.go > ReplaceRecoveryCodes > error deleting recovery codes of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	now := time.Now()
+	for _, codeHash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO MFA_RECOVERY_CODES (CODE_HASH, USER_ID, CREATED_AT) VALUES (?, ?, ?)", codeHash, userId, now); err != nil {
+			log.Printf("repositories > mfa.go > ReplaceRecoveryCodes > error adding recovery code for user ID %d: %s\n", userId, err.Error())
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeRecoveryCode deletes the user's recovery code with the given hash.
+// It reports whether the user had the code, which cannot be used again.
+func (repo MFARepository) ConsumeRecoveryCode(userId int, codeHash string) (bool, error) {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("DELETE FROM MFA_RECOVERY_CODES WHERE USER_ID = ? AND CODE_HASH = ?", userId, codeHash)
+	if err != nil {
+		log.Printf("repositories > mfa.go > ConsumeRecoveryCode > error consuming recovery code of user ID %d: %s\n", userId, err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
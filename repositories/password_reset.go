@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+)
+
+type IPasswordResetRepository interface {
+	AddPasswordResetToken(models.PasswordResetToken) error
+	ConsumePasswordResetToken(string) (models.PasswordResetToken, error)
+	DeletePasswordResetTokensForUser(int) error
+}
+
+type PasswordResetRepository struct {
+	DBConn *sql.DB
+}
+
+func (repo PasswordResetRepository) AddPasswordResetToken(token models.PasswordResetToken) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO PASSWORD_RESET_TOKENS (TOKEN_HASH, USER_ID, EXPIRES_AT, CREATED_AT) VALUES (?, ?, ?, ?)",
+		token.TokenHash, token.UserID, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		log.Printf("repositories > password_reset.go > AddPasswordResetToken > error adding token for user ID %d: %s\n", token.UserID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// ConsumePasswordResetToken returns the token with the given hash and
+// deletes it, so each token can be used at most once.
+func (repo PasswordResetRepository) ConsumePasswordResetToken(tokenHash string) (models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > password_reset.go > ConsumePasswordResetToken > error starting transaction: %s\n", err.Error())
+		return token, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT TOKEN_HASH, USER_ID, EXPIRES_AT, CREATED_AT FROM PASSWORD_RESET_TOKENS WHERE TOKEN_HASH = ? FOR UPDATE", tokenHash)
+	err = row.Scan(&token.TokenHash, &token.UserID, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return token, fmt.Errorf("password reset token not found")
+		}
+		log.Printf("repositories > password_reset.go > ConsumePasswordResetToken > error: %s\n", err.Error())
+		return token, err
+	}
+
+	_, err = tx.Exec("DELETE FROM PASSWORD_RESET_TOKENS WHERE TOKEN_HASH = ?", tokenHash)
+	if err != nil {
+		log.Printf("repositories > password_reset.go > ConsumePasswordResetToken > error deleting token: %s\n", err.Error())
+		return token, err
+	}
+
+	return token, tx.Commit()
+}
+
+// DeletePasswordResetTokensForUser invalidates every reset link sent to the
+// user so far.
+func (repo PasswordResetRepository) DeletePasswordResetTokensForUser(userId int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("DELETE FROM PASSWORD_RESET_TOKENS WHERE USER_ID = ?", userId)
+	if err != nil {
+		log.Printf("repositories > password_reset.go > DeletePasswordResetTokensForUser > error deleting tokens for user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+	"strings"
+)
+
+type ISessionRepository interface {
+	AddSession(models.Session) (models.Session, error)
+	GetSessionByID(string) (models.Session, error)
+	GetSessionByRefreshTokenHash(string) (models.Session, error)
+	GetSessionByRotatedRefreshTokenHash(string) (models.Session, error)
+	GetSessionsForUser(int) ([]models.Session, error)
+	RotateSessionRefreshToken(models.Session, string) error
+	DeleteSession(string) error
+	DeleteSessionsForUser(int) error
+	DeleteClientSessionsForUser(int, string) error
+	GetChildSessions(string) ([]models.Session, error)
+}
+
+// ErrRefreshTokenRotated is returned when the refresh token being replaced is
+// no longer the current token of its session.
+var ErrRefreshTokenRotated = fmt.Errorf("refresh token has already been rotated")
+
+// ErrSessionNotFound is returned when no session matches, such as when it
+// has ended.
+var ErrSessionNotFound = fmt.Errorf("session not found")
+
+type SessionRepository struct {
+	DBConn *sql.DB
+}
+
+const sessionColumns = "ID, USER_ID, CLIENT_ID, SCOPE, PARENT_SESSION_ID, DEVICE_LABEL, USER_AGENT, IP_ADDRESS, AMR, REFRESH_TOKEN_HASH, CREATED_AT, LAST_USED_AT, EXPIRES_AT"
+
+func (repo SessionRepository) AddSession(session models.Session) (models.Session, error) {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO SESSIONS ("+sessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.ClientID, session.Scope, session.ParentSessionID, session.DeviceLabel, session.UserAgent, session.IPAddress,
+		strings.Join(session.AuthMethods, " "), session.RefreshTokenHash, session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	if err != nil {
+		log.Printf("repositories > session.go > AddSession > error adding session for user ID %d: %s\n", session.UserID, err.Error())
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (repo SessionRepository) GetSessionByID(id string) (models.Session, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+sessionColumns+" FROM SESSIONS WHERE ID = ?", id)
+
+	session, err := scanSession(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return session, ErrSessionNotFound
+		}
+		log.Printf("repositories > session.go > GetSessionByID > error: %s\n", err.Error())
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (repo SessionRepository) GetSessionByRefreshTokenHash(hash string) (models.Session, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+sessionColumns+" FROM SESSIONS WHERE REFRESH_TOKEN_HASH = ?", hash)
+
+	session, err := scanSession(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return session, ErrSessionNotFound
+		}
+		log.Printf("repositories > session.go > GetSessionByRefreshTokenHash > error: %s\n", err.Error())
+		return session, err
+	}
+
+	return session, nil
+}
+
+// GetSessionByRotatedRefreshTokenHash returns the session a refresh token was
+// issued for after that token has been rotated out.
+func (repo SessionRepository) GetSessionByRotatedRefreshTokenHash(hash string) (models.Session, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+prefixColumns("S.", sessionColumns)+" FROM SESSIONS S "+
+		"INNER JOIN ROTATED_REFRESH_TOKENS R ON R.SESSION_ID = S.ID WHERE R.REFRESH_TOKEN_HASH = ?", hash)
+
+	session, err := scanSession(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return session, ErrSessionNotFound
+		}
+		log.Printf("repositories > session.go > GetSessionByRotatedRefreshTokenHash > error: %s\n", err.Error())
+		return session, err
+	}
+
+	return session, nil
+}
+
+func (repo SessionRepository) GetSessionsForUser(userId int) ([]models.Session, error) {
+	dbConn := repo.DBConn
+
+	rows, err := dbConn.Query("SELECT "+sessionColumns+" FROM SESSIONS WHERE USER_ID = ? ORDER BY LAST_USED_AT DESC", userId)
+	if err != nil {
+		log.Printf("repositories > session.go > GetSessionsForUser > error getting sessions for user ID %d: %s\n", userId, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			log.Printf("repositories > session.go > GetSessionsForUser > an error occurred when scanning db rows: %s\n", err.Error())
+			return nil, fmt.Errorf("an unexpected error occurred")
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// GetChildSessions returns the client sessions that were authorized from the
+// browser session with the given ID.
+func (repo SessionRepository) GetChildSessions(parentID string) ([]models.Session, error) {
+	dbConn := repo.DBConn
+
+	rows, err := dbConn.Query("SELECT "+sessionColumns+" FROM SESSIONS WHERE PARENT_SESSION_ID = ?", parentID)
+	if err != nil {
+		log.Printf("repositories > session.go > GetChildSessions > error getting child sessions of session %s: %s\n", parentID, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			log.Printf("repositories > session.go > GetChildSessions > an error occurred when scanning db rows: %s\n", err.Error())
+			return nil, fmt.Errorf("an unexpected error occurred")
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RotateSessionRefreshToken stores the session's new refresh token hash, but
+// only if previousRefreshTokenHash is still current, so two requests racing
+// with the same token cannot both rotate it. The previous hash is kept so
+// later reuse of the old token can be traced back to the session.
+func (repo SessionRepository) RotateSessionRefreshToken(session models.Session, previousRefreshTokenHash string) error {
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > session.go > RotateSessionRefreshToken > error starting transaction: %s\n", err.Error())
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE SESSIONS SET USER_AGENT = ?, IP_ADDRESS = ?, REFRESH_TOKEN_HASH = ?, LAST_USED_AT = ?, EXPIRES_AT = ? WHERE ID = ? AND REFRESH_TOKEN_HASH = ?",
+		session.UserAgent, session.IPAddress, session.RefreshTokenHash, session.LastUsedAt, session.ExpiresAt, session.ID, previousRefreshTokenHash)
+	if err != nil {
+		log.Printf("repositories > session.go > RotateSessionRefreshToken > error updating session %s: %s\n", session.ID, err.Error())
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRefreshTokenRotated
+	}
+
+	_, err = tx.Exec("INSERT INTO ROTATED_REFRESH_TOKENS (REFRESH_TOKEN_HASH, SESSION_ID, ROTATED_AT) VALUES (?, ?, ?)",
+		previousRefreshTokenHash, session.ID, session.LastUsedAt)
+	if err != nil {
+		log.Printf("repositories > session.go > RotateSessionRefreshToken > error recording rotated token for session %s: %s\n", session.ID, err.Error())
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repo SessionRepository) DeleteSession(id string) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("DELETE FROM SESSIONS WHERE ID = ?", id)
+	if err != nil {
+		log.Printf("repositories > session.go > DeleteSession > error deleting session %s: %s\n", id, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo SessionRepository) DeleteSessionsForUser(userId int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("DELETE FROM SESSIONS WHERE USER_ID = ?", userId)
+	if err != nil {
+		log.Printf("repositories > session.go > DeleteSessionsForUser > error deleting sessions for user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo SessionRepository) DeleteClientSessionsForUser(userId int, clientID string) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("DELETE FROM SESSIONS WHERE USER_ID = ? AND CLIENT_ID = ?", userId, clientID)
+	if err != nil {
+		log.Printf("repositories > session.go > DeleteClientSessionsForUser > error deleting sessions of client %s for user ID %d: %s\n", clientID, userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (models.Session, error) {
+	var session models.Session
+	var authMethods string
+	err := row.Scan(&session.ID, &session.UserID, &session.ClientID, &session.Scope, &session.ParentSessionID, &session.DeviceLabel, &session.UserAgent, &session.IPAddress,
+		&authMethods, &session.RefreshTokenHash, &session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+	session.AuthMethods = strings.Fields(authMethods)
+
+	return session, err
+}
+
+func prefixColumns(prefix string, columns string) string {
+	return prefix + strings.ReplaceAll(columns, ", ", ", "+prefix)
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+)
+
+// TokenDenylistRepository stores revoked token IDs in the database so every
+// instance of the service sees the same revocations.
+type TokenDenylistRepository struct {
+	DBConn *sql.DB
+}
+
+func (repo TokenDenylistRepository) RevokeToken(jti string, expiresAt time.Time) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO REVOKED_TOKENS (JTI, EXPIRES_AT) VALUES (?, ?) ON DUPLICATE KEY UPDATE EXPIRES_AT = VALUES(EXPIRES_AT)",
+		jti, expiresAt)
+	if err != nil {
+		log.Printf("repositories > token_denylist.go > RevokeToken > error revoking token %s: %s\n", jti, err.Error())
+		return err
+	}
+
+	_, err = dbConn.Exec("DELETE FROM REVOKED_TOKENS WHERE EXPIRES_AT < ?", time.Now())
+	if err != nil {
+		log.Printf("repositories > token_denylist.go > RevokeToken > error removing expired tokens: %s\n", err.Error())
+	}
+
+	return nil
+}
+
+func (repo TokenDenylistRepository) IsTokenRevoked(jti string) (bool, error) {
+	dbConn := repo.DBConn
+
+	var count int
+	err := dbConn.QueryRow("SELECT COUNT(*) FROM REVOKED_TOKENS WHERE JTI = ? AND EXPIRES_AT >= ?", jti, time.Now()).Scan(&count)
+	if err != nil {
+		log.Printf("repositories > token_denylist.go > IsTokenRevoked > error checking token %s: %s\n", jti, err.Error())
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// MemoryTokenDenylist keeps revoked token IDs in memory until they expire.
+// Revocations are not shared between instances or kept across restarts.
+type MemoryTokenDenylist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryTokenDenylist() *MemoryTokenDenylist {
+	return &MemoryTokenDenylist{revoked: make(map[string]time.Time)}
+}
+
+func (denylist *MemoryTokenDenylist) RevokeToken(jti string, expiresAt time.Time) error {
+	denylist.mu.Lock()
+	defer denylist.mu.Unlock()
+
+	now := time.Now()
+	for revokedJti, revokedExpiresAt := range denylist.revoked {
+		if now.After(revokedExpiresAt) {
+			delete(denylist.revoked, revokedJti)
+		}
+	}
+
+	denylist.revoked[jti] = expiresAt
+	return nil
+}
+
+func (denylist *MemoryTokenDenylist) IsTokenRevoked(jti string) (bool, error) {
+	denylist.mu.Lock()
+	defer denylist.mu.Unlock()
+
+	expiresAt, ok := denylist.revoked[jti]
+	return ok && !time.Now().After(expiresAt), nil
+}
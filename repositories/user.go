@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"jwt-auth-service/models"
 	"log"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"golang.org/x/crypto/bcrypt"
@@ -16,8 +17,14 @@ type IUserRepository interface {
 	GetUserByID(int) (models.User, error)
 	GetUserByEmail(string) (models.User, error)
 	GetUserWithCredentials(string, string) (models.User, error)
-	UpdateRefreshToken(int, string) error
-	GetRefreshToken(int) (string, error)
+	GetTokenVersion(int) (int, error)
+	IncrementTokenVersion(int) error
+	AddPairwiseSubject(string, int, string) error
+	GetUserIDForSubject(string) (int, error)
+	SetEmailVerified(int) error
+	MarkVerificationEmailSent(int, time.Time) (bool, error)
+	MarkPasswordResetEmailSent(int, time.Time) (bool, error)
+	UpdatePassword(int, string) error
 }
 
 type UserRepository struct {
@@ -27,8 +34,8 @@ type UserRepository struct {
 func (repo UserRepository) AddUser(user models.User) (models.User, error) {
 	dbConn := repo.DBConn
 
-	result, err := dbConn.Exec("INSERT INTO USERS (EMAIL, PASSWORD) VALUES (?, ?)",
-		user.Email, user.Password)
+	result, err := dbConn.Exec("INSERT INTO USERS (PUBLIC_ID, EMAIL, PASSWORD) VALUES (?, ?, ?)",
+		user.PublicID, user.Email, user.Password)
 
 	if err != nil {
 		mysqlerr, _ := err.(*mysql.MySQLError)
@@ -53,11 +60,6 @@ func (repo UserRepository) AddUser(user models.User) (models.User, error) {
 		log.Println("repositories > user.go > AddUser > error: %s" + err.Error())
 	}
 
-	_, err = dbConn.Exec("INSERT INTO REFRESH_TOKENS (USER_ID) VALUES (?)", id)
-	if err != nil {
-		log.Println("repositories > user.go > AddUser > error: %s" + err.Error())
-	}
-
 	user.ID = int(id)
 	user.UserRoles = []models.Roles{models.UserRole}
 
@@ -67,10 +69,10 @@ func (repo UserRepository) AddUser(user models.User) (models.User, error) {
 func (repo UserRepository) GetUserByID(id int) (models.User, error) {
 	dbConn := repo.DBConn
 
-	row := dbConn.QueryRow("SELECT ID, EMAIL FROM USERS WHERE ID = ?", id)
+	row := dbConn.QueryRow("SELECT ID, PUBLIC_ID, EMAIL, EMAIL_VERIFIED, TOKEN_VERSION FROM USERS WHERE ID = ?", id)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Email)
+	err := row.Scan(&user.ID, &user.PublicID, &user.Email, &user.EmailVerified, &user.TokenVersion)
 
 	if err != nil {
 		return user, err
@@ -98,10 +100,10 @@ func (repo UserRepository) GetUserByID(id int) (models.User, error) {
 func (repo UserRepository) GetUserByEmail(email string) (models.User, error) {
 	dbConn := repo.DBConn
 
-	row := dbConn.QueryRow("SELECT ID, EMAIL FROM USERS WHERE EMAIL = ?", email)
+	row := dbConn.QueryRow("SELECT ID, PUBLIC_ID, EMAIL, EMAIL_VERIFIED, TOKEN_VERSION FROM USERS WHERE EMAIL = ?", email)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Email)
+	err := row.Scan(&user.ID, &user.PublicID, &user.Email, &user.EmailVerified, &user.TokenVersion)
 
 	if err != nil {
 		return user, err
@@ -129,10 +131,10 @@ func (repo UserRepository) GetUserByEmail(email string) (models.User, error) {
 func (repo UserRepository) GetUserWithCredentials(email string, password string) (models.User, error) {
 	dbConn := repo.DBConn
 
-	row := dbConn.QueryRow("SELECT ID, EMAIL, PASSWORD FROM USERS WHERE EMAIL = ?", email)
+	row := dbConn.QueryRow("SELECT ID, PUBLIC_ID, EMAIL, EMAIL_VERIFIED, PASSWORD, TOKEN_VERSION FROM USERS WHERE EMAIL = ?", email)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Email, &user.Password)
+	err := row.Scan(&user.ID, &user.PublicID, &user.Email, &user.EmailVerified, &user.Password, &user.TokenVersion)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -189,42 +191,131 @@ func (repo UserRepository) DeleteUser(id int) error {
 	return err
 }
 
-func (repo UserRepository) UpdateRefreshToken(userId int, refreshToken string) error {
+func (repo UserRepository) GetTokenVersion(userId int) (int, error) {
 	dbConn := repo.DBConn
-	_, err := dbConn.Exec("UPDATE REFRESH_TOKENS SET REFRESH_TOKEN = ? WHERE USER_ID = ?", refreshToken, userId)
+
+	var tokenVersion int
+	err := dbConn.QueryRow("SELECT TOKEN_VERSION FROM USERS WHERE ID = ?", userId).Scan(&tokenVersion)
 	if err != nil {
-		log.Printf("repositories > user.go > UpdateRefreshToken > error updating refresh token for user ID %d: %s\n", userId, err.Error())
+		log.Printf("repositories > user.go > GetTokenVersion > error getting token version for user ID %d: %s\n", userId, err.Error())
+		return 0, err
+	}
+
+	return tokenVersion, nil
+}
+
+// IncrementTokenVersion invalidates every access token issued to the user so far.
+func (repo UserRepository) IncrementTokenVersion(userId int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE USERS SET TOKEN_VERSION = TOKEN_VERSION + 1 WHERE ID = ?", userId)
+	if err != nil {
+		log.Printf("repositories > user.go > IncrementTokenVersion > error updating token version for user ID %d: %s\n", userId, err.Error())
 		return err
 	}
 
 	return nil
 }
 
-func (repo UserRepository) GetRefreshToken(userId int) (string, error) {
+// AddPairwiseSubject records the user a pairwise subject was issued for, so
+// the user can be looked up when a client presents a token with it.
+func (repo UserRepository) AddPairwiseSubject(subject string, userId int, sectorIdentifier string) error {
 	dbConn := repo.DBConn
-	rows, err := dbConn.Query("SELECT REFRESH_TOKEN FROM REFRESH_TOKENS WHERE USER_ID = ?", userId)
+
+	_, err := dbConn.Exec("INSERT IGNORE INTO OAUTH_PAIRWISE_SUBJECTS (SUBJECT, USER_ID, SECTOR_IDENTIFIER) VALUES (?, ?, ?)",
+		subject, userId, sectorIdentifier)
 	if err != nil {
-		log.Printf("repositories > user.go > UpdateRefreshToken > error updating refresh token for user ID %d: %s\n", userId, err.Error())
-		return "", err
+		log.Printf("repositories > user.go > AddPairwiseSubject > error recording pairwise subject for user ID %d: %s\n", userId, err.Error())
+		return err
 	}
 
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
-		if err != nil {
-			log.Printf("repositories > user.go > UpdateRefreshToken > error closing database rows")
-		}
-	}(rows)
+	return nil
+}
 
-	var refreshToken string
-	for rows.Next() {
-		err = rows.Scan(&refreshToken)
-		if err != nil {
-			log.Printf("repositories > user.go > GetRefreshToken > an error occurred when scanning db rows: %s\n", err.Error())
-			return "", fmt.Errorf("an unexpected error occurred")
+// GetUserIDForSubject returns the ID of the user a token subject identifies,
+// which is either the user's public ID or a pairwise subject issued for them.
+func (repo UserRepository) GetUserIDForSubject(subject string) (int, error) {
+	dbConn := repo.DBConn
+
+	var userId int
+	err := dbConn.QueryRow("SELECT ID FROM USERS WHERE PUBLIC_ID = ? UNION ALL SELECT USER_ID FROM OAUTH_PAIRWISE_SUBJECTS WHERE SUBJECT = ? LIMIT 1",
+		subject, subject).Scan(&userId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("user not found")
 		}
+		log.Printf("repositories > user.go > GetUserIDForSubject > error: %s\n", err.Error())
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (repo UserRepository) SetEmailVerified(userId int) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE USERS SET EMAIL_VERIFIED = TRUE WHERE ID = ?", userId)
+	if err != nil {
+		log.Printf("repositories > user.go > SetEmailVerified > error verifying email of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// MarkVerificationEmailSent records that a verification email is being sent
+// to the unverified user, unless one was already sent after notSentSince. It
+// reports whether the email may be sent, so concurrent requests cannot both
+// send one.
+func (repo UserRepository) MarkVerificationEmailSent(userId int, notSentSince time.Time) (bool, error) {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE USERS SET VERIFICATION_EMAIL_SENT_AT = ? WHERE ID = ? AND EMAIL_VERIFIED = FALSE AND (VERIFICATION_EMAIL_SENT_AT IS NULL OR VERIFICATION_EMAIL_SENT_AT < ?)",
+		time.Now(), userId, notSentSince)
+	if err != nil {
+		log.Printf("repositories > user.go > MarkVerificationEmailSent > error updating user ID %d: %s\n", userId, err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
 
-		return refreshToken, err
+// MarkPasswordResetEmailSent records that a password reset email is being
+// sent to the user, unless one was already sent after notSentSince. It
+// reports whether the email may be sent, so concurrent requests cannot both
+// send one.
+func (repo UserRepository) MarkPasswordResetEmailSent(userId int, notSentSince time.Time) (bool, error) {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE USERS SET PASSWORD_RESET_EMAIL_SENT_AT = ? WHERE ID = ? AND (PASSWORD_RESET_EMAIL_SENT_AT IS NULL OR PASSWORD_RESET_EMAIL_SENT_AT < ?)",
+		time.Now(), userId, notSentSince)
+	if err != nil {
+		log.Printf("repositories > user.go > MarkPasswordResetEmailSent > error updating user ID %d: %s\n", userId, err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
 	}
 
-	return refreshToken, err
+	return rowsAffected == 1, nil
+}
+
+// UpdatePassword replaces the user's password with the given bcrypt hash.
+func (repo UserRepository) UpdatePassword(userId int, passwordHash string) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("UPDATE USERS SET PASSWORD = ? WHERE ID = ?", passwordHash, userId)
+	if err != nil {
+		log.Printf("repositories > user.go > UpdatePassword > error updating password for user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	return nil
 }
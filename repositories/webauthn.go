@@ -0,0 +1,199 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"jwt-auth-service/models"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type IWebAuthnRepository interface {
+	AddChallenge(models.WebAuthnChallenge) error
+	ConsumeChallenge(string) (models.WebAuthnChallenge, error)
+	AddCredential(models.WebAuthnCredential) error
+	GetCredential([]byte) (models.WebAuthnCredential, error)
+	GetCredentialsForUser(int) ([]models.WebAuthnCredential, error)
+	UpdateSignCount([]byte, uint32, uint32) (bool, error)
+	DeleteCredential(int, []byte) error
+}
+
+// ErrCredentialExists is returned when a passkey is registered a second time.
+var ErrCredentialExists = fmt.Errorf("passkey is already registered")
+
+type WebAuthnRepository struct {
+	DBConn *sql.DB
+}
+
+const webAuthnCredentialColumns = "ID, USER_ID, PUBLIC_KEY, SIGN_COUNT, AAGUID, NAME, CREATED_AT, LAST_USED_AT"
+
+func (repo WebAuthnRepository) AddChallenge(challenge models.WebAuthnChallenge) error {
+	dbConn := repo.DBConn
+
+	// challenges of passkey logins are not tied to a user yet
+	var userId sql.NullInt64
+	if challenge.UserID != 0 {
+		userId = sql.NullInt64{Int64: int64(challenge.UserID), Valid: true}
+	}
+
+	_, err := dbConn.Exec("INSERT INTO WEBAUTHN_CHALLENGES (CHALLENGE_HASH, USER_ID, CEREMONY, EXPIRES_AT) VALUES (?, ?, ?, ?)",
+		challenge.ChallengeHash, userId, challenge.Ceremony, challenge.ExpiresAt)
+	if err != nil {
+		log.Printf("repositories > webauthn.go > AddChallenge > error adding %s challenge: %s\n", challenge.Ceremony, err.Error())
+		return err
+	}
+
+	_, err = dbConn.Exec("DELETE FROM WEBAUTHN_CHALLENGES WHERE EXPIRES_AT < ?", time.Now())
+	if err != nil {
+		log.Printf("repositories > webauthn.go > AddChallenge > error removing expired challenges: %s\n", err.Error())
+	}
+
+	return nil
+}
+
+// ConsumeChallenge returns the challenge with the given hash and deletes it,
+// so each challenge can be answered at most once.
+func (repo WebAuthnRepository) ConsumeChallenge(challengeHash string) (models.WebAuthnChallenge, error) {
+	var challenge models.WebAuthnChallenge
+
+	tx, err := repo.DBConn.Begin()
+	if err != nil {
+		log.Printf("repositories > webauthn.go > ConsumeChallenge > error starting transaction: %s\n", err.Error())
+		return challenge, err
+	}
+	defer tx.Rollback()
+
+	var userId sql.NullInt64
+	row := tx.QueryRow("SELECT CHALLENGE_HASH, USER_ID, CEREMONY, EXPIRES_AT FROM WEBAUTHN_CHALLENGES WHERE CHALLENGE_HASH = ? FOR UPDATE", challengeHash)
+	err = row.Scan(&challenge.ChallengeHash, &userId, &challenge.Ceremony, &challenge.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return challenge, fmt.Errorf("challenge not found")
+		}
+		log.Printf("repositories > webauthn.go > ConsumeChallenge > error: %s\n", err.Error())
+		return challenge, err
+	}
+	challenge.UserID = int(userId.Int64)
+
+	_, err = tx.Exec("DELETE FROM WEBAUTHN_CHALLENGES WHERE CHALLENGE_HASH = ?", challengeHash)
+	if err != nil {
+		log.Printf("repositories > webauthn.go > ConsumeChallenge > error deleting challenge: %s\n", err.Error())
+		return challenge, err
+	}
+
+	return challenge, tx.Commit()
+}
+
+func (repo WebAuthnRepository) AddCredential(credential models.WebAuthnCredential) error {
+	dbConn := repo.DBConn
+
+	_, err := dbConn.Exec("INSERT INTO WEBAUTHN_CREDENTIALS ("+webAuthnCredentialColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		credential.ID, credential.UserID, credential.PublicKey, credential.SignCount, credential.AAGUID, credential.Name, credential.CreatedAt, credential.LastUsedAt)
+	if err != nil {
+		mysqlerr, _ := err.(*mysql.MySQLError)
+		if mysqlerr != nil && mysqlerr.Number == 1062 {
+			return ErrCredentialExists
+		}
+
+		log.Printf("repositories > webauthn.go > AddCredential > error adding passkey for user ID %d: %s\n", credential.UserID, err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (repo WebAuthnRepository) GetCredential(id []byte) (models.WebAuthnCredential, error) {
+	dbConn := repo.DBConn
+
+	row := dbConn.QueryRow("SELECT "+webAuthnCredentialColumns+" FROM WEBAUTHN_CREDENTIALS WHERE ID = ?", id)
+
+	credential, err := scanWebAuthnCredential(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return credential, fmt.Errorf("passkey not found")
+		}
+		log.Printf("repositories > webauthn.go > GetCredential > error: %s\n", err.Error())
+		return credential, err
+	}
+
+	return credential, nil
+}
+
+func (repo WebAuthnRepository) GetCredentialsForUser(userId int) ([]models.WebAuthnCredential, error) {
+	dbConn := repo.DBConn
+
+	rows, err := dbConn.Query("SELECT "+webAuthnCredentialColumns+" FROM WEBAUTHN_CREDENTIALS WHERE USER_ID = ? ORDER BY CREATED_AT", userId)
+	if err != nil {
+		log.Printf("repositories > webauthn.go > GetCredentialsForUser > error getting passkeys for user ID %d: %s\n", userId, err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			log.Printf("repositories > webauthn.go > GetCredentialsForUser > an error occurred when scanning db rows: %s\n", err.Error())
+			return nil, fmt.Errorf("an unexpected error occurred")
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+// UpdateSignCount stores the signature counter the passkey reported when it
+// was used, but only if the stored counter is still previousSignCount, so two
+// requests racing with the same assertion cannot both succeed.
+func (repo WebAuthnRepository) UpdateSignCount(id []byte, previousSignCount uint32, signCount uint32) (bool, error) {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("UPDATE WEBAUTHN_CREDENTIALS SET SIGN_COUNT = ?, LAST_USED_AT = ? WHERE ID = ? AND SIGN_COUNT = ?",
+		signCount, time.Now(), id, previousSignCount)
+	if err != nil {
+		log.Printf("repositories > webauthn.go > UpdateSignCount > error updating passkey: %s\n", err.Error())
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (repo WebAuthnRepository) DeleteCredential(userId int, id []byte) error {
+	dbConn := repo.DBConn
+
+	result, err := dbConn.Exec("DELETE FROM WEBAUTHN_CREDENTIALS WHERE USER_ID = ? AND ID = ?", userId, id)
+	if err != nil {
+		log.Printf("repositories > webauthn.go > DeleteCredential > error deleting passkey of user ID %d: %s\n", userId, err.Error())
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("passkey not found")
+	}
+
+	return nil
+}
+
+func scanWebAuthnCredential(row rowScanner) (models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.PublicKey, &credential.SignCount, &credential.AAGUID,
+		&credential.Name, &credential.CreatedAt, &lastUsedAt)
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return credential, err
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type changepasswordrequestbody struct {
+	CurrentPassword     string `json:"current_password"`
+	NewPassword         string `json:"new_password"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+func AddAccountRoutes(rg *gin.RouterGroup) {
+	accountGroup := rg.Group("/account", middleware.FirstPartyTokenAuth())
+
+	accountGroup.POST("/password", changePassword)
+	accountGroup.GET("/mfa", getMFAStatus)
+	accountGroup.POST("/mfa/totp", beginTOTPEnrollment)
+	accountGroup.POST("/mfa/totp/confirm", confirmTOTPEnrollment)
+	accountGroup.DELETE("/mfa/totp", disableTOTP)
+	accountGroup.POST("/mfa/recovery-codes", regenerateRecoveryCodes)
+	accountGroup.GET("/passkeys", getPasskeys)
+	accountGroup.POST("/passkeys/register/begin", beginPasskeyRegistration)
+	accountGroup.POST("/passkeys/register/finish", finishPasskeyRegistration)
+	accountGroup.DELETE("/passkeys/:id", deletePasskey)
+}
+
+// accountUserID returns the ID of the signed in user. It must run after
+// FirstPartyTokenAuth, so only the user can change their account.
+func accountUserID(c *gin.Context) (int, bool) {
+	claims := c.MustGet("claims").(models.TokenClaims)
+	userID, err := claims.UserID()
+	if err != nil {
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		return 0, false
+	}
+
+	return userID, true
+}
+
+// account/password
+func changePassword(c *gin.Context) {
+	var requestBody changepasswordrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.CurrentPassword == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+	if errors := models.ValidatePassword(requestBody.NewPassword); errors != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: "Validation errors occurred", Errors: errors})
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > account.go > changePassword > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	userRepo := repositories.UserRepository{DBConn: env.DB}
+	controller := controllers.UserController{UserRepository: userRepo}
+	err := controller.ChangePassword(userID, requestBody.CurrentPassword, requestBody.NewPassword)
+	if err == controllers.ErrIncorrectPassword {
+		c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("routes > account.go > changePassword > could not change password for user ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	if requestBody.RevokeOtherSessions {
+		sessionController := controllers.SessionController{
+			SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+			UserRepository:    userRepo,
+			LogoutNotifier:    newLogoutNotifier(env),
+		}
+		if err := sessionController.RevokeOtherSessions(userID, c.MustGet("claims").(models.TokenClaims).SessionID); err != nil {
+			log.Printf("routes > account.go > changePassword > could not revoke other sessions for user ID %d", userID)
+			c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
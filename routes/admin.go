@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type revoketokenrequestbody struct {
+	TokenID   string `json:"jti"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+func AddAdminRoutes(rg *gin.RouterGroup) {
+	// admins have to sign in with a second factor to use these routes
+	adminGroup := rg.Group("/admin", middleware.FirstPartyTokenAuth(), middleware.RequireRole(models.AdminRole), middleware.RequireMFA())
+
+	adminGroup.POST("/tokens/revoke", revokeTokenByID)
+
+	adminGroup.GET("/clients", getClients)
+	adminGroup.POST("/clients", addClient)
+	adminGroup.GET("/clients/:id", getClient)
+	adminGroup.PUT("/clients/:id", updateClient)
+	adminGroup.DELETE("/clients/:id", deleteClient)
+	adminGroup.POST("/clients/:id/secret", rotateClientSecret)
+}
+
+// admin/tokens/revoke
+func revokeTokenByID(c *gin.Context) {
+	var requestBody revoketokenrequestbody
+	if err := c.BindJSON(&requestBody); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+	if len(strings.TrimSpace(requestBody.TokenID)) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: "Validation errors occurred", Errors: []string{"missing required field: jti"}})
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > admin.go > revokeTokenByID > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	// without the token's expiry, keep the entry for as long as any access token could live
+	expiresAt := time.Now().Add(models.AccessTokenLifetime)
+	if requestBody.ExpiresAt != 0 {
+		expiresAt = time.Unix(requestBody.ExpiresAt, 0)
+	}
+
+	if err := env.Denylist.RevokeToken(requestBody.TokenID, expiresAt); err != nil {
+		log.Printf("routes > admin.go > revokeTokenByID > could not revoke token %s", requestBody.TokenID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
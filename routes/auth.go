@@ -3,35 +3,52 @@ package routes
 import (
 	"fmt"
 	"jwt-auth-service/controllers"
+	"jwt-auth-service/middleware"
 	"jwt-auth-service/models"
 	"jwt-auth-service/repositories"
 	"jwt-auth-service/utils"
 	"log"
 	"net/http"
 	"net/mail"
-	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type loginresponse struct {
-	AuthToken        string                     `json:"auth_token"`
-	AuthTokenDetails models.ClientReadableToken `json:"auth_token_details"`
+	AuthToken             string                     `json:"auth_token"`
+	AuthTokenDetails      models.ClientReadableToken `json:"auth_token_details"`
+	RefreshToken          string                     `json:"refresh_token"`
+	RefreshTokenExpiresAt int64                      `json:"refresh_token_expires_at"`
 }
 
 type loginrequestbody struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	DeviceLabel string `json:"device_label"`
+}
+
+type refreshrequestbody struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 func AddAuthRoutes(rg *gin.RouterGroup) {
 	authGroup := rg.Group("/auth")
 
 	authGroup.POST("/login", login)
+	authGroup.POST("/login/mfa", loginWithMFA)
+	authGroup.POST("/passkey/begin", beginPasskeyLogin)
+	authGroup.POST("/passkey/finish", finishPasskeyLogin)
 	authGroup.POST("/register", register)
+	authGroup.GET("/verify-email", verifyEmailLink)
+	authGroup.POST("/verify-email", verifyEmail)
+	authGroup.POST("/verify-email/resend", resendVerificationEmail)
+	authGroup.POST("/password/forgot", forgotPassword)
+	authGroup.GET("/password/reset", passwordResetPage)
+	authGroup.POST("/password/reset", resetPassword)
 	authGroup.POST("/refreshtoken", refreshAuthToken)
+	authGroup.POST("/logout", logout)
+	authGroup.POST("/logout-all", middleware.FirstPartyTokenAuth(), logoutAll)
 }
 
 // auth/login
@@ -65,33 +82,52 @@ func login(c *gin.Context) {
 		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: err.Error()})
 		return
 	}
-
-	authTokenExpiration := time.Now().Add(time.Minute * 30)
-	authTokenString, err := models.MintToken(user.ID, user.UserRoles, authTokenExpiration)
-	if err != nil {
-		log.Printf("routes > auth.go > getAuthToken > failed to mint auth token")
-		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
+	if requireVerifiedEmail() && !user.EmailVerified {
+		c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: "email address has not been verified"})
 		return
 	}
 
-	refreshTokenExpiration := time.Now().Add(time.Hour * 168) // 1 week
-	refreshTokenString, err := models.MintToken(user.ID, user.UserRoles, refreshTokenExpiration)
-	err = repo.UpdateRefreshToken(user.ID, refreshTokenString)
+	// users with MFA get their tokens from auth/login/mfa once they enter a
+	// code or use one of their passkeys
+	mfaController := newMFAController(env)
+	mfaEnabled, err := mfaController.MFAEnabled(user.ID)
 	if err != nil {
-		log.Printf("routes > auth.go > register > failed to update refresh token")
+		log.Printf("routes > auth.go > login > could not check MFA of user ID %d", user.ID)
 		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
 		return
 	}
+	if mfaEnabled {
+		mfaToken, expiresAt, err := mfaController.StartChallenge(user, requestBody.DeviceLabel)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+			return
+		}
+
+		response := mfachallengeresponse{MFARequired: true, MFAToken: mfaToken, MFATokenExpiresAt: expiresAt.Unix()}
+
+		// users with passkeys can confirm with one of them instead of a code
+		passkeyOptions, err := mfaController.WebAuthn.BeginSecondFactor(user.ID)
+		if err == nil {
+			response.PasskeyOptions = &passkeyOptions
+		} else if err != controllers.ErrPasskeyNotFound {
+			log.Printf("routes > auth.go > login > could not offer passkeys to user ID %d: %s", user.ID, err.Error())
+		}
+
+		c.IndentedJSON(http.StatusAccepted, response)
+		return
+	}
 
-	authTokenDetails := models.ClientReadableToken{
-		ExpiresAt: authTokenExpiration.Unix(),
-		UserRoles: user.UserRoles,
+	session := newSession(c, user.ID, requestBody.DeviceLabel)
+	session.AuthMethods = []string{models.AuthMethodPassword}
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}}
+	response, err := issueTokens(c, sessionController, user, session)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
+		return
 	}
 
-	c.IndentedJSON(http.StatusOK, loginresponse{
-		AuthToken:        authTokenString,
-		AuthTokenDetails: authTokenDetails,
-	})
+	c.IndentedJSON(http.StatusOK, response)
 }
 
 // auth/register
@@ -119,40 +155,27 @@ func register(c *gin.Context) {
 		return
 	}
 
-	authTokenExpiration := time.Now().Add(time.Minute * 30)
-	authTokenString, err := models.MintToken(addedUser.ID, addedUser.UserRoles, authTokenExpiration)
-	if err != nil {
-		log.Printf("routes > auth.go > register > failed to mint auth token")
-		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
+	sendVerificationEmail(env, addedUser)
+	if requireVerifiedEmail() {
+		// the user signs in once they have verified their address
+		c.IndentedJSON(http.StatusAccepted, verificationpendingresponse{Message: "a verification email has been sent, verify your address to sign in"})
 		return
 	}
 
-	refreshTokenExpiration := time.Now().Add(time.Hour * 168) // 1 week
-	refreshTokenString, err := models.MintToken(addedUser.ID, addedUser.UserRoles, refreshTokenExpiration)
-	if err != nil {
-		log.Printf("routes > auth.go > register > failed to mint refresh token")
-		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
-		return
-	}
+	session := newSession(c, addedUser.ID, "")
+	session.AuthMethods = []string{models.AuthMethodPassword}
 
-	err = repo.UpdateRefreshToken(addedUser.ID, refreshTokenString)
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}}
+	response, err := issueTokens(c, sessionController, addedUser, session)
 	if err != nil {
-		log.Printf("routes > auth.go > register > failed to update refresh token")
-		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
 		return
 	}
 
-	authTokenDetails := models.ClientReadableToken{
-		ExpiresAt: authTokenExpiration.Unix(),
-		UserRoles: addedUser.UserRoles,
-	}
-
-	c.IndentedJSON(http.StatusOK, loginresponse{
-		AuthToken:        authTokenString,
-		AuthTokenDetails: authTokenDetails,
-	})
+	c.IndentedJSON(http.StatusOK, response)
 }
 
+// auth/refreshtoken
 func refreshAuthToken(c *gin.Context) {
 	env, ok := c.MustGet("env").(models.Env)
 	if !ok {
@@ -161,60 +184,179 @@ func refreshAuthToken(c *gin.Context) {
 		return
 	}
 
-	currentAuthTokenString, err := utils.GetBearerTokenFromContext(c)
-	if err != nil {
+	presentedRefreshToken := getPresentedRefreshToken(c)
+	if presentedRefreshToken == "" {
 		c.IndentedJSON(http.StatusUnauthorized, models.ErrResponseForHttpStatus(http.StatusUnauthorized))
 		return
 	}
 
-	currentAuthToken, claims, _ := models.ValidateToken(currentAuthTokenString)
+	sessionController := controllers.SessionController{
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		LogoutNotifier:    newLogoutNotifier(env),
+	}
 
-	if currentAuthToken == nil {
-		log.Printf("err: %s", err.Error())
+	// tokens issued to OAuth clients are refreshed at the token endpoint
+	user, _, tokens, err := sessionController.RefreshSession(models.Client{}, presentedRefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err == controllers.ErrInvalidRefreshToken || err == controllers.ErrRefreshTokenReused {
+		log.Printf("routes > auth.go > refreshAuthToken > %s > reauthentication needed", err.Error())
 		c.IndentedJSON(http.StatusUnauthorized, models.ErrResponseForHttpStatus(http.StatusUnauthorized))
 		return
 	}
-
-	userID, err := strconv.Atoi(claims.Subject)
 	if err != nil {
-		log.Printf("routes > auth.go > refreshAuthToken > invalid user ID %s\n", claims.Subject)
-		c.IndentedJSON(http.StatusUnauthorized, models.ErrResponseForHttpStatus(http.StatusUnauthorized))
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
 		return
 	}
 
-	repo := repositories.UserRepository{DBConn: env.DB}
+	c.IndentedJSON(http.StatusOK, newLoginResponse(c, user, tokens))
+}
 
-	refreshTokenStr, err := repo.GetRefreshToken(userID)
-	if err != nil {
-		log.Printf("routes > auth.go > refreshAuthToken > could not get refresh token")
+// auth/logout
+func logout(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > auth.go > logout > env not accessible")
 		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
 		return
 	}
 
-	_, _, err = models.ValidateToken(refreshTokenStr)
-	if err != nil {
-		log.Printf("routes > auth.go > refreshAuthToken > invalid refresh token > reauthentication needed")
+	sessionRepo := repositories.SessionRepository{DBConn: env.DB}
+
+	// the session to end is identified by its refresh token, or failing
+	// that by the session of the caller's access token, which has to be one
+	// issued to the user rather than any token naming a session
+	var sessionID string
+	if presentedRefreshToken := getPresentedRefreshToken(c); presentedRefreshToken != "" {
+		session, err := sessionRepo.GetSessionByRefreshTokenHash(utils.HashToken(presentedRefreshToken))
+		if err == nil {
+			sessionID = session.ID
+		}
+	}
+	var authClaims *models.TokenClaims
+	if authTokenStr, err := utils.GetBearerTokenFromContext(c); err == nil {
+		tokenController := controllers.TokenController{
+			UserRepository:    repositories.UserRepository{DBConn: env.DB},
+			SessionRepository: sessionRepo,
+			Denylist:          env.Denylist,
+		}
+		claims, err := tokenController.ValidateFirstPartyAccessToken(authTokenStr)
+		if err == controllers.ErrTokenStateUnavailable {
+			c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+			return
+		}
+		if err == nil {
+			authClaims = &claims
+			if sessionID == "" {
+				sessionID = claims.SessionID
+			}
+		}
+	}
+	if sessionID == "" {
 		c.IndentedJSON(http.StatusUnauthorized, models.ErrResponseForHttpStatus(http.StatusUnauthorized))
 		return
 	}
 
-	newAuthTokenExpiration := time.Now().Add(time.Minute * 30)
-	newAuthToken, err := models.MintToken(userID, claims.UserRoles, newAuthTokenExpiration)
+	// the clients signed in from this session are signed out along with it
+	session, err := sessionRepo.GetSessionByID(sessionID)
+	if err == nil {
+		sessionController := controllers.SessionController{SessionRepository: sessionRepo, LogoutNotifier: newLogoutNotifier(env)}
+		if _, err := sessionController.EndSession(session); err != nil {
+			log.Printf("routes > auth.go > logout > could not end session %s", sessionID)
+			c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+			return
+		}
+	}
+
+	// the access token would otherwise stay usable until it expires
+	if authClaims != nil && authClaims.ExpiresAt != nil {
+		if err := env.Denylist.RevokeToken(authClaims.ID, authClaims.ExpiresAt.Time); err != nil {
+			log.Printf("routes > auth.go > logout > could not revoke auth token %s", authClaims.ID)
+		}
+	}
+
+	utils.ClearRefreshTokenCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// auth/logout-all
+func logoutAll(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > auth.go > logoutAll > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	claims := c.MustGet("claims").(models.TokenClaims)
+	userID, err := claims.UserID()
 	if err != nil {
-		log.Printf("routes > auth.go > refreshAuthToken > could not mint new token")
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		return
+	}
+
+	sessionController := controllers.SessionController{
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		LogoutNotifier:    newLogoutNotifier(env),
+	}
+
+	if err := sessionController.RevokeAllSessions(userID); err != nil {
+		log.Printf("routes > auth.go > logoutAll > could not revoke sessions for user ID %d", userID)
 		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
 		return
 	}
 
-	authTokenDetails := models.ClientReadableToken{
-		ExpiresAt: newAuthTokenExpiration.Unix(),
-		UserRoles: claims.UserRoles,
+	utils.ClearRefreshTokenCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// getPresentedRefreshToken returns the refresh token sent in the request body,
+// or in the cookie set at login for browser clients.
+func getPresentedRefreshToken(c *gin.Context) string {
+	var requestBody refreshrequestbody
+	_ = c.ShouldBindJSON(&requestBody)
+
+	if requestBody.RefreshToken != "" {
+		return requestBody.RefreshToken
 	}
 
-	c.IndentedJSON(http.StatusOK, loginresponse{
-		AuthToken:        newAuthToken,
-		AuthTokenDetails: authTokenDetails,
-	})
+	refreshToken, _ := utils.GetRefreshTokenCookieFromContext(c)
+	return refreshToken
+}
+
+func newSession(c *gin.Context, userID int, deviceLabel string) models.Session {
+	return models.Session{
+		UserID:      userID,
+		DeviceLabel: deviceLabel,
+		UserAgent:   c.Request.UserAgent(),
+		IPAddress:   c.ClientIP(),
+	}
+}
+
+// issueTokens mints a new auth/refresh token pair for the session.
+func issueTokens(c *gin.Context, sessionController controllers.SessionController, user models.User, session models.Session) (loginresponse, error) {
+	tokens, err := sessionController.IssueTokens(user, session)
+	if err != nil {
+		return loginresponse{}, err
+	}
+
+	return newLoginResponse(c, user, tokens), nil
+}
+
+// newLoginResponse returns the tokens issued to a first party client and sets
+// the refresh token as an HttpOnly cookie for browser clients.
+func newLoginResponse(c *gin.Context, user models.User, tokens models.TokenPair) loginresponse {
+	utils.SetRefreshTokenCookie(c, tokens.RefreshToken, tokens.RefreshTokenExpiresAt)
+
+	return loginresponse{
+		AuthToken: tokens.AccessToken,
+		AuthTokenDetails: models.ClientReadableToken{
+			ExpiresAt: tokens.AccessTokenExpiresAt.Unix(),
+			UserRoles: user.UserRoles,
+		},
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt.Unix(),
+	}
 }
 
 func (body loginrequestbody) validate() []string {
@@ -0,0 +1,309 @@
+package routes
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type authorizationrequest struct {
+	ResponseType        string `form:"response_type"`
+	ClientID            string `form:"client_id"`
+	RedirectURI         string `form:"redirect_uri"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+	Nonce               string `form:"nonce"`
+}
+
+// oauth/authorize
+func authorize(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > authorize.go > authorize > env not accessible")
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "internal server error"})
+		return
+	}
+
+	var request authorizationrequest
+	_ = c.ShouldBind(&request)
+
+	// errors about the client or redirect URI must not be sent to the redirect URI
+	clientRepo := repositories.ClientRepository{DBConn: env.DB}
+	client, err := clientRepo.GetClientByID(request.ClientID)
+	if err != nil {
+		renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "Unknown client."})
+		return
+	}
+
+	redirectURI := request.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !client.HasRedirectURI(redirectURI) {
+		renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "The redirect URI is not registered for this client."})
+		return
+	}
+
+	if errCode, description := request.validate(client); errCode != "" {
+		redirectWithParams(c, redirectURI, map[string]string{"error": errCode, "error_description": description, "state": request.State})
+		return
+	}
+
+	user, browserSession, ok := authenticateBrowserUser(c, env, client.Name, request.params())
+	if !ok {
+		return
+	}
+
+	consentController := controllers.ConsentController{
+		ConsentRepository: repositories.ConsentRepository{DBConn: env.DB},
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+	}
+	if !consentController.HasConsent(user.ID, client, request.Scope) {
+		decision := c.PostForm("decision")
+		if decision == "" {
+			renderHTML(c, http.StatusOK, "consent.html", consentpage{
+				ClientName: client.Name,
+				Scopes:     strings.Fields(request.Scope),
+				CSRFToken:  csrfToken(browserSession.ID),
+				Action:     c.Request.URL.Path,
+				Params:     request.params(),
+			})
+			return
+		}
+
+		if !validCSRFToken(c, browserSession.ID) {
+			renderHTML(c, http.StatusForbidden, "error.html", errorpage{Message: "The request could not be verified, please try again."})
+			return
+		}
+		if decision != "approve" {
+			redirectWithParams(c, redirectURI, map[string]string{"error": "access_denied", "error_description": "the user denied the request", "state": request.State})
+			return
+		}
+
+		if err := consentController.GrantConsent(user.ID, client.ID, request.Scope); err != nil {
+			redirectWithParams(c, redirectURI, map[string]string{"error": "server_error", "state": request.State})
+			return
+		}
+	}
+
+	codeController := controllers.AuthorizationCodeController{AuthorizationCodeRepository: repositories.AuthorizationCodeRepository{DBConn: env.DB}}
+	code, err := codeController.IssueAuthorizationCode(models.AuthorizationCode{
+		ClientID:            client.ID,
+		UserID:              user.ID,
+		RedirectURI:         request.RedirectURI,
+		Scope:               request.Scope,
+		CodeChallenge:       request.CodeChallenge,
+		CodeChallengeMethod: request.CodeChallengeMethod,
+		Nonce:               request.Nonce,
+		AuthTime:            browserSession.CreatedAt,
+		SessionID:           browserSession.ID,
+	})
+	if err != nil {
+		redirectWithParams(c, redirectURI, map[string]string{"error": "server_error", "state": request.State})
+		return
+	}
+
+	redirectWithParams(c, redirectURI, map[string]string{"code": code, "state": request.State})
+}
+
+// authenticateBrowserUser returns the user signed in to the authorization
+// pages with the authtoken cookie, along with their session. Otherwise it
+// shows the login form, which posts back to the current page along with
+// params, and signs the user in once the form is submitted with valid
+// credentials, followed by a code from their authenticator if they use MFA.
+// The form carries a CSRF token bound to the loginnonce cookie, so other
+// sites cannot sign the browser in to an account of theirs.
+func authenticateBrowserUser(c *gin.Context, env models.Env, clientName string, params map[string]string) (models.User, models.Session, bool) {
+	userController := controllers.UserController{UserRepository: repositories.UserRepository{DBConn: env.DB}}
+	sessionRepo := repositories.SessionRepository{DBConn: env.DB}
+	page := loginpage{ClientName: clientName, Action: c.Request.URL.Path, Params: params}
+
+	if c.Request.Method != http.MethodPost || (c.PostForm("email") == "" && c.PostForm("mfa_token") == "") {
+		if user, session, _, err := getBrowserUser(c, env, userController, sessionRepo); err == nil {
+			return user, session, true
+		}
+
+		loginNonce, err := utils.GetLoginNonceCookieFromContext(c)
+		if err != nil || loginNonce == "" {
+			loginNonce, err = utils.GenerateRandomString(32)
+			if err != nil {
+				log.Printf("routes > authorize.go > authenticateBrowserUser > failed to generate login nonce")
+				renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not sign you in, please try again."})
+				return models.User{}, models.Session{}, false
+			}
+			utils.SetLoginNonceCookie(c, loginNonce)
+		}
+
+		page.CSRFToken = csrfToken(loginNonce)
+		renderHTML(c, http.StatusOK, "login.html", page)
+		return models.User{}, models.Session{}, false
+	}
+
+	loginNonce, _ := utils.GetLoginNonceCookieFromContext(c)
+	if !validCSRFToken(c, loginNonce) {
+		renderHTML(c, http.StatusForbidden, "error.html", errorpage{Message: "The request could not be verified, please try again."})
+		return models.User{}, models.Session{}, false
+	}
+	page.CSRFToken = csrfToken(loginNonce)
+
+	var user models.User
+	var authMethods []string
+	mfaController := newMFAController(env)
+	if mfaToken := c.PostForm("mfa_token"); mfaToken != "" {
+		var err error
+		user, authMethods, _, err = mfaController.CompleteChallenge(mfaToken, c.PostForm("code"))
+		if err != nil {
+			// each challenge allows one attempt, so the user signs in again
+			page.Error = "Invalid or expired code, please sign in again."
+			renderHTML(c, http.StatusUnauthorized, "login.html", page)
+			return models.User{}, models.Session{}, false
+		}
+	} else {
+		var err error
+		user, err = userController.GetUserWithCredentials(c.PostForm("email"), c.PostForm("password"))
+		if err != nil {
+			page.Error = "Invalid email or password."
+			renderHTML(c, http.StatusUnauthorized, "login.html", page)
+			return models.User{}, models.Session{}, false
+		}
+		if requireVerifiedEmail() && !user.EmailVerified {
+			page.Error = "Verify your email address before signing in."
+			renderHTML(c, http.StatusForbidden, "login.html", page)
+			return models.User{}, models.Session{}, false
+		}
+
+		mfaEnabled, err := mfaController.MFAEnabled(user.ID)
+		if err != nil {
+			renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not sign you in, please try again."})
+			return models.User{}, models.Session{}, false
+		}
+		if mfaEnabled {
+			page.MFAToken, _, err = mfaController.StartChallenge(user, "Browser")
+			if err != nil {
+				renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not sign you in, please try again."})
+				return models.User{}, models.Session{}, false
+			}
+
+			renderHTML(c, http.StatusOK, "login.html", page)
+			return models.User{}, models.Session{}, false
+		}
+		authMethods = []string{models.AuthMethodPassword}
+	}
+
+	session := newSession(c, user.ID, "Browser")
+	session.AuthMethods = authMethods
+	sessionController := controllers.SessionController{SessionRepository: sessionRepo}
+	tokens, err := sessionController.IssueTokens(user, session)
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not sign you in, please try again."})
+		return models.User{}, models.Session{}, false
+	}
+
+	utils.SetAuthTokenCookie(c, tokens.AccessToken, tokens.AccessTokenExpiresAt)
+	utils.SetRefreshTokenCookie(c, tokens.RefreshToken, tokens.RefreshTokenExpiresAt)
+
+	session.ID = tokens.SessionID
+	session.CreatedAt = time.Now()
+
+	return user, session, true
+}
+
+// getBrowserUser returns the user of the authtoken cookie, the session it
+// belongs to, which must not have been revoked, and the cookie's claims.
+func getBrowserUser(c *gin.Context, env models.Env, userController controllers.UserController, sessionRepo repositories.SessionRepository) (models.User, models.Session, models.TokenClaims, error) {
+	authTokenStr, err := utils.GetAuthTokenCookieFromContext(c)
+	if err != nil {
+		return models.User{}, models.Session{}, models.TokenClaims{}, err
+	}
+
+	tokenController := controllers.TokenController{UserRepository: userController.UserRepository, SessionRepository: sessionRepo, Denylist: env.Denylist}
+	claims, err := tokenController.ValidateFirstPartyAccessToken(authTokenStr)
+	if err != nil {
+		return models.User{}, models.Session{}, models.TokenClaims{}, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return models.User{}, models.Session{}, models.TokenClaims{}, err
+	}
+
+	session, err := sessionRepo.GetSessionByID(claims.SessionID)
+	if err != nil || session.UserID != userID {
+		return models.User{}, models.Session{}, models.TokenClaims{}, fmt.Errorf("session not found")
+	}
+
+	user, err := userController.GetUserByID(userID)
+	if err != nil {
+		return models.User{}, models.Session{}, models.TokenClaims{}, err
+	}
+
+	return user, session, claims, nil
+}
+
+// redirectWithParams redirects the browser back to a client, adding params
+// with non-empty values to the redirect URI's query.
+func redirectWithParams(c *gin.Context, redirectURI string, params map[string]string) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "The redirect URI is invalid."})
+		return
+	}
+
+	query := u.Query()
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// validate returns the RFC 6749 error code for an invalid request. PKCE with
+// S256 is required for every client, as recommended by the OAuth 2.0
+// Security BCP.
+func (request authorizationrequest) validate(client models.Client) (string, string) {
+	if request.ResponseType != "code" {
+		return "unsupported_response_type", "only the code response type is supported"
+	}
+	if !client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		return "unauthorized_client", "the client is not allowed to use the authorization code grant"
+	}
+	if !client.AllowsScope(request.Scope) {
+		return "invalid_scope", "the client is not allowed to request this scope"
+	}
+	if request.CodeChallenge == "" {
+		return "invalid_request", "missing required parameter: code_challenge"
+	}
+	if request.CodeChallengeMethod != "S256" {
+		return "invalid_request", "code_challenge_method must be S256"
+	}
+
+	return "", ""
+}
+
+// params returns the request as hidden form fields for the login page.
+func (request authorizationrequest) params() map[string]string {
+	return map[string]string{
+		"response_type":         request.ResponseType,
+		"client_id":             request.ClientID,
+		"redirect_uri":          request.RedirectURI,
+		"scope":                 request.Scope,
+		"state":                 request.State,
+		"code_challenge":        request.CodeChallenge,
+		"code_challenge_method": request.CodeChallengeMethod,
+		"nonce":                 request.Nonce,
+	}
+}
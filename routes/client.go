@@ -0,0 +1,196 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type clientrequestbody struct {
+	Name                  string   `json:"client_name"`
+	Confidential          bool     `json:"confidential"`
+	RedirectURIs          []string `json:"redirect_uris"`
+	GrantTypes            []string `json:"grant_types"`
+	Scopes                []string `json:"scopes"`
+	AccessTokenLifetime   int      `json:"access_token_lifetime"`
+	RefreshTokenLifetime  int      `json:"refresh_token_lifetime"`
+	FirstParty            bool     `json:"first_party"`
+	AllowedAudiences      []string `json:"allowed_audiences"`
+	SubjectType           string   `json:"subject_type"`
+	SectorIdentifier      string   `json:"sector_identifier"`
+	BackchannelLogoutURI  string   `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI string   `json:"frontchannel_logout_uri"`
+}
+
+type clientresponse struct {
+	models.Client
+	Confidential bool   `json:"confidential"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// admin/clients
+func getClients(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > getClients > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	clients, err := controller.GetClients()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	response := []clientresponse{}
+	for _, client := range clients {
+		response = append(response, newClientResponse(client, ""))
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// admin/clients
+func addClient(c *gin.Context) {
+	var requestBody clientrequestbody
+	if err := c.BindJSON(&requestBody); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > addClient > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	client, clientSecret, errResp := controller.AddClient(requestBody.client(""), requestBody.Confidential)
+	if errResp.ErrorMessage != "" {
+		c.IndentedJSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, newClientResponse(client, clientSecret))
+}
+
+// admin/clients/:id
+func getClient(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > getClient > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	client, err := controller.GetClientByID(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newClientResponse(client, ""))
+}
+
+// admin/clients/:id
+func updateClient(c *gin.Context) {
+	var requestBody clientrequestbody
+	if err := c.BindJSON(&requestBody); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > updateClient > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	if _, err := controller.GetClientByID(c.Param("id")); err != nil {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+
+	client, errResp := controller.UpdateClient(requestBody.client(c.Param("id")))
+	if errResp.ErrorMessage != "" {
+		c.IndentedJSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newClientResponse(client, ""))
+}
+
+// admin/clients/:id/secret
+func rotateClientSecret(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > rotateClientSecret > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	client, err := controller.GetClientByID(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+
+	clientSecret, err := controller.RotateClientSecret(client.ID)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newClientResponse(client, clientSecret))
+}
+
+// admin/clients/:id
+func deleteClient(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > client.go > deleteClient > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	if err := controller.DeleteClient(c.Param("id")); err != nil {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (requestBody clientrequestbody) client(id string) models.Client {
+	return models.Client{
+		ID:                    id,
+		Name:                  requestBody.Name,
+		RedirectURIs:          requestBody.RedirectURIs,
+		GrantTypes:            requestBody.GrantTypes,
+		Scopes:                requestBody.Scopes,
+		AccessTokenLifetime:   requestBody.AccessTokenLifetime,
+		RefreshTokenLifetime:  requestBody.RefreshTokenLifetime,
+		FirstParty:            requestBody.FirstParty,
+		AllowedAudiences:      requestBody.AllowedAudiences,
+		SubjectType:           requestBody.SubjectType,
+		SectorIdentifier:      requestBody.SectorIdentifier,
+		BackchannelLogoutURI:  requestBody.BackchannelLogoutURI,
+		FrontchannelLogoutURI: requestBody.FrontchannelLogoutURI,
+	}
+}
+
+func newClientResponse(client models.Client, clientSecret string) clientresponse {
+	return clientresponse{Client: client, Confidential: !client.IsPublic(), ClientSecret: clientSecret}
+}
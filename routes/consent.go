@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AddConsentRoutes(rg *gin.RouterGroup) {
+	consentGroup := rg.Group("/auth/consents", middleware.FirstPartyTokenAuth())
+
+	consentGroup.GET("", getConsents)
+	consentGroup.DELETE("/:client_id", revokeConsent)
+}
+
+// auth/consents
+func getConsents(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > consent.go > getConsents > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	controller := controllers.ConsentController{ConsentRepository: repositories.ConsentRepository{DBConn: env.DB}}
+	consents, err := controller.GetConsentsForUser(userID)
+	if err != nil {
+		log.Printf("routes > consent.go > getConsents > could not get consents for user ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, consents)
+}
+
+// auth/consents/:client_id
+func revokeConsent(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > consent.go > revokeConsent > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	controller := controllers.ConsentController{
+		ConsentRepository: repositories.ConsentRepository{DBConn: env.DB},
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		LogoutNotifier:    newLogoutNotifier(env),
+	}
+	err := controller.RevokeConsent(userID, c.Param("client_id"))
+	if err == controllers.ErrConsentNotFound {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		log.Printf("routes > consent.go > revokeConsent > failed to revoke consent of user ID %d: %s", userID, err.Error())
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
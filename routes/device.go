@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type deviceauthorizationresponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// oauth/device/code
+func deviceAuthorization(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > device.go > deviceAuthorization > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, ok := authenticateClient(c, env, true)
+	if !ok {
+		return
+	}
+	if !client.AllowsGrantType(models.GrantTypeDeviceCode) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use the device authorization grant")
+		return
+	}
+
+	scope := c.PostForm("scope")
+	if !client.AllowsScope(scope) {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", "the client is not allowed to request this scope")
+		return
+	}
+
+	controller := controllers.DeviceAuthorizationController{DeviceAuthorizationRepository: repositories.DeviceAuthorizationRepository{DBConn: env.DB}}
+	deviceCode, authorization, err := controller.StartDeviceAuthorization(client, scope)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	// the verification page is served next to this endpoint
+	verificationURI := utils.GetBaseURL(c) + strings.TrimSuffix(c.Request.URL.Path, "/code")
+	userCode := models.FormatUserCode(authorization.UserCode)
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, deviceauthorizationresponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int64(time.Until(authorization.ExpiresAt).Round(time.Second).Seconds()),
+		Interval:                authorization.PollInterval,
+	})
+}
+
+// oauth/device
+func verifyDevice(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > device.go > verifyDevice > env not accessible")
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "internal server error"})
+		return
+	}
+
+	userCode := c.DefaultPostForm("user_code", c.Query("user_code"))
+
+	user, browserSession, ok := authenticateBrowserUser(c, env, "", map[string]string{"user_code": userCode})
+	if !ok {
+		return
+	}
+
+	page := devicepage{Action: c.Request.URL.Path}
+	if userCode == "" {
+		renderHTML(c, http.StatusOK, "device.html", page)
+		return
+	}
+
+	controller := controllers.DeviceAuthorizationController{DeviceAuthorizationRepository: repositories.DeviceAuthorizationRepository{DBConn: env.DB}}
+	authorization, err := controller.GetPendingDeviceAuthorization(userCode)
+	if err != nil {
+		page.Error = "That code is invalid or has expired."
+		renderHTML(c, http.StatusBadRequest, "device.html", page)
+		return
+	}
+
+	decision := c.PostForm("decision")
+	if decision == "" {
+		clientRepo := repositories.ClientRepository{DBConn: env.DB}
+		client, err := clientRepo.GetClientByID(authorization.ClientID)
+		if err != nil {
+			renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "Unknown client."})
+			return
+		}
+
+		page.ClientName = client.Name
+		page.Scope = authorization.Scope
+		page.UserCode = models.FormatUserCode(authorization.UserCode)
+		page.CSRFToken = csrfToken(browserSession.ID)
+		renderHTML(c, http.StatusOK, "device.html", page)
+		return
+	}
+
+	if !validCSRFToken(c, browserSession.ID) {
+		renderHTML(c, http.StatusForbidden, "error.html", errorpage{Message: "The request could not be verified, please try again."})
+		return
+	}
+
+	approved := decision == "approve"
+	if err := controller.ResolveDeviceAuthorization(authorization.UserCode, user.ID, approved); err != nil {
+		page.Error = "That code is invalid or has expired."
+		renderHTML(c, http.StatusBadRequest, "device.html", page)
+		return
+	}
+
+	if !approved {
+		renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Request denied", Message: "The device was not connected to your account."})
+		return
+	}
+
+	renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Device connected", Message: "You can return to your device."})
+}
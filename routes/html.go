@@ -0,0 +1,117 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"embed"
+	"html/template"
+	"jwt-auth-service/utils"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+type loginpage struct {
+	ClientName string
+	Error      string
+	Action     string
+	Params     map[string]string
+	CSRFToken  string
+	MFAToken   string // set once the password was accepted, asking for a code
+}
+
+type errorpage struct {
+	Message string
+}
+
+type messagepage struct {
+	Title   string
+	Message string
+}
+
+type consentpage struct {
+	ClientName string
+	Scopes     []string
+	CSRFToken  string
+	Action     string
+	Params     map[string]string
+}
+
+type logoutpage struct {
+	SignedOut              bool
+	CSRFToken              string
+	Action                 string
+	FrontchannelLogoutURLs []string
+}
+
+type passwordresetpage struct {
+	Token  string
+	Error  string
+	Action string
+}
+
+type devicepage struct {
+	ClientName string
+	Scope      string
+	UserCode   string
+	CSRFToken  string
+	Error      string
+	Action     string
+}
+
+// renderHTML renders one of the embedded templates. Pages that take
+// credentials or approvals must not be framed by other sites.
+func renderHTML(c *gin.Context, status int, name string, data interface{}) {
+	renderHTMLWithFrames(c, status, name, data, nil)
+}
+
+// renderHTMLWithFrames works like renderHTML for pages that load the given
+// URLs in iframes, allowing their origins in the content security policy.
+func renderHTMLWithFrames(c *gin.Context, status int, name string, data interface{}, frameURLs []string) {
+	contentSecurityPolicy := "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+	var frameSources []string
+	for _, frameURL := range frameURLs {
+		if u, err := url.Parse(frameURL); err == nil && u.Scheme != "" && u.Host != "" {
+			frameSources = append(frameSources, u.Scheme+"://"+u.Host)
+		}
+	}
+	if len(frameSources) > 0 {
+		contentSecurityPolicy += "; frame-src " + strings.Join(frameSources, " ")
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", contentSecurityPolicy)
+	c.Status(status)
+
+	if err := templates.ExecuteTemplate(c.Writer, name, data); err != nil {
+		log.Printf("routes > html.go > renderHTML > could not render %s: %s", name, err.Error())
+	}
+}
+
+// csrfToken returns the token forms that approve something on behalf of the
+// signed in user must include. It is a keyed hash of the browser's session ID,
+// or of the login nonce before the user signs in, so it cannot be computed
+// by clients that learn the session ID from an ID token. No token is returned
+// when no key is configured, which fails every form.
+func csrfToken(sessionID string) string {
+	token, err := utils.KeyedHash("csrf", sessionID)
+	if err != nil {
+		log.Printf("routes > html.go > csrfToken > could not derive CSRF token: %s", err.Error())
+		return ""
+	}
+
+	return token
+}
+
+func validCSRFToken(c *gin.Context, sessionID string) bool {
+	expected := csrfToken(sessionID)
+	return sessionID != "" && expected != "" && subtle.ConstantTimeCompare([]byte(c.PostForm("csrf_token")), []byte(expected)) == 1
+}
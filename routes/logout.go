@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backchannelHTTPClient delivers logout tokens. Clients that hang must not
+// hold up the retries for long.
+var backchannelHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+// publicBackchannelHTTPClient delivers logout tokens to self registered
+// clients, which must not get the service to reach its internal network.
+var publicBackchannelHTTPClient = utils.NewPublicHTTPClient(time.Second * 10)
+
+// newLogoutNotifier returns the notifier that tells clients about ended
+// sessions over the back channel.
+func newLogoutNotifier(env models.Env) controllers.LogoutNotifier {
+	return controllers.BackchannelLogout{
+		ClientRepository: repositories.ClientRepository{DBConn: env.DB},
+		UserRepository:   repositories.UserRepository{DBConn: env.DB},
+		HTTPClient:       backchannelHTTPClient,
+		PublicHTTPClient: publicBackchannelHTTPClient,
+		RetryDelays:      controllers.DefaultBackchannelRetryDelays,
+	}
+}
+
+// oauth/logout
+//
+// The end session endpoint signs the browser out of the service and of the
+// clients it signed in to. Clients with a backchannel logout URI are told
+// directly, and those with a frontchannel logout URI are loaded in hidden
+// iframes on the page shown afterwards (OpenID Connect Front-Channel Logout
+// 1.0). Signing out needs a confirmation, so other sites cannot sign the
+// user out.
+func endSession(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > logout.go > endSession > env not accessible")
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "internal server error"})
+		return
+	}
+
+	userController := controllers.UserController{UserRepository: repositories.UserRepository{DBConn: env.DB}}
+	sessionRepo := repositories.SessionRepository{DBConn: env.DB}
+
+	_, browserSession, authClaims, err := getBrowserUser(c, env, userController, sessionRepo)
+	if err != nil {
+		renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Signed out", Message: "You are not signed in."})
+		return
+	}
+
+	if c.Request.Method != http.MethodPost {
+		renderHTML(c, http.StatusOK, "logout.html", logoutpage{CSRFToken: csrfToken(browserSession.ID), Action: c.Request.URL.Path})
+		return
+	}
+	if !validCSRFToken(c, browserSession.ID) {
+		renderHTML(c, http.StatusForbidden, "error.html", errorpage{Message: "The request could not be verified, please try again."})
+		return
+	}
+
+	sessionController := controllers.SessionController{SessionRepository: sessionRepo, LogoutNotifier: newLogoutNotifier(env)}
+	endedSessions, err := sessionController.EndSession(browserSession)
+	if err != nil {
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not sign you out, please try again."})
+		return
+	}
+
+	// the auth token would otherwise stay usable until it expires
+	if authClaims.ExpiresAt != nil {
+		if err := env.Denylist.RevokeToken(authClaims.ID, authClaims.ExpiresAt.Time); err != nil {
+			log.Printf("routes > logout.go > endSession > could not revoke auth token %s", authClaims.ID)
+		}
+	}
+	utils.ClearAuthTokenCookie(c)
+	utils.ClearRefreshTokenCookie(c)
+
+	frontchannelLogoutURLs := getFrontchannelLogoutURLs(env, endedSessions)
+	renderHTMLWithFrames(c, http.StatusOK, "logout.html", logoutpage{SignedOut: true, FrontchannelLogoutURLs: frontchannelLogoutURLs}, frontchannelLogoutURLs)
+}
+
+// getFrontchannelLogoutURLs returns the frontchannel logout URIs of the
+// clients of the ended sessions, with the iss and sid parameters that tell
+// the client which session ended.
+func getFrontchannelLogoutURLs(env models.Env, sessions []models.Session) []string {
+	clientRepo := repositories.ClientRepository{DBConn: env.DB}
+
+	var logoutURLs []string
+	seen := map[string]bool{}
+	for _, session := range sessions {
+		if session.ClientID == "" || seen[session.ClientID] {
+			continue
+		}
+		seen[session.ClientID] = true
+
+		client, err := clientRepo.GetClientByID(session.ClientID)
+		if err != nil || client.FrontchannelLogoutURI == "" {
+			continue
+		}
+
+		u, err := url.Parse(client.FrontchannelLogoutURI)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		query.Set("iss", models.TokenIssuer())
+		if session.ParentSessionID != "" {
+			query.Set("sid", session.ParentSessionID)
+		}
+		u.RawQuery = query.Encode()
+
+		logoutURLs = append(logoutURLs, u.String())
+	}
+
+	return logoutURLs
+}
@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"encoding/base64"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+type mfacoderequestbody struct {
+	Code string `json:"code"`
+}
+
+type mfaloginrequestbody struct {
+	MFAToken string                    `json:"mfa_token"`
+	Code     string                    `json:"code"`
+	Passkey  *models.AssertionResponse `json:"passkey"`
+}
+
+type mfachallengeresponse struct {
+	MFARequired       bool                             `json:"mfa_required"`
+	MFAToken          string                           `json:"mfa_token"`
+	MFATokenExpiresAt int64                            `json:"mfa_token_expires_at"`
+	PasskeyOptions    *models.CredentialRequestOptions `json:"passkey_options,omitempty"` // set for users with passkeys
+}
+
+type mfastatusresponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+type totpenrollmentresponse struct {
+	Secret    string `json:"secret"`
+	KeyURI    string `json:"otpauth_uri"`
+	QRCodePNG string `json:"qr_code_png"` // base64 encoded
+}
+
+type recoverycodesresponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+var mfaErrorStatuses = map[error]int{
+	controllers.ErrInvalidMFACode:              http.StatusBadRequest,
+	controllers.ErrInvalidMFAChallenge:         http.StatusUnauthorized,
+	controllers.ErrMFAAlreadyEnabled:           http.StatusConflict,
+	controllers.ErrMFANotEnabled:               http.StatusConflict,
+	controllers.ErrMFARequiredForAdmins:        http.StatusForbidden,
+	controllers.ErrMFALocked:                   http.StatusTooManyRequests,
+	controllers.ErrMFAReauthenticationRequired: http.StatusForbidden,
+}
+
+func newMFAController(env models.Env) controllers.MFAController {
+	return controllers.MFAController{
+		MFARepository:  repositories.MFARepository{DBConn: env.DB},
+		UserRepository: repositories.UserRepository{DBConn: env.DB},
+		Denylist:       env.Denylist,
+		WebAuthn:       newWebAuthnController(env),
+	}
+}
+
+// writeMFAError responds with the status for an error of the MFA controller,
+// logging unexpected ones.
+func writeMFAError(c *gin.Context, handler string, err error) {
+	if status, ok := mfaErrorStatuses[err]; ok {
+		c.IndentedJSON(status, models.ErrorResponse{ErrorMessage: err.Error()})
+		return
+	}
+
+	log.Printf("routes > mfa.go > %s > %s", handler, err.Error())
+	c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+}
+
+// auth/login/mfa
+//
+// Completes a login started at auth/login for a user with MFA, exchanging the
+// MFA token and a code, or an assertion of one of the user's passkeys, for the
+// tokens login would have returned.
+func loginWithMFA(c *gin.Context) {
+	var requestBody mfaloginrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.MFAToken == "" || (requestBody.Code == "" && requestBody.Passkey == nil) {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > loginWithMFA > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	var user models.User
+	var authMethods []string
+	var deviceLabel string
+	var err error
+	if requestBody.Passkey != nil {
+		user, authMethods, deviceLabel, err = newMFAController(env).CompletePasskeyChallenge(requestBody.MFAToken, *requestBody.Passkey)
+	} else {
+		user, authMethods, deviceLabel, err = newMFAController(env).CompleteChallenge(requestBody.MFAToken, requestBody.Code)
+	}
+	if err == controllers.ErrInvalidMFACode || err == controllers.ErrInvalidPasskey {
+		// the challenge has been used up, so the user starts over
+		c.IndentedJSON(http.StatusUnauthorized, models.ErrorResponse{ErrorMessage: err.Error() + ", sign in again"})
+		return
+	}
+	if err != nil {
+		writeMFAError(c, "loginWithMFA", err)
+		return
+	}
+
+	session := newSession(c, user.ID, deviceLabel)
+	session.AuthMethods = authMethods
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}}
+	response, err := issueTokens(c, sessionController, user, session)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// account/mfa
+func getMFAStatus(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > getMFAStatus > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	enabled, err := newMFAController(env).MFAEnabled(userID)
+	if err != nil {
+		writeMFAError(c, "getMFAStatus", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, mfastatusresponse{Enabled: enabled})
+}
+
+// account/mfa/totp
+//
+// Starts setting up an authenticator app, which the user scans the QR code
+// into, or types the secret into, before confirming it with a code at
+// account/mfa/totp/confirm.
+func beginTOTPEnrollment(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > beginTOTPEnrollment > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := repositories.UserRepository{DBConn: env.DB}.GetUserByID(userID)
+	if err != nil {
+		log.Printf("routes > mfa.go > beginTOTPEnrollment > could not get user with ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	usedMFA := c.MustGet("claims").(models.TokenClaims).UsedMFA()
+	secret, keyURI, err := newMFAController(env).BeginTOTPEnrollment(user, usedMFA)
+	if err != nil {
+		writeMFAError(c, "beginTOTPEnrollment", err)
+		return
+	}
+
+	qrCode, err := qrcode.Encode(keyURI, qrcode.Medium, 256)
+	if err != nil {
+		log.Printf("routes > mfa.go > beginTOTPEnrollment > could not encode QR code: %s", err.Error())
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, totpenrollmentresponse{
+		Secret:    secret,
+		KeyURI:    keyURI,
+		QRCodePNG: base64.StdEncoding.EncodeToString(qrCode),
+	})
+}
+
+// account/mfa/totp/confirm
+func confirmTOTPEnrollment(c *gin.Context) {
+	var requestBody mfacoderequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Code == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > confirmTOTPEnrollment > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := newMFAController(env).ConfirmTOTPEnrollment(userID, requestBody.Code)
+	if err != nil {
+		writeMFAError(c, "confirmTOTPEnrollment", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, recoverycodesresponse{RecoveryCodes: recoveryCodes})
+}
+
+// account/mfa/totp
+func disableTOTP(c *gin.Context) {
+	var requestBody mfacoderequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Code == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > disableTOTP > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := repositories.UserRepository{DBConn: env.DB}.GetUserByID(userID)
+	if err != nil {
+		log.Printf("routes > mfa.go > disableTOTP > could not get user with ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	if err := newMFAController(env).DisableTOTP(user, requestBody.Code); err != nil {
+		writeMFAError(c, "disableTOTP", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// account/mfa/recovery-codes
+func regenerateRecoveryCodes(c *gin.Context) {
+	var requestBody mfacoderequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Code == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > mfa.go > regenerateRecoveryCodes > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := newMFAController(env).RegenerateRecoveryCodes(userID, requestBody.Code)
+	if err != nil {
+		writeMFAError(c, "regenerateRecoveryCodes", err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, recoverycodesresponse{RecoveryCodes: recoveryCodes})
+}
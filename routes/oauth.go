@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthPath is where AddOAuthRoutes mounted the OAuth endpoints, for the
+// links to them in the discovery document.
+var oauthPath = "/v1/oauth"
+
+func AddOAuthRoutes(rg *gin.RouterGroup) {
+	oauthGroup := rg.Group("/oauth")
+	oauthPath = oauthGroup.BasePath()
+
+	oauthGroup.GET("/authorize", authorize)
+	oauthGroup.POST("/authorize", authorize)
+	oauthGroup.POST("/token", oauthToken)
+	oauthGroup.POST("/device/code", deviceAuthorization)
+	oauthGroup.GET("/device", verifyDevice)
+	oauthGroup.POST("/device", verifyDevice)
+	oauthGroup.POST("/introspect", introspect)
+	oauthGroup.POST("/revoke", revoke)
+	oauthGroup.GET("/logout", endSession)
+	oauthGroup.POST("/logout", endSession)
+	oauthGroup.POST("/register", registerClient)
+	oauthGroup.GET("/register/:client_id", getRegistration)
+	oauthGroup.PUT("/register/:client_id", updateRegistration)
+	oauthGroup.DELETE("/register/:client_id", deleteRegistration)
+	oauthGroup.GET("/userinfo", middleware.BearerTokenAuth(), userInfo)
+	oauthGroup.POST("/userinfo", middleware.BearerTokenAuth(), userInfo)
+}
+
+// oauth/introspect
+func introspect(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > oauth.go > introspect > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if _, ok := authenticateClient(c, env, false); !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: token")
+		return
+	}
+
+	tokenController := controllers.TokenController{
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		ClientRepository:  repositories.ClientRepository{DBConn: env.DB},
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		Denylist:          env.Denylist,
+	}
+
+	introspection, err := tokenController.IntrospectToken(token, c.PostForm("token_type_hint"))
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, introspection)
+}
+
+// oauth/revoke
+func revoke(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > oauth.go > revoke > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, ok := authenticateClient(c, env, true)
+	if !ok {
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: token")
+		return
+	}
+
+	tokenController := controllers.TokenController{
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		Denylist:          env.Denylist,
+	}
+	if err := tokenController.RevokeToken(client, token, c.PostForm("token_type_hint")); err != nil {
+		oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+
+	// RFC 7009 responds with 200 for invalid and unknown tokens too
+	c.Status(http.StatusOK)
+}
+
+// authenticateClient checks the calling client's credentials, writing the
+// invalid_client error response if they are missing or wrong. Public clients
+// are identified by their client ID alone when allowPublic is set.
+func authenticateClient(c *gin.Context, env models.Env, allowPublic bool) (models.Client, bool) {
+	clientID, clientSecret, ok := utils.GetClientCredentialsFromContext(c)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="jwt-auth-service"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "client authentication required")
+		return models.Client{}, false
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	authenticate := controller.AuthenticateClient
+	if allowPublic {
+		authenticate = controller.IdentifyClient
+	}
+
+	client, err := authenticate(clientID, clientSecret)
+	if err != nil && err != controllers.ErrInvalidClientCredentials {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return models.Client{}, false
+	}
+	if err != nil {
+		log.Printf("routes > oauth.go > authenticateClient > client %s failed authentication", clientID)
+		c.Header("WWW-Authenticate", `Basic realm="jwt-auth-service"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", err.Error())
+		return models.Client{}, false
+	}
+
+	return client, true
+}
+
+func oauthError(c *gin.Context, status int, errorCode string, description string) {
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(status, models.OAuthErrorResponse{Error: errorCode, ErrorDescription: description})
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type openidconfiguration struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	UserinfoEndpoint                   string   `json:"userinfo_endpoint"`
+	JWKSURI                            string   `json:"jwks_uri"`
+	RevocationEndpoint                 string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint              string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint        string   `json:"device_authorization_endpoint"`
+	RegistrationEndpoint               string   `json:"registration_endpoint,omitempty"`
+	EndSessionEndpoint                 string   `json:"end_session_endpoint"`
+	ScopesSupported                    []string `json:"scopes_supported"`
+	ResponseTypesSupported             []string `json:"response_types_supported"`
+	GrantTypesSupported                []string `json:"grant_types_supported"`
+	SubjectTypesSupported              []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported      []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                    []string `json:"claims_supported"`
+	FrontchannelLogoutSupported        bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported bool     `json:"frontchannel_logout_session_supported"`
+	BackchannelLogoutSupported         bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported  bool     `json:"backchannel_logout_session_supported"`
+}
+
+// supportedScopes are the scopes this service itself gives meaning to.
+var supportedScopes = []string{"openid", "email"}
+
+// .well-known/openid-configuration
+func openIDConfiguration(c *gin.Context) {
+	baseURL := utils.GetBaseURL(c)
+	oauthURL := baseURL + oauthPath
+
+	var signingAlgs []string
+	if key := models.CurrentKeyRing().Active(); key != nil {
+		signingAlgs = []string{key.Method.Alg()}
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.IndentedJSON(http.StatusOK, openidconfiguration{
+		Issuer:                             models.TokenIssuer(),
+		AuthorizationEndpoint:              oauthURL + "/authorize",
+		TokenEndpoint:                      oauthURL + "/token",
+		UserinfoEndpoint:                   oauthURL + "/userinfo",
+		JWKSURI:                            baseURL + "/.well-known/jwks.json",
+		RevocationEndpoint:                 oauthURL + "/revoke",
+		IntrospectionEndpoint:              oauthURL + "/introspect",
+		DeviceAuthorizationEndpoint:        oauthURL + "/device/code",
+		RegistrationEndpoint:               registrationEndpoint(c),
+		EndSessionEndpoint:                 oauthURL + "/logout",
+		ScopesSupported:                    supportedScopes,
+		ResponseTypesSupported:             []string{"code"},
+		GrantTypesSupported:                []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken, models.GrantTypeClientCredentials, models.GrantTypeDeviceCode, models.GrantTypeTokenExchange},
+		SubjectTypesSupported:              []string{models.SubjectTypePublic, models.SubjectTypePairwise},
+		IDTokenSigningAlgValuesSupported:   signingAlgs,
+		TokenEndpointAuthMethodsSupported:  []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:      []string{"S256"},
+		ClaimsSupported:                    []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "sid", "email", "email_verified"},
+		FrontchannelLogoutSupported:        true,
+		FrontchannelLogoutSessionSupported: true,
+		BackchannelLogoutSupported:         true,
+		BackchannelLogoutSessionSupported:  true,
+	})
+}
+
+// oauth/userinfo
+func userInfo(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > oidc.go > userInfo > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	controller := controllers.UserController{UserRepository: repositories.UserRepository{DBConn: env.DB}}
+	info, err := controller.GetUserInfo(c.MustGet("claims").(models.TokenClaims))
+	if err == controllers.ErrOpenIDScopeRequired {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		oauthError(c, http.StatusForbidden, "insufficient_scope", err.Error())
+		return
+	}
+	if err == controllers.ErrNotUserToken {
+		oauthError(c, http.StatusForbidden, "insufficient_scope", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("routes > oidc.go > userInfo > could not get user: %s", err.Error())
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_token", "")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, info)
+}
@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const resetPasswordPath = "/v1/auth/password/reset"
+
+type forgotpasswordrequestbody struct {
+	Email string `json:"email"`
+}
+
+type resetpasswordrequestbody struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type passwordresetpendingresponse struct {
+	Message string `json:"message"`
+}
+
+func newPasswordResetController(env models.Env) controllers.PasswordResetController {
+	userRepo := repositories.UserRepository{DBConn: env.DB}
+
+	return controllers.PasswordResetController{
+		UserRepository:          userRepo,
+		PasswordResetRepository: repositories.PasswordResetRepository{DBConn: env.DB},
+		SessionController: controllers.SessionController{
+			SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+			UserRepository:    userRepo,
+			LogoutNotifier:    newLogoutNotifier(env),
+		},
+		Mailer: env.Mailer,
+	}
+}
+
+// auth/password/forgot
+//
+// The response is the same whether or not an account has the address, so it
+// cannot be used to find out which addresses have accounts.
+func forgotPassword(c *gin.Context) {
+	var requestBody forgotpasswordrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Email == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > password.go > forgotPassword > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	resetURL, err := emailLinkURL(resetPasswordPath)
+	if err != nil {
+		log.Printf("routes > password.go > forgotPassword > %s", err.Error())
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	// sending in the background keeps the response time from telling whether an email was sent
+	go func(email string) {
+		err := newPasswordResetController(env).SendPasswordResetEmail(email, resetURL)
+		if err != nil && err != controllers.ErrPasswordResetThrottled {
+			log.Printf("routes > password.go > forgotPassword > password reset email not sent: %s", err.Error())
+		}
+	}(requestBody.Email)
+
+	c.IndentedJSON(http.StatusAccepted, passwordresetpendingresponse{Message: "if an account has this address, a password reset link has been sent to it"})
+}
+
+// auth/password/reset
+//
+// The link in password reset emails opens this page, whose form posts the
+// new password back to resetPassword.
+func passwordResetPage(c *gin.Context) {
+	renderHTML(c, http.StatusOK, "password_reset.html", passwordresetpage{Token: c.Query("token"), Action: c.Request.URL.Path})
+}
+
+// auth/password/reset
+//
+// Takes the token and new password as JSON, or as the form of the password
+// reset page, which gets a page showing the outcome in return.
+func resetPassword(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > password.go > resetPassword > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	if c.ContentType() == binding.MIMEPOSTForm {
+		resetPasswordFromPage(c, env)
+		return
+	}
+
+	var requestBody resetpasswordrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Token == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+	if errors := models.ValidatePassword(requestBody.Password); errors != nil {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: "Validation errors occurred", Errors: errors})
+		return
+	}
+
+	err := newPasswordResetController(env).ResetPassword(requestBody.Token, requestBody.Password)
+	switch err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case controllers.ErrInvalidPasswordResetToken:
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: err.Error()})
+	default:
+		log.Printf("routes > password.go > resetPassword > could not reset password: %s", err.Error())
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+	}
+}
+
+func resetPasswordFromPage(c *gin.Context, env models.Env) {
+	page := passwordresetpage{Token: c.PostForm("token"), Action: c.Request.URL.Path}
+
+	password := c.PostForm("password")
+	if password != c.PostForm("password_confirmation") {
+		page.Error = "The passwords do not match."
+		renderHTML(c, http.StatusBadRequest, "password_reset.html", page)
+		return
+	}
+	if errors := models.ValidatePassword(password); errors != nil {
+		page.Error = "Choose a different password: " + strings.Join(errors, "; ") + "."
+		renderHTML(c, http.StatusBadRequest, "password_reset.html", page)
+		return
+	}
+
+	err := newPasswordResetController(env).ResetPassword(page.Token, password)
+	switch err {
+	case nil:
+		renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Password reset", Message: "Your password has been reset and you have been signed out everywhere. You can now sign in with your new password."})
+	case controllers.ErrInvalidPasswordResetToken:
+		renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "This password reset link is invalid, has expired or has already been used. You can ask for a new one."})
+	default:
+		log.Printf("routes > password.go > resetPasswordFromPage > could not reset password: %s", err.Error())
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not reset your password, please try again."})
+	}
+}
@@ -0,0 +1,393 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registrationrequest is the client metadata of RFC 7591 section 2 that
+// clients register themselves with.
+type registrationrequest struct {
+	ClientID                string   `json:"client_id,omitempty"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope,omitempty"`
+	SubjectType             string   `json:"subject_type,omitempty"`
+	BackchannelLogoutURI    string   `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutURI   string   `json:"frontchannel_logout_uri,omitempty"`
+}
+
+// registrationresponse is the client information response of RFC 7591
+// section 3.2.1 and RFC 7592 section 3.
+type registrationresponse struct {
+	registrationrequest
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at"`
+	RegistrationAccessToken string `json:"registration_access_token"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+}
+
+// initialAccessToken returns the initial access token (RFC 7591 section 3)
+// that must be presented to register a client. Dynamic client registration
+// is disabled when it is not set.
+func initialAccessToken() string {
+	return os.Getenv("JWT_AUTH_SERVICE_INITIAL_ACCESS_TOKEN")
+}
+
+// oauth/register
+func registerClient(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > registration.go > registerClient > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if initialAccessToken() == "" {
+		oauthError(c, http.StatusForbidden, "access_denied", "dynamic client registration is disabled")
+		return
+	}
+	token, err := utils.GetBearerTokenFromContext(c)
+	if err != nil || subtle.ConstantTimeCompare([]byte(utils.HashToken(token)), []byte(utils.HashToken(initialAccessToken()))) != 1 {
+		invalidBearerToken(c)
+		return
+	}
+
+	var request registrationrequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_client_metadata", "the request body must be a JSON object of client metadata")
+		return
+	}
+	request.setDefaults()
+	if errCode, description := request.validate(models.Client{}); errCode != "" {
+		oauthError(c, http.StatusBadRequest, errCode, description)
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	client, clientSecret, registrationToken, errResp := controller.RegisterClient(request.client(""), request.confidential())
+	if errResp.ErrorMessage != "" {
+		registrationError(c, errResp)
+		return
+	}
+
+	log.Printf("routes > registration.go > registerClient > registered client %s", client.ID)
+	writeRegistrationResponse(c, http.StatusCreated, client, clientSecret, registrationToken)
+}
+
+// oauth/register/:client_id
+func getRegistration(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > registration.go > getRegistration > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, registrationToken, ok := authenticateRegistration(c, env)
+	if !ok {
+		return
+	}
+
+	writeRegistrationResponse(c, http.StatusOK, client, "", registrationToken)
+}
+
+// oauth/register/:client_id
+func updateRegistration(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > registration.go > updateRegistration > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, registrationToken, ok := authenticateRegistration(c, env)
+	if !ok {
+		return
+	}
+
+	var request registrationrequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_client_metadata", "the request body must be a JSON object of client metadata")
+		return
+	}
+	if request.ClientID != client.ID {
+		oauthError(c, http.StatusBadRequest, "invalid_client_metadata", "client_id does not match the registration")
+		return
+	}
+	request.setDefaults()
+	if errCode, description := request.validate(client); errCode != "" {
+		oauthError(c, http.StatusBadRequest, errCode, description)
+		return
+	}
+	if request.confidential() == client.IsPublic() {
+		oauthError(c, http.StatusBadRequest, "invalid_client_metadata", "a client cannot change between public and confidential")
+		return
+	}
+
+	// settings made by an admin are not client metadata, so the client cannot change them
+	updatedClient := request.client(client.ID)
+	updatedClient.AccessTokenLifetime = client.AccessTokenLifetime
+	updatedClient.RefreshTokenLifetime = client.RefreshTokenLifetime
+	updatedClient.FirstParty = client.FirstParty
+	updatedClient.AllowedAudiences = client.AllowedAudiences
+	updatedClient.SectorIdentifier = client.SectorIdentifier
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	updatedClient, errResp := controller.UpdateClient(updatedClient)
+	if errResp.ErrorMessage != "" {
+		registrationError(c, errResp)
+		return
+	}
+
+	writeRegistrationResponse(c, http.StatusOK, updatedClient, "", registrationToken)
+}
+
+// oauth/register/:client_id
+func deleteRegistration(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > registration.go > deleteRegistration > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, _, ok := authenticateRegistration(c, env)
+	if !ok {
+		return
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	if err := controller.DeleteClient(client.ID); err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	log.Printf("routes > registration.go > deleteRegistration > deleted client %s", client.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// authenticateRegistration checks the registration access token of a
+// request to the client configuration endpoint, returning the client and the
+// token. As required by RFC 7592 section 2, an unknown client gets the same
+// 401 response as a wrong token.
+func authenticateRegistration(c *gin.Context, env models.Env) (models.Client, string, bool) {
+	registrationToken, err := utils.GetBearerTokenFromContext(c)
+	if err != nil {
+		invalidBearerToken(c)
+		return models.Client{}, "", false
+	}
+
+	controller := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	client, err := controller.AuthenticateRegistration(c.Param("client_id"), registrationToken)
+	if err != nil {
+		invalidBearerToken(c)
+		return models.Client{}, "", false
+	}
+
+	return client, registrationToken, true
+}
+
+func invalidBearerToken(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	oauthError(c, http.StatusUnauthorized, "invalid_token", "")
+}
+
+// registrationError writes the response for a client the controller refused
+// to add or update, which is invalid_client_metadata when it failed
+// validation.
+func registrationError(c *gin.Context, errResp models.ErrorResponse) {
+	if len(errResp.Errors) > 0 {
+		oauthError(c, http.StatusBadRequest, "invalid_client_metadata", strings.Join(errResp.Errors, "; "))
+		return
+	}
+
+	oauthError(c, http.StatusInternalServerError, "server_error", "")
+}
+
+func writeRegistrationResponse(c *gin.Context, status int, client models.Client, clientSecret string, registrationToken string) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.IndentedJSON(status, registrationresponse{
+		registrationrequest:     newRegistrationRequest(client),
+		ClientSecret:            clientSecret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		RegistrationAccessToken: registrationToken,
+		RegistrationClientURI:   utils.GetBaseURL(c) + oauthPath + "/register/" + url.PathEscape(client.ID),
+	})
+}
+
+// setDefaults fills in the defaults of RFC 7591 section 2 for omitted
+// metadata.
+func (request *registrationrequest) setDefaults() {
+	if len(request.GrantTypes) == 0 {
+		request.GrantTypes = []string{models.GrantTypeAuthorizationCode}
+	}
+	if len(request.ResponseTypes) == 0 && models.ContainsString(request.GrantTypes, models.GrantTypeAuthorizationCode) {
+		request.ResponseTypes = []string{"code"}
+	}
+	if request.TokenEndpointAuthMethod == "" {
+		request.TokenEndpointAuthMethod = "client_secret_basic"
+	}
+	if request.SubjectType == "" {
+		request.SubjectType = models.SubjectTypePublic
+	}
+}
+
+// validate returns the RFC 7591 error code for metadata the client may not
+// register with. Self registered clients are limited to the scopes this
+// service supports and cannot use token exchange, unless an admin has
+// already allowed them for the existing client.
+func (request registrationrequest) validate(existing models.Client) (string, string) {
+	switch request.TokenEndpointAuthMethod {
+	case "none", "client_secret_basic", "client_secret_post":
+	default:
+		return "invalid_client_metadata", "unsupported token_endpoint_auth_method"
+	}
+
+	for _, responseType := range request.ResponseTypes {
+		if responseType != "code" {
+			return "invalid_client_metadata", "only the code response type is supported"
+		}
+	}
+	if (len(request.ResponseTypes) > 0) != models.ContainsString(request.GrantTypes, models.GrantTypeAuthorizationCode) {
+		return "invalid_client_metadata", "the code response type and the authorization_code grant must be registered together"
+	}
+
+	for _, grantType := range request.GrantTypes {
+		if grantType == models.GrantTypeTokenExchange && !existing.AllowsGrantType(grantType) {
+			return "invalid_client_metadata", "the token exchange grant can only be allowed by an admin"
+		}
+	}
+	for _, scope := range strings.Fields(request.Scope) {
+		if !models.ContainsString(supportedScopes, scope) && !existing.AllowsScope(scope) {
+			return "invalid_client_metadata", fmt.Sprintf("unsupported scope: %s", scope)
+		}
+	}
+
+	for _, redirectURI := range request.RedirectURIs {
+		if !validRegisteredRedirectURI(redirectURI, !request.confidential()) {
+			return "invalid_redirect_uri", fmt.Sprintf("redirect URI %q must use https, http on a loopback address or, for native apps, a private-use scheme", redirectURI)
+		}
+	}
+
+	if request.FrontchannelLogoutURI != "" && !validRegisteredRedirectURI(request.FrontchannelLogoutURI, false) {
+		return "invalid_client_metadata", fmt.Sprintf("logout URI %q must use https or http on a loopback address", request.FrontchannelLogoutURI)
+	}
+	if request.BackchannelLogoutURI != "" && request.BackchannelLogoutURI != existing.BackchannelLogoutURI &&
+		!validRegisteredBackchannelLogoutURI(request.BackchannelLogoutURI, request.RedirectURIs) {
+		return "invalid_client_metadata", fmt.Sprintf("backchannel logout URI %q must use https on the public host of one of the redirect URIs", request.BackchannelLogoutURI)
+	}
+
+	return "", ""
+}
+
+func (request registrationrequest) confidential() bool {
+	return request.TokenEndpointAuthMethod != "none"
+}
+
+func (request registrationrequest) client(id string) models.Client {
+	return models.Client{
+		ID:                    id,
+		Name:                  request.ClientName,
+		RedirectURIs:          request.RedirectURIs,
+		GrantTypes:            request.GrantTypes,
+		Scopes:                strings.Fields(request.Scope),
+		SubjectType:           request.SubjectType,
+		BackchannelLogoutURI:  request.BackchannelLogoutURI,
+		FrontchannelLogoutURI: request.FrontchannelLogoutURI,
+	}
+}
+
+// newRegistrationRequest returns the client's metadata as registered, where
+// confidential clients are reported as using client_secret_basic although
+// they may also use client_secret_post.
+func newRegistrationRequest(client models.Client) registrationrequest {
+	request := registrationrequest{
+		ClientID:                client.ID,
+		ClientName:              client.Name,
+		RedirectURIs:            client.RedirectURIs,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           []string{},
+		TokenEndpointAuthMethod: "client_secret_basic",
+		Scope:                   strings.Join(client.Scopes, " "),
+		SubjectType:             client.SubjectType,
+		BackchannelLogoutURI:    client.BackchannelLogoutURI,
+		FrontchannelLogoutURI:   client.FrontchannelLogoutURI,
+	}
+	if client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		request.ResponseTypes = []string{"code"}
+	}
+	if client.IsPublic() {
+		request.TokenEndpointAuthMethod = "none"
+	}
+
+	return request
+}
+
+// validRegisteredRedirectURI applies the redirect URI rules of RFC 8252 to
+// self registered clients: https, http only on loopback addresses and, for
+// public clients such as native apps, private-use schemes in reverse domain
+// name form.
+func validRegisteredRedirectURI(redirectURI string, public bool) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		ip := net.ParseIP(u.Hostname())
+		return ip != nil && ip.IsLoopback()
+	default:
+		return public && strings.Contains(u.Scheme, ".")
+	}
+}
+
+// validRegisteredBackchannelLogoutURI keeps self registered clients from
+// having this service POST to its internal network: the URI must use https
+// on the host of one of the client's redirect URIs, and that host cannot be
+// a loopback or private address.
+func validRegisteredBackchannelLogoutURI(logoutURI string, redirectURIs []string) bool {
+	u, err := url.Parse(logoutURI)
+	if err != nil || u.Scheme != "https" || u.Fragment != "" || !utils.IsPublicHost(u.Hostname()) {
+		return false
+	}
+
+	for _, redirectURI := range redirectURIs {
+		if r, err := url.Parse(redirectURI); err == nil && r.Scheme == "https" && strings.EqualFold(r.Hostname(), u.Hostname()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registrationEndpoint returns the URL of the registration endpoint for the
+// discovery document, or nothing when dynamic client registration is
+// disabled.
+func registrationEndpoint(c *gin.Context) string {
+	if initialAccessToken() == "" {
+		return ""
+	}
+
+	return utils.GetBaseURL(c) + oauthPath + "/register"
+}
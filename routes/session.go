@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionresponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func AddSessionRoutes(rg *gin.RouterGroup) {
+	sessionGroup := rg.Group("/auth/sessions", middleware.FirstPartyTokenAuth())
+
+	sessionGroup.GET("", getSessions)
+	sessionGroup.DELETE("/:id", revokeSession)
+}
+
+// auth/sessions
+func getSessions(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > session.go > getSessions > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	claims := c.MustGet("claims").(models.TokenClaims)
+	userID, err := claims.UserID()
+	if err != nil {
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		return
+	}
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}}
+	sessions, err := sessionController.GetSessions(userID)
+	if err != nil {
+		log.Printf("routes > session.go > getSessions > could not get sessions for user ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	response := []sessionresponse{}
+	for _, session := range sessions {
+		response = append(response, sessionresponse{Session: session, Current: session.ID == claims.SessionID})
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// auth/sessions/:id
+func revokeSession(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > session.go > revokeSession > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	claims := c.MustGet("claims").(models.TokenClaims)
+	userID, err := claims.UserID()
+	if err != nil {
+		c.IndentedJSON(http.StatusForbidden, models.ErrResponseForHttpStatus(http.StatusForbidden))
+		return
+	}
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}, LogoutNotifier: newLogoutNotifier(env)}
+	err = sessionController.RevokeSession(userID, c.Param("id"))
+	if err == controllers.ErrSessionNotFound {
+		c.IndentedJSON(http.StatusNotFound, models.ErrResponseForHttpStatus(http.StatusNotFound))
+		return
+	}
+	if err != nil {
+		log.Printf("routes > session.go > revokeSession > could not end session %s", c.Param("id"))
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
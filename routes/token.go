@@ -0,0 +1,299 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenresponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	// IssuedTokenType is only set by token exchange, see RFC 8693 section 2.2.1
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+var tokenGrants = map[string]func(*gin.Context, models.Env, models.Client){
+	models.GrantTypeAuthorizationCode: authorizationCodeGrant,
+	models.GrantTypeRefreshToken:      refreshTokenGrant,
+	models.GrantTypeClientCredentials: clientCredentialsGrant,
+	models.GrantTypeDeviceCode:        deviceCodeGrant,
+	models.GrantTypeTokenExchange:     tokenExchangeGrant,
+}
+
+// deviceGrantErrors maps the states of a device authorization that is not
+// ready to be exchanged to the error codes of RFC 8628 section 3.5.
+var deviceGrantErrors = map[error]string{
+	controllers.ErrAuthorizationPending: "authorization_pending",
+	controllers.ErrSlowDown:             "slow_down",
+	controllers.ErrAccessDenied:         "access_denied",
+	controllers.ErrExpiredToken:         "expired_token",
+	controllers.ErrInvalidDeviceCode:    "invalid_grant",
+}
+
+// tokenExchangeErrors maps refused token exchanges to the error codes of RFC
+// 8693 section 2.2.2.
+var tokenExchangeErrors = map[error]string{
+	controllers.ErrInvalidSubjectToken: "invalid_request",
+	controllers.ErrAudienceNotAllowed:  "invalid_target",
+	controllers.ErrScopeNotAllowed:     "invalid_scope",
+}
+
+// oauth/token
+func oauthToken(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > token.go > oauthToken > env not accessible")
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	client, ok := authenticateClient(c, env, true)
+	if !ok {
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: grant_type")
+		return
+	}
+
+	grant, ok := tokenGrants[grantType]
+	if !ok {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	if !client.AllowsGrantType(grantType) {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "the client is not allowed to use this grant type")
+		return
+	}
+
+	grant(c, env, client)
+}
+
+func authorizationCodeGrant(c *gin.Context, env models.Env, client models.Client) {
+	code := c.PostForm("code")
+	if code == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: code")
+		return
+	}
+
+	codeController := controllers.AuthorizationCodeController{AuthorizationCodeRepository: repositories.AuthorizationCodeRepository{DBConn: env.DB}}
+	authorizationCode, err := codeController.RedeemAuthorizationCode(client, code, c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+	if err == controllers.ErrInvalidAuthorizationCode || err == controllers.ErrRedirectURIMismatch || err == controllers.ErrInvalidCodeVerifier {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	userRepo := repositories.UserRepository{DBConn: env.DB}
+	user, err := userRepo.GetUserByID(authorizationCode.UserID)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "the user no longer exists")
+		return
+	}
+
+	// OpenID Connect clients also get an ID token telling them who signed in
+	var idToken string
+	if models.ScopeIncludes(authorizationCode.Scope, "openid") {
+		userController := controllers.UserController{UserRepository: userRepo}
+		idToken, err = userController.IssueIDToken(user, client, authorizationCode)
+		if err != nil {
+			oauthError(c, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+	}
+
+	session := newSession(c, user.ID, client.Name)
+	session.ClientID = client.ID
+	session.Scope = authorizationCode.Scope
+	session.ParentSessionID = authorizationCode.SessionID
+
+	// the client's tokens tell how the user signed in to the browser session
+	sessionRepo := repositories.SessionRepository{DBConn: env.DB}
+	if parentSession, err := sessionRepo.GetSessionByID(authorizationCode.SessionID); err == nil {
+		session.AuthMethods = parentSession.AuthMethods
+	}
+
+	sessionController := controllers.SessionController{SessionRepository: sessionRepo, UserRepository: userRepo}
+	tokens, err := sessionController.IssueClientTokens(client, user, session)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	response := newTokenResponse(tokens, session.Scope)
+	response.IDToken = idToken
+	writeTokenResponse(c, response)
+}
+
+func refreshTokenGrant(c *gin.Context, env models.Env, client models.Client) {
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: refresh_token")
+		return
+	}
+
+	sessionController := controllers.SessionController{
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		LogoutNotifier:    newLogoutNotifier(env),
+	}
+	_, session, tokens, err := sessionController.RefreshSession(client, refreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err == controllers.ErrInvalidRefreshToken || err == controllers.ErrRefreshTokenReused {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+		return
+	}
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeTokenResponse(c, newTokenResponse(tokens, session.Scope))
+}
+
+// deviceCodeGrant issues tokens to a device that is polling for the outcome
+// of a device authorization, once the user has approved it.
+func deviceCodeGrant(c *gin.Context, env models.Env, client models.Client) {
+	deviceCode := c.PostForm("device_code")
+	if deviceCode == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: device_code")
+		return
+	}
+
+	deviceController := controllers.DeviceAuthorizationController{DeviceAuthorizationRepository: repositories.DeviceAuthorizationRepository{DBConn: env.DB}}
+	authorization, err := deviceController.PollDeviceAuthorization(deviceCode, client.ID)
+	if err != nil {
+		if errorCode, ok := deviceGrantErrors[err]; ok {
+			oauthError(c, http.StatusBadRequest, errorCode, err.Error())
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	userRepo := repositories.UserRepository{DBConn: env.DB}
+	user, err := userRepo.GetUserByID(authorization.UserID)
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "the user no longer exists")
+		return
+	}
+
+	session := newSession(c, user.ID, client.Name)
+	session.ClientID = client.ID
+	session.Scope = authorization.Scope
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}, UserRepository: userRepo}
+	tokens, err := sessionController.IssueClientTokens(client, user, session)
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeTokenResponse(c, newTokenResponse(tokens, session.Scope))
+}
+
+// clientCredentialsGrant issues a token to the client itself. No refresh
+// token is issued, as the client can just ask for a new token.
+func clientCredentialsGrant(c *gin.Context, env models.Env, client models.Client) {
+	clientController := controllers.ClientController{ClientRepository: repositories.ClientRepository{DBConn: env.DB}}
+	tokens, scope, err := clientController.IssueClientCredentialsToken(client, c.PostForm("scope"))
+	if err == controllers.ErrClientCredentialsNotAllowed {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", err.Error())
+		return
+	}
+	if err == controllers.ErrClientScopeNotAllowed {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+	if err != nil {
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	writeTokenResponse(c, newTokenResponse(tokens, scope))
+}
+
+// tokenExchangeGrant exchanges an access token presented to the client for
+// one the client can use to call the audience on the subject's behalf (RFC
+// 8693). The client is always the actor, so actor tokens are not accepted,
+// and no refresh token is issued.
+func tokenExchangeGrant(c *gin.Context, env models.Env, client models.Client) {
+	if client.IsPublic() {
+		oauthError(c, http.StatusBadRequest, "unauthorized_client", "token exchange requires a confidential client")
+		return
+	}
+
+	subjectToken := c.PostForm("subject_token")
+	if subjectToken == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "missing required parameter: subject_token")
+		return
+	}
+	if c.PostForm("subject_token_type") != models.TokenTypeAccessToken {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "subject_token_type must be "+models.TokenTypeAccessToken)
+		return
+	}
+	if requested := c.PostForm("requested_token_type"); requested != "" && requested != models.TokenTypeAccessToken {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "only access tokens can be requested")
+		return
+	}
+	if c.PostForm("actor_token") != "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "actor tokens are not supported")
+		return
+	}
+
+	audiences := c.PostFormArray("audience")
+	if len(audiences) != 1 || audiences[0] == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_target", "exactly one audience is required")
+		return
+	}
+
+	tokenController := controllers.TokenController{
+		UserRepository:    repositories.UserRepository{DBConn: env.DB},
+		ClientRepository:  repositories.ClientRepository{DBConn: env.DB},
+		SessionRepository: repositories.SessionRepository{DBConn: env.DB},
+		Denylist:          env.Denylist,
+	}
+	accessToken, claims, err := tokenController.ExchangeToken(client, subjectToken, audiences[0], c.PostForm("scope"))
+	if err != nil {
+		if errorCode, ok := tokenExchangeErrors[err]; ok {
+			oauthError(c, http.StatusBadRequest, errorCode, err.Error())
+			return
+		}
+		oauthError(c, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	response := newTokenResponse(models.TokenPair{AccessToken: accessToken, AccessTokenExpiresAt: claims.ExpiresAt.Time}, claims.Scope)
+	response.IssuedTokenType = models.TokenTypeAccessToken
+	writeTokenResponse(c, response)
+}
+
+func newTokenResponse(tokens models.TokenPair, scope string) tokenresponse {
+	return tokenresponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.AccessTokenExpiresAt).Round(time.Second).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        scope,
+	}
+}
+
+func writeTokenResponse(c *gin.Context, response tokenresponse) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const verifyEmailPath = "/v1/auth/verify-email"
+
+type verifyemailrequestbody struct {
+	Token string `json:"token"`
+}
+
+type resendverificationrequestbody struct {
+	Email string `json:"email"`
+}
+
+type verificationpendingresponse struct {
+	Message string `json:"message"`
+}
+
+// requireVerifiedEmail reports whether users must verify their email address
+// before they can sign in, which is enabled by setting
+// JWT_AUTH_SERVICE_REQUIRE_VERIFIED_EMAIL to true.
+func requireVerifiedEmail() bool {
+	return os.Getenv("JWT_AUTH_SERVICE_REQUIRE_VERIFIED_EMAIL") == "true"
+}
+
+// emailLinkURL returns the URL of a page linked to from emails. Links are
+// only built from JWT_AUTH_SERVICE_BASE_URL, as the Host header of the
+// request could send the user's token to another site.
+func emailLinkURL(path string) (string, error) {
+	baseURL := os.Getenv("JWT_AUTH_SERVICE_BASE_URL")
+	if baseURL == "" {
+		return "", fmt.Errorf("JWT_AUTH_SERVICE_BASE_URL must be set to send emails with links")
+	}
+
+	return strings.TrimSuffix(baseURL, "/") + path, nil
+}
+
+func newEmailVerificationController(env models.Env) controllers.EmailVerificationController {
+	return controllers.EmailVerificationController{UserRepository: repositories.UserRepository{DBConn: env.DB}, Mailer: env.Mailer}
+}
+
+// sendVerificationEmail sends a new user the link verifying their address.
+// Failing to send does not fail the request, as the user can ask for the
+// email again.
+func sendVerificationEmail(env models.Env, user models.User) {
+	verifyURL, err := emailLinkURL(verifyEmailPath)
+	if err == nil {
+		err = newEmailVerificationController(env).SendVerificationEmail(user, verifyURL)
+	}
+	if err != nil {
+		log.Printf("routes > verification.go > sendVerificationEmail > could not send verification email to user ID %d: %s", user.ID, err.Error())
+	}
+}
+
+// auth/verify-email
+func verifyEmail(c *gin.Context) {
+	var requestBody verifyemailrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Token == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > verification.go > verifyEmail > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	_, err := newEmailVerificationController(env).VerifyEmail(requestBody.Token)
+	switch err {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case controllers.ErrInvalidVerificationToken, controllers.ErrEmailAlreadyVerified:
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: err.Error()})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+	}
+}
+
+// auth/verify-email
+//
+// The link in verification emails opens this page, which verifies the
+// address and shows the outcome.
+func verifyEmailLink(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > verification.go > verifyEmailLink > env not accessible")
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "internal server error"})
+		return
+	}
+
+	_, err := newEmailVerificationController(env).VerifyEmail(c.Query("token"))
+	switch err {
+	case nil:
+		renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Email verified", Message: "Your email address has been verified. You can close this window."})
+	case controllers.ErrEmailAlreadyVerified:
+		renderHTML(c, http.StatusOK, "message.html", messagepage{Title: "Email verified", Message: "Your email address has already been verified."})
+	case controllers.ErrInvalidVerificationToken:
+		renderHTML(c, http.StatusBadRequest, "error.html", errorpage{Message: "This verification link is invalid or has expired. You can ask for a new one."})
+	default:
+		renderHTML(c, http.StatusInternalServerError, "error.html", errorpage{Message: "Could not verify your email address, please try again."})
+	}
+}
+
+// auth/verify-email/resend
+//
+// The response is the same whether or not an unverified account has the
+// address, so it cannot be used to find out which addresses have accounts.
+func resendVerificationEmail(c *gin.Context) {
+	var requestBody resendverificationrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Email == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > verification.go > resendVerificationEmail > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	verifyURL, err := emailLinkURL(verifyEmailPath)
+	if err != nil {
+		log.Printf("routes > verification.go > resendVerificationEmail > %s", err.Error())
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	// sending in the background keeps the response time from telling whether an email was sent
+	go func(email string) {
+		err := newEmailVerificationController(env).ResendVerificationEmail(email, verifyURL)
+		if err != nil && err != controllers.ErrVerificationEmailThrottled && err != controllers.ErrEmailAlreadyVerified {
+			log.Printf("routes > verification.go > resendVerificationEmail > verification email not sent: %s", err.Error())
+		}
+	}(requestBody.Email)
+
+	c.IndentedJSON(http.StatusAccepted, verificationpendingresponse{Message: "if an unverified account has this address, a verification email has been sent to it"})
+}
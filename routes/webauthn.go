@@ -0,0 +1,286 @@
+package routes
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type passkeyregistrationrequestbody struct {
+	Name       string                      `json:"name"`
+	Credential models.RegistrationResponse `json:"credential"`
+}
+
+type passkeyloginrequestbody struct {
+	Credential  models.AssertionResponse `json:"credential"`
+	DeviceLabel string                   `json:"device_label"`
+}
+
+type passkeyresponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt *int64 `json:"last_used_at"`
+}
+
+var webAuthnErrorStatuses = map[error]int{
+	controllers.ErrInvalidPasskey:    http.StatusBadRequest,
+	controllers.ErrPasskeyNotFound:   http.StatusNotFound,
+	repositories.ErrCredentialExists: http.StatusConflict,
+}
+
+func newWebAuthnController(env models.Env) controllers.WebAuthnController {
+	return controllers.WebAuthnController{
+		WebAuthnRepository: repositories.WebAuthnRepository{DBConn: env.DB},
+		UserRepository:     repositories.UserRepository{DBConn: env.DB},
+	}
+}
+
+// writeWebAuthnError responds with the status for an error of the WebAuthn
+// controller, logging unexpected ones.
+func writeWebAuthnError(c *gin.Context, handler string, err error) {
+	if status, ok := webAuthnErrorStatuses[err]; ok {
+		c.IndentedJSON(status, models.ErrorResponse{ErrorMessage: err.Error()})
+		return
+	}
+
+	log.Printf("routes > webauthn.go > %s > %s", handler, err.Error())
+	c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+}
+
+// authorizePasskeyChange refuses adding or removing passkeys from a session
+// that was not signed in with a second factor once the user has one,
+// responding to the request itself.
+func authorizePasskeyChange(c *gin.Context, env models.Env, handler string, userID int) bool {
+	usedMFA := c.MustGet("claims").(models.TokenClaims).UsedMFA()
+	if err := newMFAController(env).AuthorizeFactorChange(userID, usedMFA); err != nil {
+		writeMFAError(c, handler, err)
+		return false
+	}
+
+	return true
+}
+
+// auth/passkey/begin
+//
+// Starts signing in with a passkey, returning the options to pass to
+// navigator.credentials.get().
+func beginPasskeyLogin(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > beginPasskeyLogin > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	options, err := newWebAuthnController(env).BeginLogin()
+	if err != nil {
+		writeWebAuthnError(c, "beginPasskeyLogin", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, options)
+}
+
+// auth/passkey/finish
+//
+// Completes signing in with a passkey, returning the same tokens as
+// auth/login. Passkeys verify the user themselves, so no further factor is
+// asked for.
+func finishPasskeyLogin(c *gin.Context) {
+	var requestBody passkeyloginrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Credential.RawID == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > finishPasskeyLogin > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	user, authMethods, err := newWebAuthnController(env).FinishLogin(requestBody.Credential)
+	if err == controllers.ErrInvalidPasskey {
+		c.IndentedJSON(http.StatusUnauthorized, models.ErrorResponse{ErrorMessage: err.Error()})
+		return
+	}
+	if err != nil {
+		writeWebAuthnError(c, "finishPasskeyLogin", err)
+		return
+	}
+	if requireVerifiedEmail() && !user.EmailVerified {
+		c.IndentedJSON(http.StatusForbidden, models.ErrorResponse{ErrorMessage: "email address has not been verified"})
+		return
+	}
+
+	session := newSession(c, user.ID, requestBody.DeviceLabel)
+	session.AuthMethods = authMethods
+
+	sessionController := controllers.SessionController{SessionRepository: repositories.SessionRepository{DBConn: env.DB}}
+	response, err := issueTokens(c, sessionController, user, session)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrorResponse{ErrorMessage: "Could not mint token"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, response)
+}
+
+// account/passkeys
+func getPasskeys(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > getPasskeys > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+
+	credentials, err := newWebAuthnController(env).GetCredentials(userID)
+	if err != nil {
+		writeWebAuthnError(c, "getPasskeys", err)
+		return
+	}
+
+	passkeys := make([]passkeyresponse, len(credentials))
+	for i, credential := range credentials {
+		passkeys[i] = newPasskeyResponse(credential)
+	}
+
+	c.IndentedJSON(http.StatusOK, passkeys)
+}
+
+// account/passkeys/register/begin
+//
+// Starts registering a passkey, returning the options to pass to
+// navigator.credentials.create() before sending the result to
+// account/passkeys/register/finish.
+func beginPasskeyRegistration(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > beginPasskeyRegistration > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+	if !authorizePasskeyChange(c, env, "beginPasskeyRegistration", userID) {
+		return
+	}
+
+	user, err := repositories.UserRepository{DBConn: env.DB}.GetUserByID(userID)
+	if err != nil {
+		log.Printf("routes > webauthn.go > beginPasskeyRegistration > could not get user with ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	options, err := newWebAuthnController(env).BeginRegistration(user)
+	if err != nil {
+		writeWebAuthnError(c, "beginPasskeyRegistration", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, options)
+}
+
+// account/passkeys/register/finish
+func finishPasskeyRegistration(c *gin.Context) {
+	var requestBody passkeyregistrationrequestbody
+	if err := c.BindJSON(&requestBody); err != nil || requestBody.Credential.RawID == "" {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrResponseForHttpStatus(http.StatusBadRequest))
+		return
+	}
+	if len(requestBody.Name) > 64 {
+		c.IndentedJSON(http.StatusBadRequest, models.ErrorResponse{ErrorMessage: "name must be at most 64 characters"})
+		return
+	}
+
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > finishPasskeyRegistration > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+	if !authorizePasskeyChange(c, env, "finishPasskeyRegistration", userID) {
+		return
+	}
+
+	user, err := repositories.UserRepository{DBConn: env.DB}.GetUserByID(userID)
+	if err != nil {
+		log.Printf("routes > webauthn.go > finishPasskeyRegistration > could not get user with ID %d", userID)
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	credential, err := newWebAuthnController(env).FinishRegistration(user, requestBody.Credential, requestBody.Name)
+	if err != nil {
+		writeWebAuthnError(c, "finishPasskeyRegistration", err)
+		return
+	}
+
+	c.IndentedJSON(http.StatusCreated, newPasskeyResponse(credential))
+}
+
+// account/passkeys/:id
+func deletePasskey(c *gin.Context) {
+	env, ok := c.MustGet("env").(models.Env)
+	if !ok {
+		log.Println("routes > webauthn.go > deletePasskey > env not accessible")
+		c.IndentedJSON(http.StatusInternalServerError, models.ErrResponseForHttpStatus(http.StatusInternalServerError))
+		return
+	}
+
+	userID, ok := accountUserID(c)
+	if !ok {
+		return
+	}
+	if !authorizePasskeyChange(c, env, "deletePasskey", userID) {
+		return
+	}
+
+	credentialID, err := models.DecodeBase64URL(c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, models.ErrorResponse{ErrorMessage: controllers.ErrPasskeyNotFound.Error()})
+		return
+	}
+
+	if err := newWebAuthnController(env).DeleteCredential(userID, credentialID); err != nil {
+		writeWebAuthnError(c, "deletePasskey", err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func newPasskeyResponse(credential models.WebAuthnCredential) passkeyresponse {
+	passkey := passkeyresponse{
+		ID:        models.EncodeBase64URL(credential.ID),
+		Name:      credential.Name,
+		CreatedAt: credential.CreatedAt.Unix(),
+	}
+	if credential.LastUsedAt != nil {
+		lastUsedAt := credential.LastUsedAt.Unix()
+		passkey.LastUsedAt = &lastUsedAt
+	}
+
+	return passkey
+}
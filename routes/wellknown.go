@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"jwt-auth-service/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AddWellKnownRoutes(rg *gin.RouterGroup) {
+	wellKnownGroup := rg.Group("/.well-known")
+
+	wellKnownGroup.GET("/jwks.json", jwks)
+	wellKnownGroup.GET("/openid-configuration", openIDConfiguration)
+}
+
+// .well-known/jwks.json
+func jwks(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.IndentedJSON(http.StatusOK, models.CurrentKeyRing().JWKS())
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"testing"
+	"time"
+)
+
+type MockAuthorizationCodeRepository struct {
+	codes map[string]models.AuthorizationCode
+}
+
+func (repo MockAuthorizationCodeRepository) AddAuthorizationCode(code models.AuthorizationCode) error {
+	repo.codes[code.CodeHash] = code
+	return nil
+}
+
+func (repo MockAuthorizationCodeRepository) ConsumeAuthorizationCode(codeHash string) (models.AuthorizationCode, error) {
+	code, ok := repo.codes[codeHash]
+	if !ok {
+		return code, repositories.ErrAuthorizationCodeNotFound
+	}
+
+	delete(repo.codes, codeHash)
+	return code, nil
+}
+
+var codeClient = models.Client{ID: "web-app", RedirectURIs: []string{"https://app.example.com/callback"}}
+
+// test vector from RFC 7636 appendix B
+const testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func newTestAuthorizationCode(t *testing.T, redirectURI string) (controllers.AuthorizationCodeController, MockAuthorizationCodeRepository, string) {
+	repo := MockAuthorizationCodeRepository{codes: map[string]models.AuthorizationCode{}}
+	controller := controllers.AuthorizationCodeController{AuthorizationCodeRepository: repo}
+
+	code, err := controller.IssueAuthorizationCode(models.AuthorizationCode{
+		ClientID:            codeClient.ID,
+		UserID:              testUserID,
+		RedirectURI:         redirectURI,
+		Scope:               "openid",
+		CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		CodeChallengeMethod: "S256",
+	})
+	if err != nil {
+		t.Fatalf("failed to issue authorization code: %q", err)
+	}
+
+	return controller, repo, code
+}
+
+func TestRedeemAuthorizationCode(t *testing.T) {
+	controller, _, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+
+	authorizationCode, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier)
+	if err != nil {
+		t.Fatalf("failed to redeem authorization code: %q", err)
+	}
+	if authorizationCode.UserID != testUserID || authorizationCode.Scope != "openid" {
+		t.Fatalf("unexpected authorization: user ID %d, scope %q", authorizationCode.UserID, authorizationCode.Scope)
+	}
+}
+
+func TestRedeemAuthorizationCodeTwice(t *testing.T) {
+	controller, _, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != nil {
+		t.Fatalf("failed to redeem authorization code: %q", err)
+	}
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != controllers.ErrInvalidAuthorizationCode {
+		t.Fatalf("unexpected error when redeeming a code again\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidAuthorizationCode, err)
+	}
+}
+
+func TestRedeemAuthorizationCodeWithOtherRedirectURI(t *testing.T) {
+	controller, _, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, "https://app.example.com/other", testCodeVerifier); err != controllers.ErrRedirectURIMismatch {
+		t.Fatalf("unexpected error for another redirect URI\n\texpected: %q\n\tactual: %q", controllers.ErrRedirectURIMismatch, err)
+	}
+
+	// a code requested without a redirect URI must be redeemed without one too
+	controller, _, code = newTestAuthorizationCode(t, "")
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != controllers.ErrRedirectURIMismatch {
+		t.Fatalf("unexpected error for a redirect URI the request omitted\n\texpected: %q\n\tactual: %q", controllers.ErrRedirectURIMismatch, err)
+	}
+}
+
+func TestRedeemAuthorizationCodeOfAnotherClient(t *testing.T) {
+	controller, _, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+	otherClient := models.Client{ID: "other-app", RedirectURIs: codeClient.RedirectURIs}
+
+	if _, err := controller.RedeemAuthorizationCode(otherClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != controllers.ErrInvalidAuthorizationCode {
+		t.Fatalf("unexpected error when redeeming another client's code\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidAuthorizationCode, err)
+	}
+
+	// the attempt used the code up, so it cannot be retried with the right client
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != controllers.ErrInvalidAuthorizationCode {
+		t.Fatalf("unexpected error when redeeming a code after a failed attempt\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidAuthorizationCode, err)
+	}
+}
+
+func TestRedeemExpiredAuthorizationCode(t *testing.T) {
+	controller, repo, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+	for hash, authorizationCode := range repo.codes {
+		authorizationCode.ExpiresAt = time.Now().Add(-time.Second)
+		repo.codes[hash] = authorizationCode
+	}
+
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], testCodeVerifier); err != controllers.ErrInvalidAuthorizationCode {
+		t.Fatalf("unexpected error for an expired code\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidAuthorizationCode, err)
+	}
+}
+
+func TestRedeemAuthorizationCodeWithWrongVerifier(t *testing.T) {
+	controller, _, code := newTestAuthorizationCode(t, codeClient.RedirectURIs[0])
+
+	if _, err := controller.RedeemAuthorizationCode(codeClient, code, codeClient.RedirectURIs[0], "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXK"); err != controllers.ErrInvalidCodeVerifier {
+		t.Fatalf("unexpected error for the wrong code verifier\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidCodeVerifier, err)
+	}
+}
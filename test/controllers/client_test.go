@@ -0,0 +1,252 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"testing"
+)
+
+type MockClientRepository struct {
+	clients map[string]models.Client
+}
+
+func (repo MockClientRepository) AddClient(client models.Client) (models.Client, error) {
+	repo.clients[client.ID] = client
+	return client, nil
+}
+
+func (repo MockClientRepository) GetClientByID(id string) (models.Client, error) {
+	client, ok := repo.clients[id]
+	if !ok {
+		return client, repositories.ErrClientNotFound
+	}
+
+	return client, nil
+}
+
+func (repo MockClientRepository) GetClients() ([]models.Client, error) {
+	var clients []models.Client
+	for _, client := range repo.clients {
+		clients = append(clients, client)
+	}
+
+	return clients, nil
+}
+
+func (repo MockClientRepository) UpdateClient(client models.Client) error {
+	repo.clients[client.ID] = client
+	return nil
+}
+
+func (repo MockClientRepository) UpdateClientSecret(id string, secretHash string) error {
+	client, ok := repo.clients[id]
+	if !ok {
+		return repositories.ErrClientNotFound
+	}
+
+	client.SecretHash = secretHash
+	repo.clients[id] = client
+	return nil
+}
+
+func (repo MockClientRepository) DeleteClient(id string) error {
+	delete(repo.clients, id)
+	return nil
+}
+
+// unavailableClientRepository fails to look clients up, as when the database
+// cannot be reached.
+type unavailableClientRepository struct {
+	MockClientRepository
+}
+
+func (repo unavailableClientRepository) GetClientByID(id string) (models.Client, error) {
+	return models.Client{}, fmt.Errorf("connection refused")
+}
+
+var testClient = models.Client{
+	Name:         "Test App",
+	RedirectURIs: []string{"https://app.example.com/callback"},
+	GrantTypes:   []string{models.GrantTypeAuthorizationCode, models.GrantTypeRefreshToken},
+	Scopes:       []string{"profile"},
+}
+
+func newTestClientController() controllers.ClientController {
+	return controllers.ClientController{ClientRepository: MockClientRepository{clients: map[string]models.Client{}}}
+}
+
+func TestAddConfidentialClient(t *testing.T) {
+	controller := newTestClientController()
+
+	client, clientSecret, errResp := controller.AddClient(testClient, true)
+	if errResp.ErrorMessage != "" {
+		t.Fatalf("failed to add client: %q", errResp.ErrorMessage)
+	}
+	if client.ID == "" || clientSecret == "" {
+		t.Fatalf("no client ID or secret was generated for a confidential client")
+	}
+	if client.SecretHash == clientSecret {
+		t.Fatalf("client secret was stored in plain text")
+	}
+
+	if _, err := controller.AuthenticateClient(client.ID, clientSecret); err != nil {
+		t.Fatalf("failed to authenticate client with its secret: %q", err)
+	}
+	if _, err := controller.AuthenticateClient(client.ID, "notthesecret"); err == nil {
+		t.Fatalf("no error was thrown when authenticating a client with the wrong secret")
+	}
+}
+
+func TestAddPublicClient(t *testing.T) {
+	controller := newTestClientController()
+
+	client, clientSecret, errResp := controller.AddClient(testClient, false)
+	if errResp.ErrorMessage != "" {
+		t.Fatalf("failed to add client: %q", errResp.ErrorMessage)
+	}
+	if clientSecret != "" || !client.IsPublic() {
+		t.Fatalf("a secret was generated for a public client")
+	}
+
+	if _, err := controller.IdentifyClient(client.ID, ""); err != nil {
+		t.Fatalf("failed to identify public client by its client ID: %q", err)
+	}
+	if _, err := controller.AuthenticateClient(client.ID, ""); err == nil {
+		t.Fatalf("no error was thrown when authenticating a public client as a confidential one")
+	}
+}
+
+func TestAddClientFailsValidation(t *testing.T) {
+	controller := newTestClientController()
+
+	invalidClient := testClient
+	invalidClient.GrantTypes = []string{"password"}
+	invalidClient.RedirectURIs = []string{"/callback#fragment"}
+
+	_, _, errResp := controller.AddClient(invalidClient, true)
+	if len(errResp.Errors) != 2 {
+		t.Fatalf("unexpected validation errors\n\texpected: 2 errors\n\tactual: %q", errResp.Errors)
+	}
+}
+
+func TestRotateClientSecret(t *testing.T) {
+	controller := newTestClientController()
+
+	client, oldSecret, _ := controller.AddClient(testClient, true)
+
+	newSecret, err := controller.RotateClientSecret(client.ID)
+	if err != nil {
+		t.Fatalf("failed to rotate client secret: %q", err)
+	}
+
+	if _, err := controller.AuthenticateClient(client.ID, newSecret); err != nil {
+		t.Fatalf("failed to authenticate client with its new secret: %q", err)
+	}
+	if _, err := controller.AuthenticateClient(client.ID, oldSecret); err == nil {
+		t.Fatalf("no error was thrown when authenticating a client with its rotated secret")
+	}
+}
+
+func TestRegisterClient(t *testing.T) {
+	controller := newTestClientController()
+
+	client, clientSecret, registrationToken, errResp := controller.RegisterClient(testClient, true)
+	if errResp.ErrorMessage != "" {
+		t.Fatalf("failed to register client: %q", errResp.ErrorMessage)
+	}
+	if clientSecret == "" || registrationToken == "" {
+		t.Fatalf("no client secret or registration access token was issued")
+	}
+	if client.RegistrationTokenHash == registrationToken {
+		t.Fatalf("registration access token was stored in plain text")
+	}
+
+	if _, err := controller.AuthenticateRegistration(client.ID, registrationToken); err != nil {
+		t.Fatalf("failed to authenticate registration with its access token: %q", err)
+	}
+	if _, err := controller.AuthenticateRegistration(client.ID, clientSecret); err == nil {
+		t.Fatalf("no error was thrown when authenticating a registration with the client secret")
+	}
+
+	// updates must not lose the registration access token
+	client.Name = "Renamed App"
+	if _, errResp := controller.UpdateClient(client); errResp.ErrorMessage != "" {
+		t.Fatalf("failed to update client: %q", errResp.ErrorMessage)
+	}
+	if _, err := controller.AuthenticateRegistration(client.ID, registrationToken); err != nil {
+		t.Fatalf("failed to authenticate registration after an update: %q", err)
+	}
+}
+
+func TestAdminClientsHaveNoRegistration(t *testing.T) {
+	controller := newTestClientController()
+
+	client, _, _ := controller.AddClient(testClient, true)
+
+	if _, err := controller.AuthenticateRegistration(client.ID, ""); err == nil {
+		t.Fatalf("no error was thrown when managing the registration of a client added by an admin")
+	}
+}
+
+func TestAuthenticateClientWhenRepositoryFails(t *testing.T) {
+	controller := controllers.ClientController{ClientRepository: unavailableClientRepository{}}
+
+	if _, err := controller.AuthenticateClient("client", "secret"); err == nil || err == controllers.ErrInvalidClientCredentials {
+		t.Fatalf("unexpected error when the client could not be looked up\n\texpected: a repository error\n\tactual: %v", err)
+	}
+	if _, err := controller.IdentifyClient("client", ""); err == nil || err == controllers.ErrInvalidClientCredentials {
+		t.Fatalf("unexpected error when the client could not be looked up\n\texpected: a repository error\n\tactual: %v", err)
+	}
+}
+
+func TestIssueClientCredentialsToken(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	controller := newTestClientController()
+	serviceClient := testClient
+	serviceClient.GrantTypes = []string{models.GrantTypeClientCredentials}
+	serviceClient.Scopes = []string{"orders", "payments"}
+	client, _, _ := controller.AddClient(serviceClient, true)
+
+	tokens, scope, err := controller.IssueClientCredentialsToken(client, "")
+	if err != nil {
+		t.Fatalf("failed to issue client credentials token: %q", err)
+	}
+	if scope != "orders payments" {
+		t.Fatalf("unexpected scope\n\texpected: orders payments\n\tactual: %s", scope)
+	}
+
+	tokenController := controllers.TokenController{ClientRepository: controller.ClientRepository}
+	claims, err := tokenController.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("client credentials token is not valid: %q", err)
+	}
+	if claims.Subject != client.ID || !claims.IsClientSubject() {
+		t.Fatalf("client credentials token was not issued to the client")
+	}
+
+	// the token stops working once the client is gone, but not when it cannot be looked up
+	if _, err := (controllers.TokenController{ClientRepository: unavailableClientRepository{}}).ValidateAccessToken(tokens.AccessToken); err != controllers.ErrTokenStateUnavailable {
+		t.Fatalf("unexpected error when the client could not be looked up\n\texpected: %q\n\tactual: %q", controllers.ErrTokenStateUnavailable, err)
+	}
+	_ = controller.DeleteClient(client.ID)
+	if _, err := tokenController.ValidateAccessToken(tokens.AccessToken); err == nil || err == controllers.ErrTokenStateUnavailable {
+		t.Fatalf("unexpected error for a token of a deleted client\n\texpected: token has been revoked\n\tactual: %v", err)
+	}
+}
+
+func TestIssueClientCredentialsTokenRefused(t *testing.T) {
+	controller := newTestClientController()
+	publicClient, _, _ := controller.AddClient(testClient, false)
+	confidentialClient, _, _ := controller.AddClient(testClient, true)
+
+	if _, _, err := controller.IssueClientCredentialsToken(publicClient, ""); err != controllers.ErrClientCredentialsNotAllowed {
+		t.Fatalf("unexpected error for a public client\n\texpected: %q\n\tactual: %q", controllers.ErrClientCredentialsNotAllowed, err)
+	}
+	if _, _, err := controller.IssueClientCredentialsToken(confidentialClient, "admin"); err != controllers.ErrClientScopeNotAllowed {
+		t.Fatalf("unexpected error for a scope the client is not allowed\n\texpected: %q\n\tactual: %q", controllers.ErrClientScopeNotAllowed, err)
+	}
+}
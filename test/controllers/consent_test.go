@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"testing"
+	"time"
+)
+
+type MockConsentRepository struct {
+	consents map[string]models.Consent
+}
+
+func consentKey(userID int, clientID string) string {
+	return fmt.Sprintf("%d:%s", userID, clientID)
+}
+
+func (repo MockConsentRepository) GetConsent(userID int, clientID string) (models.Consent, error) {
+	consent, ok := repo.consents[consentKey(userID, clientID)]
+	if !ok {
+		return consent, repositories.ErrConsentNotFound
+	}
+
+	return consent, nil
+}
+
+func (repo MockConsentRepository) GetConsentsForUser(userID int) ([]models.Consent, error) {
+	var consents []models.Consent
+	for _, consent := range repo.consents {
+		if consent.UserID == userID {
+			consents = append(consents, consent)
+		}
+	}
+
+	return consents, nil
+}
+
+func (repo MockConsentRepository) SaveConsent(consent models.Consent) error {
+	repo.consents[consentKey(consent.UserID, consent.ClientID)] = consent
+	return nil
+}
+
+func (repo MockConsentRepository) DeleteConsent(userID int, clientID string) error {
+	if _, ok := repo.consents[consentKey(userID, clientID)]; !ok {
+		return repositories.ErrConsentNotFound
+	}
+
+	delete(repo.consents, consentKey(userID, clientID))
+	return nil
+}
+
+var testPartnerClient = models.Client{ID: "partner"}
+
+func newTestConsentController() (controllers.ConsentController, MockSessionRepository) {
+	_, sessionRepo := newTestSessionController()
+	sessionRepo.sessions["session1"] = models.Session{ID: "session1", UserID: testUserID, ClientID: testPartnerClient.ID, ExpiresAt: time.Now().Add(time.Hour)}
+
+	controller := controllers.ConsentController{
+		ConsentRepository: MockConsentRepository{consents: map[string]models.Consent{}},
+		SessionRepository: sessionRepo,
+	}
+
+	return controller, sessionRepo
+}
+
+func TestGrantConsentAddsScopes(t *testing.T) {
+	controller, _ := newTestConsentController()
+
+	if controller.HasConsent(testUserID, testPartnerClient, "openid") {
+		t.Fatalf("consent was assumed before the user gave it")
+	}
+
+	_ = controller.GrantConsent(testUserID, testPartnerClient.ID, "openid")
+	_ = controller.GrantConsent(testUserID, testPartnerClient.ID, "email")
+
+	if !controller.HasConsent(testUserID, testPartnerClient, "email openid") {
+		t.Fatalf("scopes granted separately were not all covered by the consent")
+	}
+	if controller.HasConsent(testUserID, testPartnerClient, "openid reports:write") {
+		t.Fatalf("consent covered a scope that was never granted")
+	}
+}
+
+func TestFirstPartyClientNeedsNoConsent(t *testing.T) {
+	controller, _ := newTestConsentController()
+
+	if !controller.HasConsent(testUserID, models.Client{ID: "app", FirstParty: true}, "openid email") {
+		t.Fatalf("consent was required for a first party client")
+	}
+}
+
+func TestRevokeConsentEndsClientSessions(t *testing.T) {
+	controller, sessionRepo := newTestConsentController()
+
+	_ = controller.GrantConsent(testUserID, testPartnerClient.ID, "openid")
+	if err := controller.RevokeConsent(testUserID, testPartnerClient.ID); err != nil {
+		t.Fatalf("failed to revoke consent: %q", err)
+	}
+
+	if controller.HasConsent(testUserID, testPartnerClient, "openid") {
+		t.Fatalf("consent was still covered after revoking it")
+	}
+	if _, err := sessionRepo.GetSessionByID("session1"); err == nil {
+		t.Fatalf("the client's session was not ended when revoking consent")
+	}
+	if _, err := sessionRepo.GetSessionByID(testSessionID); err != nil {
+		t.Fatalf("a session of the user's own was ended when revoking a client's consent")
+	}
+}
+
+func TestRevokeConsentRevokesClientAccessTokens(t *testing.T) {
+	tokenController, clientAccessToken, firstPartyAccessToken := newTestRevocation(t)
+	controller := controllers.ConsentController{
+		ConsentRepository: MockConsentRepository{consents: map[string]models.Consent{}},
+		SessionRepository: tokenController.SessionRepository,
+	}
+
+	_ = controller.GrantConsent(testUserID, revokingClient.ID, "openid")
+	if err := controller.RevokeConsent(testUserID, revokingClient.ID); err != nil {
+		t.Fatalf("failed to revoke consent: %q", err)
+	}
+
+	if _, err := tokenController.ValidateAccessToken(clientAccessToken); err == nil {
+		t.Fatalf("access token of the client is still valid after revoking its consent")
+	}
+	if _, err := tokenController.ValidateAccessToken(firstPartyAccessToken); err != nil {
+		t.Fatalf("access token of the user's own session is no longer valid: %q", err)
+	}
+}
+
+func TestRevokeConsentNotGiven(t *testing.T) {
+	controller, _ := newTestConsentController()
+
+	if err := controller.RevokeConsent(testUserID, testPartnerClient.ID); err != controllers.ErrConsentNotFound {
+		t.Fatalf("unexpected error when revoking consent that was not given\n\texpected: %q\n\tactual: %q", controllers.ErrConsentNotFound, err)
+	}
+}
+
+type unavailableConsentRepository struct {
+	MockConsentRepository
+}
+
+func (repo unavailableConsentRepository) DeleteConsent(userID int, clientID string) error {
+	return fmt.Errorf("connection refused")
+}
+
+func TestRevokeConsentReportsRepositoryErrors(t *testing.T) {
+	controller, _ := newTestConsentController()
+	controller.ConsentRepository = unavailableConsentRepository{}
+
+	if err := controller.RevokeConsent(testUserID, testPartnerClient.ID); err == nil || err == controllers.ErrConsentNotFound {
+		t.Fatalf("a failure to delete consent was reported as %q", err)
+	}
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"testing"
+	"time"
+)
+
+type MockDeviceAuthorizationRepository struct {
+	authorizations map[string]models.DeviceAuthorization
+}
+
+func (repo MockDeviceAuthorizationRepository) AddDeviceAuthorization(authorization models.DeviceAuthorization) error {
+	for _, existing := range repo.authorizations {
+		if existing.UserCode == authorization.UserCode {
+			return repositories.ErrUserCodeTaken
+		}
+	}
+
+	repo.authorizations[authorization.DeviceCodeHash] = authorization
+	return nil
+}
+
+func (repo MockDeviceAuthorizationRepository) GetDeviceAuthorizationByDeviceCodeHash(hash string) (models.DeviceAuthorization, error) {
+	authorization, ok := repo.authorizations[hash]
+	if !ok {
+		return authorization, fmt.Errorf("device authorization not found")
+	}
+
+	return authorization, nil
+}
+
+func (repo MockDeviceAuthorizationRepository) GetDeviceAuthorizationByUserCode(userCode string) (models.DeviceAuthorization, error) {
+	for _, authorization := range repo.authorizations {
+		if authorization.UserCode == userCode {
+			return authorization, nil
+		}
+	}
+
+	return models.DeviceAuthorization{}, fmt.Errorf("device authorization not found")
+}
+
+func (repo MockDeviceAuthorizationRepository) UpdateDeviceAuthorizationPoll(hash string, lastPolledAt time.Time, pollInterval int) error {
+	authorization := repo.authorizations[hash]
+	authorization.LastPolledAt = lastPolledAt
+	authorization.PollInterval = pollInterval
+	repo.authorizations[hash] = authorization
+	return nil
+}
+
+func (repo MockDeviceAuthorizationRepository) ResolveDeviceAuthorization(userCode string, status models.DeviceAuthorizationStatus, userID int) error {
+	for hash, authorization := range repo.authorizations {
+		if authorization.UserCode == userCode && authorization.Status == models.DeviceAuthorizationPending {
+			authorization.Status = status
+			authorization.UserID = userID
+			repo.authorizations[hash] = authorization
+			return nil
+		}
+	}
+
+	return fmt.Errorf("device authorization not found")
+}
+
+func (repo MockDeviceAuthorizationRepository) DeleteDeviceAuthorization(hash string) error {
+	if _, ok := repo.authorizations[hash]; !ok {
+		return fmt.Errorf("device authorization not found")
+	}
+
+	delete(repo.authorizations, hash)
+	return nil
+}
+
+var testDeviceClient = models.Client{ID: "cli"}
+
+func startTestDeviceAuthorization(t *testing.T) (controllers.DeviceAuthorizationController, string, models.DeviceAuthorization) {
+	controller := controllers.DeviceAuthorizationController{
+		DeviceAuthorizationRepository: MockDeviceAuthorizationRepository{authorizations: map[string]models.DeviceAuthorization{}},
+	}
+
+	deviceCode, authorization, err := controller.StartDeviceAuthorization(testDeviceClient, "")
+	if err != nil {
+		t.Fatalf("failed to start device authorization: %q", err)
+	}
+
+	return controller, deviceCode, authorization
+}
+
+func TestPollDeviceAuthorizationPendingAndSlowDown(t *testing.T) {
+	controller, deviceCode, _ := startTestDeviceAuthorization(t)
+
+	if _, err := controller.PollDeviceAuthorization(deviceCode, testDeviceClient.ID); err != controllers.ErrAuthorizationPending {
+		t.Fatalf("unexpected error when polling a pending authorization\n\texpected: %q\n\tactual: %q", controllers.ErrAuthorizationPending, err)
+	}
+
+	if _, err := controller.PollDeviceAuthorization(deviceCode, testDeviceClient.ID); err != controllers.ErrSlowDown {
+		t.Fatalf("unexpected error when polling again straight away\n\texpected: %q\n\tactual: %q", controllers.ErrSlowDown, err)
+	}
+}
+
+func TestPollDeviceAuthorizationApproved(t *testing.T) {
+	controller, deviceCode, authorization := startTestDeviceAuthorization(t)
+
+	// users may type the code with the separator shown on the device
+	if err := controller.ResolveDeviceAuthorization(models.FormatUserCode(authorization.UserCode), testUserID, true); err != nil {
+		t.Fatalf("failed to approve device authorization: %q", err)
+	}
+
+	approved, err := controller.PollDeviceAuthorization(deviceCode, testDeviceClient.ID)
+	if err != nil {
+		t.Fatalf("failed to poll approved device authorization: %q", err)
+	}
+	if approved.UserID != testUserID {
+		t.Fatalf("unexpected result\n\texpected: user ID %d\n\tactual: user ID %d", testUserID, approved.UserID)
+	}
+
+	if _, err := controller.PollDeviceAuthorization(deviceCode, testDeviceClient.ID); err != controllers.ErrInvalidDeviceCode {
+		t.Fatalf("device code could be exchanged more than once")
+	}
+}
+
+func TestPollDeviceAuthorizationDenied(t *testing.T) {
+	controller, deviceCode, authorization := startTestDeviceAuthorization(t)
+
+	if err := controller.ResolveDeviceAuthorization(authorization.UserCode, testUserID, false); err != nil {
+		t.Fatalf("failed to deny device authorization: %q", err)
+	}
+
+	if _, err := controller.PollDeviceAuthorization(deviceCode, testDeviceClient.ID); err != controllers.ErrAccessDenied {
+		t.Fatalf("unexpected error when polling a denied authorization\n\texpected: %q\n\tactual: %q", controllers.ErrAccessDenied, err)
+	}
+}
+
+func TestPollDeviceAuthorizationFailsForOtherClient(t *testing.T) {
+	controller, deviceCode, _ := startTestDeviceAuthorization(t)
+
+	if _, err := controller.PollDeviceAuthorization(deviceCode, "otherclient"); err != controllers.ErrInvalidDeviceCode {
+		t.Fatalf("unexpected error when polling with another client's device code\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidDeviceCode, err)
+	}
+}
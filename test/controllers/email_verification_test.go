@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/utils"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testVerifyURL = "https://auth.example.com/v1/auth/verify-email"
+
+var unverifiedUser = models.User{ID: testUserID, PublicID: "user-public-id", Email: "user@example.com"}
+
+func newTestEmailVerification(t *testing.T) (controllers.EmailVerificationController, MockUserRepository, *utils.MemoryMailer) {
+	repo, mailer := newTestUserSetup(t, unverifiedUser)
+
+	return controllers.EmailVerificationController{UserRepository: repo, Mailer: mailer}, repo, mailer
+}
+
+// verificationToken returns the token in the link of a verification email.
+func verificationToken(t *testing.T, email utils.Email) string {
+	for _, line := range strings.Split(email.Body, "\n") {
+		if strings.HasPrefix(line, testVerifyURL+"?") {
+			link, err := url.Parse(line)
+			if err != nil {
+				t.Fatalf("verification email has an invalid link: %q", err)
+			}
+			return link.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("verification email has no link to %s", testVerifyURL)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	controller, repo, mailer := newTestEmailVerification(t)
+
+	if err := controller.SendVerificationEmail(unverifiedUser, testVerifyURL); err != nil {
+		t.Fatalf("failed to send verification email: %q", err)
+	}
+	sent := mailer.Sent()
+	if len(sent) != 1 || sent[0].To != unverifiedUser.Email {
+		t.Fatalf("unexpected emails sent: %v", sent)
+	}
+
+	token := verificationToken(t, sent[0])
+	if _, err := controller.VerifyEmail(token); err != nil {
+		t.Fatalf("failed to verify email: %q", err)
+	}
+	if user, _ := repo.GetUserByID(unverifiedUser.ID); !user.EmailVerified {
+		t.Fatalf("email address was not marked as verified")
+	}
+
+	if _, err := controller.VerifyEmail(token); err != controllers.ErrEmailAlreadyVerified {
+		t.Fatalf("unexpected error when reusing a verification token\n\texpected: %q\n\tactual: %q", controllers.ErrEmailAlreadyVerified, err)
+	}
+}
+
+func TestResendVerificationEmailIsThrottled(t *testing.T) {
+	controller, _, mailer := newTestEmailVerification(t)
+
+	if err := controller.ResendVerificationEmail(unverifiedUser.Email, testVerifyURL); err != nil {
+		t.Fatalf("failed to send verification email: %q", err)
+	}
+	if err := controller.ResendVerificationEmail(unverifiedUser.Email, testVerifyURL); err != controllers.ErrVerificationEmailThrottled {
+		t.Fatalf("unexpected error when resending straight away\n\texpected: %q\n\tactual: %q", controllers.ErrVerificationEmailThrottled, err)
+	}
+	if len(mailer.Sent()) != 1 {
+		t.Fatalf("unexpected number of emails sent\n\texpected: 1\n\tactual: %d", len(mailer.Sent()))
+	}
+}
+
+func TestVerificationTokenForPreviousAddressIsRejected(t *testing.T) {
+	controller, repo, mailer := newTestEmailVerification(t)
+
+	_ = controller.SendVerificationEmail(unverifiedUser, testVerifyURL)
+	changedUser := unverifiedUser
+	changedUser.Email = "new@example.com"
+	repo.users[changedUser.ID] = changedUser
+
+	if _, err := controller.VerifyEmail(verificationToken(t, mailer.Sent()[0])); err != controllers.ErrInvalidVerificationToken {
+		t.Fatalf("unexpected error for a token sent to a previous address\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidVerificationToken, err)
+	}
+}
+
+func TestAccessTokenIsNotAVerificationToken(t *testing.T) {
+	controller, _, _ := newTestEmailVerification(t)
+
+	accessToken, err := models.MintToken(models.NewAccessTokenClaims(unverifiedUser, models.Session{ID: "session"}, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	if _, err := controller.VerifyEmail(accessToken); err != controllers.ErrInvalidVerificationToken {
+		t.Fatalf("unexpected error for an access token\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidVerificationToken, err)
+	}
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type MockLogoutNotifier struct {
+	sessions *[]models.Session
+}
+
+func (notifier MockLogoutNotifier) NotifyLogout(sessions []models.Session) {
+	*notifier.sessions = append(*notifier.sessions, sessions...)
+}
+
+var logoutClient = models.Client{ID: "rp", Name: "Relying Party"}
+
+var loggedOutSession = models.Session{ID: "client-session", UserID: testUserID, ClientID: logoutClient.ID, ParentSessionID: "browser-session"}
+
+// newLogoutReceiver starts a client backchannel logout endpoint that responds
+// with the given statuses in turn and sends each logout token it receives to
+// the returned channel.
+func newLogoutReceiver(t *testing.T, statuses ...int) (*httptest.Server, chan string) {
+	logoutTokens := make(chan string, len(statuses))
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logoutTokens <- r.PostFormValue("logout_token")
+		w.WriteHeader(statuses[attempts])
+		attempts++
+	}))
+	t.Cleanup(receiver.Close)
+
+	return receiver, logoutTokens
+}
+
+func newTestBackchannelLogout(t *testing.T, client models.Client) controllers.BackchannelLogout {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	return controllers.BackchannelLogout{
+		ClientRepository: MockClientRepository{clients: map[string]models.Client{client.ID: client}},
+		UserRepository:   MockUserRepository{users: map[int]models.User{testUserID: {ID: testUserID, PublicID: "user-public-id"}}},
+		RetryDelays:      []time.Duration{time.Millisecond, time.Millisecond},
+	}
+}
+
+func TestDeliverLogoutToken(t *testing.T) {
+	receiver, logoutTokens := newLogoutReceiver(t, http.StatusOK)
+	client := logoutClient
+	client.BackchannelLogoutURI = receiver.URL
+	backchannelLogout := newTestBackchannelLogout(t, client)
+
+	if err := backchannelLogout.DeliverLogoutToken(client, loggedOutSession); err != nil {
+		t.Fatalf("failed to deliver logout token: %q", err)
+	}
+
+	var claims models.LogoutTokenClaims
+	token, err := jwt.ParseWithClaims(<-logoutTokens, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		t.Fatalf("client received an invalid logout token: %q", err)
+	}
+	if token.Header["typ"] != "logout+jwt" {
+		t.Fatalf("unexpected typ header\n\texpected: logout+jwt\n\tactual: %v", token.Header["typ"])
+	}
+	if !claims.VerifyAudience(client.ID, true) || claims.Subject != "user-public-id" || claims.SessionID != "browser-session" {
+		t.Fatalf("unexpected claims in logout token: aud %q, sub %q, sid %q", claims.Audience, claims.Subject, claims.SessionID)
+	}
+	if _, ok := claims.Events[models.BackchannelLogoutEvent]; !ok || claims.ID == "" {
+		t.Fatalf("logout token has no backchannel logout event or jti")
+	}
+}
+
+func TestDeliverLogoutTokenRetries(t *testing.T) {
+	receiver, logoutTokens := newLogoutReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	client := logoutClient
+	client.BackchannelLogoutURI = receiver.URL
+
+	if err := newTestBackchannelLogout(t, client).DeliverLogoutToken(client, loggedOutSession); err != nil {
+		t.Fatalf("failed to deliver logout token after a retry: %q", err)
+	}
+	if len(logoutTokens) != 2 {
+		t.Fatalf("unexpected number of delivery attempts\n\texpected: 2\n\tactual: %d", len(logoutTokens))
+	}
+}
+
+func TestDeliverRejectedLogoutTokenIsNotRetried(t *testing.T) {
+	receiver, logoutTokens := newLogoutReceiver(t, http.StatusBadRequest, http.StatusOK)
+	client := logoutClient
+	client.BackchannelLogoutURI = receiver.URL
+
+	if err := newTestBackchannelLogout(t, client).DeliverLogoutToken(client, loggedOutSession); err == nil {
+		t.Fatalf("no error was returned for a logout token the client rejected")
+	}
+	if len(logoutTokens) != 1 {
+		t.Fatalf("unexpected number of delivery attempts\n\texpected: 1\n\tactual: %d", len(logoutTokens))
+	}
+}
+
+func TestDeliverLogoutTokenOfSelfRegisteredClientOnlyToPublicAddresses(t *testing.T) {
+	receiver, logoutTokens := newLogoutReceiver(t, http.StatusOK)
+	client := logoutClient
+	client.BackchannelLogoutURI = receiver.URL
+	client.RegistrationTokenHash = "hash"
+	backchannelLogout := newTestBackchannelLogout(t, client)
+	backchannelLogout.PublicHTTPClient = utils.NewPublicHTTPClient(time.Second)
+	backchannelLogout.RetryDelays = nil
+
+	if err := backchannelLogout.DeliverLogoutToken(client, loggedOutSession); err == nil {
+		t.Fatalf("logout token of a self registered client was delivered to a loopback address")
+	}
+	if len(logoutTokens) != 0 {
+		t.Fatalf("the loopback address received a logout token")
+	}
+
+	// clients added by an admin may be on the internal network
+	client.RegistrationTokenHash = ""
+	if err := backchannelLogout.DeliverLogoutToken(client, loggedOutSession); err != nil {
+		t.Fatalf("failed to deliver logout token to a client added by an admin: %q", err)
+	}
+}
+
+func TestNotifyLogoutInBackground(t *testing.T) {
+	receiver, logoutTokens := newLogoutReceiver(t, http.StatusOK)
+	client := logoutClient
+	client.BackchannelLogoutURI = receiver.URL
+
+	// both sessions are identified by the same sid, so one logout token covers them
+	otherSession := loggedOutSession
+	otherSession.ID = "other-client-session"
+	newTestBackchannelLogout(t, client).NotifyLogout([]models.Session{loggedOutSession, otherSession, {ID: "browser-session", UserID: testUserID}})
+
+	select {
+	case <-logoutTokens:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("no logout token was delivered")
+	}
+	time.Sleep(time.Millisecond * 50)
+	if len(logoutTokens) != 0 {
+		t.Fatalf("the same logout token was delivered more than once")
+	}
+}
+
+func TestEndSessionEndsClientSessions(t *testing.T) {
+	var notifiedSessions []models.Session
+	repo := MockSessionRepository{
+		sessions: map[string]models.Session{
+			"browser-session":       {ID: "browser-session", UserID: testUserID},
+			loggedOutSession.ID:     loggedOutSession,
+			"unrelated-app-session": {ID: "unrelated-app-session", UserID: testUserID, ClientID: logoutClient.ID},
+		},
+		rotatedHashes: map[string]string{},
+	}
+	controller := controllers.SessionController{SessionRepository: repo, LogoutNotifier: MockLogoutNotifier{sessions: &notifiedSessions}}
+
+	endedSessions, err := controller.EndSession(repo.sessions["browser-session"])
+	if err != nil {
+		t.Fatalf("failed to end session: %q", err)
+	}
+
+	if len(endedSessions) != 2 || len(notifiedSessions) != 2 {
+		t.Fatalf("unexpected sessions ended\n\texpected: 2 ended and notified\n\tactual: %d ended, %d notified", len(endedSessions), len(notifiedSessions))
+	}
+	if _, err := repo.GetSessionByID(loggedOutSession.ID); err == nil {
+		t.Fatalf("client session authorized from the ended session was not ended")
+	}
+	if _, err := repo.GetSessionByID("unrelated-app-session"); err != nil {
+		t.Fatalf("a client session not authorized from the ended session was ended")
+	}
+}
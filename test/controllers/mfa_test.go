@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"encoding/base32"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+type MockMFARepository struct {
+	enrollments   map[int]models.TOTPEnrollment
+	recoveryCodes map[string]int
+}
+
+func (repo MockMFARepository) SetTOTPEnrollment(enrollment models.TOTPEnrollment) error {
+	if existing, ok := repo.enrollments[enrollment.UserID]; ok {
+		enrollment.FailedAttempts = existing.FailedAttempts
+		enrollment.LockedUntil = existing.LockedUntil
+	}
+	repo.enrollments[enrollment.UserID] = enrollment
+	return nil
+}
+
+func (repo MockMFARepository) GetTOTPEnrollment(userID int) (models.TOTPEnrollment, error) {
+	enrollment, ok := repo.enrollments[userID]
+	if !ok {
+		return enrollment, repositories.ErrTOTPNotEnrolled
+	}
+
+	return enrollment, nil
+}
+
+func (repo MockMFARepository) ConfirmTOTPEnrollment(userID int, step int64) error {
+	enrollment := repo.enrollments[userID]
+	enrollment.Confirmed = true
+	enrollment.LastUsedStep = step
+	repo.enrollments[userID] = enrollment
+	return nil
+}
+
+func (repo MockMFARepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	enrollment, ok := repo.enrollments[userID]
+	if !ok || !enrollment.Confirmed || enrollment.LastUsedStep >= step {
+		return false, nil
+	}
+
+	enrollment.LastUsedStep = step
+	repo.enrollments[userID] = enrollment
+	return true, nil
+}
+
+func (repo MockMFARepository) RecordFailedAttempt(userID int, maxAttempts int, lockedUntil time.Time) error {
+	enrollment, ok := repo.enrollments[userID]
+	if !ok {
+		return nil
+	}
+
+	enrollment.FailedAttempts++
+	if enrollment.FailedAttempts%maxAttempts == 0 {
+		enrollment.LockedUntil = lockedUntil
+	}
+	repo.enrollments[userID] = enrollment
+	return nil
+}
+
+func (repo MockMFARepository) ResetFailedAttempts(userID int) error {
+	if enrollment, ok := repo.enrollments[userID]; ok {
+		enrollment.FailedAttempts = 0
+		repo.enrollments[userID] = enrollment
+	}
+
+	return nil
+}
+
+func (repo MockMFARepository) DeleteTOTPEnrollment(userID int) error {
+	delete(repo.enrollments, userID)
+	for codeHash, id := range repo.recoveryCodes {
+		if id == userID {
+			delete(repo.recoveryCodes, codeHash)
+		}
+	}
+
+	return nil
+}
+
+func (repo MockMFARepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	for codeHash, id := range repo.recoveryCodes {
+		if id == userID {
+			delete(repo.recoveryCodes, codeHash)
+		}
+	}
+	for _, codeHash := range codeHashes {
+		repo.recoveryCodes[codeHash] = userID
+	}
+
+	return nil
+}
+
+func (repo MockMFARepository) ConsumeRecoveryCode(userID int, codeHash string) (bool, error) {
+	if id, ok := repo.recoveryCodes[codeHash]; !ok || id != userID {
+		return false, nil
+	}
+
+	delete(repo.recoveryCodes, codeHash)
+	return true, nil
+}
+
+func newTestMFAController(t *testing.T, user models.User) (controllers.MFAController, MockMFARepository) {
+	userRepo, _ := newTestUserSetup(t, user)
+	repo := MockMFARepository{enrollments: map[int]models.TOTPEnrollment{}, recoveryCodes: map[string]int{}}
+	controller := controllers.MFAController{
+		MFARepository:  repo,
+		UserRepository: userRepo,
+		Denylist:       repositories.NewMemoryTokenDenylist(),
+	}
+
+	return controller, repo
+}
+
+// enrollTestUser sets up an authenticator for the user the way a user would,
+// returning its secret and the recovery codes they were given.
+func enrollTestUser(t *testing.T, controller controllers.MFAController, user models.User) ([]byte, []string) {
+	encodedSecret, keyURI, err := controller.BeginTOTPEnrollment(user, false)
+	if err != nil {
+		t.Fatalf("failed to begin TOTP enrollment: %q", err)
+	}
+	if !strings.HasPrefix(keyURI, "otpauth://totp/") || !strings.Contains(keyURI, "secret="+encodedSecret) {
+		t.Fatalf("unexpected key URI %q", keyURI)
+	}
+
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encodedSecret)
+	if err != nil {
+		t.Fatalf("secret is not base32 encoded: %q", err)
+	}
+
+	recoveryCodes, err := controller.ConfirmTOTPEnrollment(user.ID, utils.TOTPCode(secret, utils.TOTPStep(time.Now())))
+	if err != nil {
+		t.Fatalf("failed to confirm TOTP enrollment: %q", err)
+	}
+
+	return secret, recoveryCodes
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	controller, repo := newTestMFAController(t, unverifiedUser)
+
+	if enabled, _ := controller.MFAEnabled(testUserID); enabled {
+		t.Fatalf("MFA is enabled before enrolling")
+	}
+
+	secret, recoveryCodes := enrollTestUser(t, controller, unverifiedUser)
+
+	if enabled, _ := controller.MFAEnabled(testUserID); !enabled {
+		t.Fatalf("MFA is not enabled after confirming the authenticator")
+	}
+	if len(recoveryCodes) != models.RecoveryCodeCount {
+		t.Fatalf("unexpected number of recovery codes\n\texpected: %d\n\tactual: %d", models.RecoveryCodeCount, len(recoveryCodes))
+	}
+	if strings.Contains(repo.enrollments[testUserID].Secret, utils.EncodeTOTPSecret(secret)) {
+		t.Fatalf("TOTP secret is stored unencrypted")
+	}
+	if _, _, err := controller.BeginTOTPEnrollment(unverifiedUser, true); err != controllers.ErrMFAAlreadyEnabled {
+		t.Fatalf("unexpected error enrolling again\n\texpected: %q\n\tactual: %q", controllers.ErrMFAAlreadyEnabled, err)
+	}
+}
+
+func TestConfirmTOTPEnrollmentFailsWrongCode(t *testing.T) {
+	controller, _ := newTestMFAController(t, unverifiedUser)
+
+	if _, _, err := controller.BeginTOTPEnrollment(unverifiedUser, false); err != nil {
+		t.Fatalf("failed to begin TOTP enrollment: %q", err)
+	}
+	if _, err := controller.ConfirmTOTPEnrollment(testUserID, "000000x"); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("unexpected error for a wrong code\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidMFACode, err)
+	}
+	if enabled, _ := controller.MFAEnabled(testUserID); enabled {
+		t.Fatalf("MFA is enabled without confirming the authenticator")
+	}
+}
+
+func TestVerifyCodeCannotBeReused(t *testing.T) {
+	controller, _ := newTestMFAController(t, unverifiedUser)
+	secret, recoveryCodes := enrollTestUser(t, controller, unverifiedUser)
+
+	// the code the authenticator was confirmed with is used up
+	if _, err := controller.VerifyCode(testUserID, utils.TOTPCode(secret, utils.TOTPStep(time.Now()))); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("the code the authenticator was confirmed with was accepted again")
+	}
+
+	nextCode := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+1)
+	methods, err := controller.VerifyCode(testUserID, nextCode)
+	if err != nil {
+		t.Fatalf("failed to verify TOTP code: %q", err)
+	}
+	if strings.Join(methods, " ") != "otp mfa" {
+		t.Fatalf("unexpected authentication methods %q", methods)
+	}
+	if _, err := controller.VerifyCode(testUserID, nextCode); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("a TOTP code was accepted twice")
+	}
+
+	// recovery codes are accepted however they are typed, but only once
+	recoveryCode := strings.ToLower(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	if _, err := controller.VerifyCode(testUserID, recoveryCode); err != nil {
+		t.Fatalf("failed to verify recovery code: %q", err)
+	}
+	if _, err := controller.VerifyCode(testUserID, recoveryCodes[0]); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("a recovery code was accepted twice")
+	}
+}
+
+func TestRecoveryCodesAreStoredKeyed(t *testing.T) {
+	controller, repo := newTestMFAController(t, unverifiedUser)
+	_, recoveryCodes := enrollTestUser(t, controller, unverifiedUser)
+
+	for _, recoveryCode := range recoveryCodes {
+		if _, ok := repo.recoveryCodes[utils.HashToken(strings.ReplaceAll(recoveryCode, "-", ""))]; ok {
+			t.Fatalf("recovery code is stored with an unkeyed hash")
+		}
+	}
+}
+
+func TestVerifyCodeLocksOutAfterTooManyWrongCodes(t *testing.T) {
+	controller, repo := newTestMFAController(t, unverifiedUser)
+	secret, recoveryCodes := enrollTestUser(t, controller, unverifiedUser)
+
+	for i := 0; i < models.MaxFailedMFAAttempts; i++ {
+		if _, err := controller.VerifyCode(testUserID, "000000x"); err != controllers.ErrInvalidMFACode {
+			t.Fatalf("unexpected error for wrong code %d\n\texpected: %q\n\tactual: %q", i+1, controllers.ErrInvalidMFACode, err)
+		}
+	}
+
+	// even correct codes are refused while locked out
+	nextCode := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+1)
+	if _, err := controller.VerifyCode(testUserID, nextCode); err != controllers.ErrMFALocked {
+		t.Fatalf("unexpected error while locked out\n\texpected: %q\n\tactual: %q", controllers.ErrMFALocked, err)
+	}
+	if _, err := controller.RegenerateRecoveryCodes(testUserID, recoveryCodes[0]); err != controllers.ErrMFALocked {
+		t.Fatalf("recovery codes were regenerated while locked out")
+	}
+	if err := controller.DisableTOTP(unverifiedUser, recoveryCodes[0]); err != controllers.ErrMFALocked {
+		t.Fatalf("MFA was disabled while locked out")
+	}
+
+	enrollment := repo.enrollments[testUserID]
+	enrollment.LockedUntil = time.Now().Add(-time.Second)
+	repo.enrollments[testUserID] = enrollment
+	if _, err := controller.VerifyCode(testUserID, nextCode); err != nil {
+		t.Fatalf("failed to verify code after the lockout ended: %q", err)
+	}
+	if repo.enrollments[testUserID].FailedAttempts != 0 {
+		t.Fatalf("wrong codes were still counted after a correct one")
+	}
+}
+
+func TestConfirmTOTPEnrollmentLocksOutAfterTooManyWrongCodes(t *testing.T) {
+	controller, _ := newTestMFAController(t, unverifiedUser)
+
+	if _, _, err := controller.BeginTOTPEnrollment(unverifiedUser, false); err != nil {
+		t.Fatalf("failed to begin TOTP enrollment: %q", err)
+	}
+	for i := 0; i < models.MaxFailedMFAAttempts; i++ {
+		_, _ = controller.ConfirmTOTPEnrollment(testUserID, "000000x")
+	}
+	if _, err := controller.ConfirmTOTPEnrollment(testUserID, "000000x"); err != controllers.ErrMFALocked {
+		t.Fatalf("unexpected error while locked out\n\texpected: %q\n\tactual: %q", controllers.ErrMFALocked, err)
+	}
+
+	// starting over does not lift the lockout
+	if _, _, err := controller.BeginTOTPEnrollment(unverifiedUser, false); err != nil {
+		t.Fatalf("failed to begin TOTP enrollment again: %q", err)
+	}
+	if _, err := controller.ConfirmTOTPEnrollment(testUserID, "000000x"); err != controllers.ErrMFALocked {
+		t.Fatalf("lockout was lifted by beginning enrollment again")
+	}
+}
+
+func TestAuthorizeFactorChange(t *testing.T) {
+	controller, _ := newTestMFAController(t, unverifiedUser)
+
+	if err := controller.AuthorizeFactorChange(testUserID, false); err != nil {
+		t.Fatalf("a user without MFA was refused a factor change: %q", err)
+	}
+
+	enrollTestUser(t, controller, unverifiedUser)
+	if err := controller.AuthorizeFactorChange(testUserID, false); err != controllers.ErrMFAReauthenticationRequired {
+		t.Fatalf("unexpected error changing factors without MFA\n\texpected: %q\n\tactual: %q", controllers.ErrMFAReauthenticationRequired, err)
+	}
+	if err := controller.AuthorizeFactorChange(testUserID, true); err != nil {
+		t.Fatalf("a session signed in with MFA was refused a factor change: %q", err)
+	}
+}
+
+func TestCompleteChallengeAllowsOneAttempt(t *testing.T) {
+	controller, _ := newTestMFAController(t, unverifiedUser)
+	secret, _ := enrollTestUser(t, controller, unverifiedUser)
+
+	challengeToken, _, err := controller.StartChallenge(unverifiedUser, "laptop")
+	if err != nil {
+		t.Fatalf("failed to start MFA challenge: %q", err)
+	}
+	if _, _, _, err := controller.CompleteChallenge(challengeToken, "123456x"); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("unexpected error for a wrong code\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidMFACode, err)
+	}
+
+	nextCode := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+1)
+	if _, _, _, err := controller.CompleteChallenge(challengeToken, nextCode); err != controllers.ErrInvalidMFAChallenge {
+		t.Fatalf("unexpected error reusing a challenge\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidMFAChallenge, err)
+	}
+
+	challengeToken, _, _ = controller.StartChallenge(unverifiedUser, "laptop")
+	user, methods, deviceLabel, err := controller.CompleteChallenge(challengeToken, nextCode)
+	if err != nil {
+		t.Fatalf("failed to complete MFA challenge: %q", err)
+	}
+	if user.ID != testUserID || deviceLabel != "laptop" || strings.Join(methods, " ") != "pwd otp mfa" {
+		t.Fatalf("unexpected outcome of MFA challenge: user ID %d, device label %q, methods %q", user.ID, deviceLabel, methods)
+	}
+}
+
+func TestDisableTOTPRefusedForAdmins(t *testing.T) {
+	admin := unverifiedUser
+	admin.UserRoles = []models.Roles{models.UserRole, models.AdminRole}
+	controller, _ := newTestMFAController(t, admin)
+	secret, _ := enrollTestUser(t, controller, admin)
+
+	nextCode := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+1)
+	if err := controller.DisableTOTP(admin, nextCode); err != controllers.ErrMFARequiredForAdmins {
+		t.Fatalf("unexpected error disabling MFA of an admin\n\texpected: %q\n\tactual: %q", controllers.ErrMFARequiredForAdmins, err)
+	}
+	if enabled, _ := controller.MFAEnabled(testUserID); !enabled {
+		t.Fatalf("MFA of an admin was disabled")
+	}
+}
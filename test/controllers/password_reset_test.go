@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/utils"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockPasswordResetRepository struct {
+	tokens map[string]models.PasswordResetToken
+}
+
+func (repo MockPasswordResetRepository) AddPasswordResetToken(token models.PasswordResetToken) error {
+	repo.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (repo MockPasswordResetRepository) ConsumePasswordResetToken(tokenHash string) (models.PasswordResetToken, error) {
+	token, ok := repo.tokens[tokenHash]
+	if !ok {
+		return token, fmt.Errorf("password reset token not found")
+	}
+
+	delete(repo.tokens, tokenHash)
+	return token, nil
+}
+
+func (repo MockPasswordResetRepository) DeletePasswordResetTokensForUser(id int) error {
+	for tokenHash, token := range repo.tokens {
+		if token.UserID == id {
+			delete(repo.tokens, tokenHash)
+		}
+	}
+
+	return nil
+}
+
+const testResetURL = "https://auth.example.com/v1/auth/password/reset"
+
+func newTestPasswordReset(t *testing.T) (controllers.PasswordResetController, MockUserRepository, MockSessionRepository, MockPasswordResetRepository, *utils.MemoryMailer) {
+	userRepo, mailer := newTestUserSetup(t, unverifiedUser)
+	_, sessionRepo := newTestSessionController()
+	resetRepo := MockPasswordResetRepository{tokens: map[string]models.PasswordResetToken{}}
+
+	controller := controllers.PasswordResetController{
+		UserRepository:          userRepo,
+		PasswordResetRepository: resetRepo,
+		SessionController:       controllers.SessionController{SessionRepository: sessionRepo, UserRepository: userRepo},
+		Mailer:                  mailer,
+	}
+
+	return controller, userRepo, sessionRepo, resetRepo, mailer
+}
+
+// passwordResetToken returns the token in the link of the last password
+// reset email sent.
+func passwordResetToken(t *testing.T, mailer *utils.MemoryMailer) string {
+	sent := mailer.Sent()
+	if len(sent) == 0 {
+		t.Fatalf("no password reset email was sent")
+	}
+
+	for _, line := range strings.Split(sent[len(sent)-1].Body, "\n") {
+		if strings.HasPrefix(line, testResetURL+"?") {
+			link, _ := url.Parse(line)
+			return link.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("password reset email has no link to %s", testResetURL)
+	return ""
+}
+
+func TestResetPassword(t *testing.T) {
+	controller, userRepo, sessionRepo, _, mailer := newTestPasswordReset(t)
+
+	if err := controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL); err != nil {
+		t.Fatalf("failed to send password reset email: %q", err)
+	}
+	token := passwordResetToken(t, mailer)
+
+	if err := controller.ResetPassword(token, "new password"); err != nil {
+		t.Fatalf("failed to reset password: %q", err)
+	}
+
+	user, _ := userRepo.GetUserByID(unverifiedUser.ID)
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new password")); err != nil {
+		t.Fatalf("password was not replaced with a hash of the new password")
+	}
+	if user.TokenVersion != unverifiedUser.TokenVersion+1 {
+		t.Fatalf("access tokens issued before the reset were not revoked")
+	}
+	if sessions, _ := sessionRepo.GetSessionsForUser(unverifiedUser.ID); len(sessions) != 0 {
+		t.Fatalf("sessions were not revoked\n\texpected: 0 sessions\n\tactual: %d sessions", len(sessions))
+	}
+
+	if err := controller.ResetPassword(token, "another password"); err != controllers.ErrInvalidPasswordResetToken {
+		t.Fatalf("unexpected error when reusing a password reset token\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasswordResetToken, err)
+	}
+}
+
+func TestResetPasswordFailsExpiredToken(t *testing.T) {
+	controller, _, _, resetRepo, _ := newTestPasswordReset(t)
+
+	_ = resetRepo.AddPasswordResetToken(models.PasswordResetToken{
+		TokenHash: utils.HashToken("expiredtoken"),
+		UserID:    unverifiedUser.ID,
+		ExpiresAt: time.Now().Add(-time.Second),
+	})
+
+	if err := controller.ResetPassword("expiredtoken", "new password"); err != controllers.ErrInvalidPasswordResetToken {
+		t.Fatalf("unexpected error for an expired token\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasswordResetToken, err)
+	}
+}
+
+func TestNewPasswordResetEmailInvalidatesPreviousLinks(t *testing.T) {
+	controller, userRepo, _, _, mailer := newTestPasswordReset(t)
+
+	_ = controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL)
+	previousToken := passwordResetToken(t, mailer)
+	userRepo.resetEmailsSent[unverifiedUser.ID] = time.Now().Add(-models.PasswordResetResendInterval)
+	_ = controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL)
+
+	if err := controller.ResetPassword(previousToken, "new password"); err != controllers.ErrInvalidPasswordResetToken {
+		t.Fatalf("unexpected error for a superseded token\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasswordResetToken, err)
+	}
+	if err := controller.ResetPassword(passwordResetToken(t, mailer), "new password"); err != nil {
+		t.Fatalf("failed to reset password with the latest token: %q", err)
+	}
+}
+
+func TestPasswordResetEmailIsThrottled(t *testing.T) {
+	controller, _, _, _, mailer := newTestPasswordReset(t)
+
+	if err := controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL); err != nil {
+		t.Fatalf("failed to send password reset email: %q", err)
+	}
+	token := passwordResetToken(t, mailer)
+	if err := controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL); err != controllers.ErrPasswordResetThrottled {
+		t.Fatalf("unexpected error when resending straight away\n\texpected: %q\n\tactual: %q", controllers.ErrPasswordResetThrottled, err)
+	}
+	if len(mailer.Sent()) != 1 {
+		t.Fatalf("unexpected number of emails sent\n\texpected: 1\n\tactual: %d", len(mailer.Sent()))
+	}
+	// a throttled request leaves the link already sent working
+	if err := controller.ResetPassword(token, "new password"); err != nil {
+		t.Fatalf("failed to reset password with the link sent first: %q", err)
+	}
+}
+
+func TestResetPasswordRejectsBlankPassword(t *testing.T) {
+	controller, _, _, _, mailer := newTestPasswordReset(t)
+
+	_ = controller.SendPasswordResetEmail(unverifiedUser.Email, testResetURL)
+	if err := controller.ResetPassword(passwordResetToken(t, mailer), "   "); err != controllers.ErrInvalidPassword {
+		t.Fatalf("unexpected error for a blank password\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPassword, err)
+	}
+}
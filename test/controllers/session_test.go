@@ -0,0 +1,393 @@
+package controllers
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"testing"
+	"time"
+)
+
+type MockSessionRepository struct {
+	sessions      map[string]models.Session
+	rotatedHashes map[string]string
+}
+
+func (repo MockSessionRepository) AddSession(session models.Session) (models.Session, error) {
+	repo.sessions[session.ID] = session
+	return session, nil
+}
+
+func (repo MockSessionRepository) GetSessionByID(id string) (models.Session, error) {
+	session, ok := repo.sessions[id]
+	if !ok {
+		return session, repositories.ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (repo MockSessionRepository) GetSessionByRefreshTokenHash(hash string) (models.Session, error) {
+	for _, session := range repo.sessions {
+		if session.RefreshTokenHash == hash {
+			return session, nil
+		}
+	}
+
+	return models.Session{}, repositories.ErrSessionNotFound
+}
+
+func (repo MockSessionRepository) GetSessionByRotatedRefreshTokenHash(hash string) (models.Session, error) {
+	sessionID, ok := repo.rotatedHashes[hash]
+	if !ok {
+		return models.Session{}, repositories.ErrSessionNotFound
+	}
+
+	return repo.GetSessionByID(sessionID)
+}
+
+func (repo MockSessionRepository) GetSessionsForUser(userId int) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range repo.sessions {
+		if session.UserID == userId {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (repo MockSessionRepository) RotateSessionRefreshToken(session models.Session, previousRefreshTokenHash string) error {
+	if current, ok := repo.sessions[session.ID]; !ok || current.RefreshTokenHash != previousRefreshTokenHash {
+		return repositories.ErrRefreshTokenRotated
+	}
+
+	repo.sessions[session.ID] = session
+	repo.rotatedHashes[previousRefreshTokenHash] = session.ID
+	return nil
+}
+
+func (repo MockSessionRepository) DeleteSession(id string) error {
+	delete(repo.sessions, id)
+	return nil
+}
+
+func (repo MockSessionRepository) DeleteSessionsForUser(userId int) error {
+	for id, session := range repo.sessions {
+		if session.UserID == userId {
+			delete(repo.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (repo MockSessionRepository) DeleteClientSessionsForUser(userId int, clientID string) error {
+	for id, session := range repo.sessions {
+		if session.UserID == userId && session.ClientID == clientID {
+			delete(repo.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (repo MockSessionRepository) GetChildSessions(parentID string) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range repo.sessions {
+		if session.ParentSessionID == parentID {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+var testSessionID = "session0"
+var testUserID = 1
+
+func newTestSessionController() (controllers.SessionController, MockSessionRepository) {
+	repo := MockSessionRepository{
+		sessions: map[string]models.Session{
+			testSessionID: {
+				ID:               testSessionID,
+				UserID:           testUserID,
+				RefreshTokenHash: utils.HashToken("refreshtoken1"),
+				ExpiresAt:        time.Now().Add(time.Hour),
+			},
+		},
+		rotatedHashes: map[string]string{},
+	}
+
+	return controllers.SessionController{SessionRepository: repo}, repo
+}
+
+func TestGetSessionForRefreshToken(t *testing.T) {
+	controller, _ := newTestSessionController()
+
+	session, err := controller.GetSessionForRefreshToken("refreshtoken1")
+	if err != nil {
+		t.Fatalf("failed to get session for current refresh token: %q", err)
+	}
+
+	if session.ID != testSessionID {
+		t.Fatalf("unexpected result\n\texpected: session %s\n\tactual: session %s", testSessionID, session.ID)
+	}
+}
+
+func TestGetSessionForRefreshTokenRevokesFamilyOnReuse(t *testing.T) {
+	controller, repo := newTestSessionController()
+
+	session, _ := repo.GetSessionByID(testSessionID)
+	session.RefreshTokenHash = utils.HashToken("refreshtoken2")
+	_ = repo.RotateSessionRefreshToken(session, utils.HashToken("refreshtoken1"))
+
+	_, err := controller.GetSessionForRefreshToken("refreshtoken1")
+	if err != controllers.ErrRefreshTokenReused {
+		t.Fatalf("unexpected error when presenting a rotated refresh token\n\texpected: %q\n\tactual: %q", controllers.ErrRefreshTokenReused, err)
+	}
+
+	if _, err := repo.GetSessionByID(testSessionID); err == nil {
+		t.Fatalf("session was not revoked after refresh token reuse")
+	}
+
+	if _, err := controller.GetSessionForRefreshToken("refreshtoken2"); err == nil {
+		t.Fatalf("no error was thrown when presenting the latest refresh token of a revoked family")
+	}
+}
+
+func TestGetSessionForRefreshTokenFailsUnknownToken(t *testing.T) {
+	controller, _ := newTestSessionController()
+
+	if _, err := controller.GetSessionForRefreshToken("notarefreshtoken"); err == nil {
+		t.Fatalf("no error was thrown when presenting an unknown refresh token")
+	}
+}
+
+// racingSessionRepository rotates the refresh token of a session right before
+// the controller does, as a concurrent refresh with the same token would.
+type racingSessionRepository struct {
+	MockSessionRepository
+}
+
+func (repo racingSessionRepository) RotateSessionRefreshToken(session models.Session, previousRefreshTokenHash string) error {
+	concurrentSession := repo.sessions[session.ID]
+	concurrentSession.RefreshTokenHash = utils.HashToken("concurrentrefreshtoken")
+	_ = repo.MockSessionRepository.RotateSessionRefreshToken(concurrentSession, previousRefreshTokenHash)
+
+	return repo.MockSessionRepository.RotateSessionRefreshToken(session, previousRefreshTokenHash)
+}
+
+func newTestRefreshController(t *testing.T) (controllers.SessionController, MockSessionRepository) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	controller, repo := newTestSessionController()
+	controller.UserRepository = MockUserRepository{users: map[int]models.User{testUserID: {ID: testUserID, PublicID: "user-public-id"}}}
+
+	return controller, repo
+}
+
+func TestRefreshSessionRotatesRefreshToken(t *testing.T) {
+	controller, _ := newTestRefreshController(t)
+
+	user, session, tokens, err := controller.RefreshSession(models.Client{}, "refreshtoken1", "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to refresh session: %q", err)
+	}
+	if user.ID != testUserID || session.ID != testSessionID || tokens.SessionID != testSessionID {
+		t.Fatalf("unexpected result\n\texpected: session %s of user ID %d\n\tactual: session %s of user ID %d", testSessionID, testUserID, session.ID, user.ID)
+	}
+	if tokens.RefreshToken == "refreshtoken1" {
+		t.Fatalf("refresh token was not rotated")
+	}
+
+	if _, _, _, err := controller.RefreshSession(models.Client{}, tokens.RefreshToken, "agent", "127.0.0.1"); err != nil {
+		t.Fatalf("failed to refresh session with the rotated refresh token: %q", err)
+	}
+}
+
+func TestRefreshSessionDetectsReuse(t *testing.T) {
+	controller, repo := newTestRefreshController(t)
+
+	_, _, tokens, err := controller.RefreshSession(models.Client{}, "refreshtoken1", "agent", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to refresh session: %q", err)
+	}
+
+	if _, _, _, err := controller.RefreshSession(models.Client{}, "refreshtoken1", "agent", "127.0.0.1"); err != controllers.ErrRefreshTokenReused {
+		t.Fatalf("unexpected error when presenting a rotated refresh token\n\texpected: %q\n\tactual: %q", controllers.ErrRefreshTokenReused, err)
+	}
+	if _, err := repo.GetSessionByID(testSessionID); err == nil {
+		t.Fatalf("session was not revoked after refresh token reuse")
+	}
+	if _, _, _, err := controller.RefreshSession(models.Client{}, tokens.RefreshToken, "agent", "127.0.0.1"); err == nil {
+		t.Fatalf("no error was thrown when presenting the latest refresh token of a revoked family")
+	}
+}
+
+func TestRefreshSessionDetectsConcurrentRotation(t *testing.T) {
+	controller, repo := newTestRefreshController(t)
+	controller.SessionRepository = racingSessionRepository{repo}
+
+	if _, _, _, err := controller.RefreshSession(models.Client{}, "refreshtoken1", "agent", "127.0.0.1"); err != controllers.ErrRefreshTokenReused {
+		t.Fatalf("unexpected error when the refresh token was rotated concurrently\n\texpected: %q\n\tactual: %q", controllers.ErrRefreshTokenReused, err)
+	}
+	if _, err := repo.GetSessionByID(testSessionID); err == nil {
+		t.Fatalf("session was not revoked after concurrent rotation")
+	}
+}
+
+func TestRefreshSessionFailsForOtherClient(t *testing.T) {
+	controller, repo := newTestRefreshController(t)
+	session, _ := repo.GetSessionByID(testSessionID)
+	session.ClientID = "client"
+	repo.sessions[testSessionID] = session
+
+	if _, _, _, err := controller.RefreshSession(models.Client{}, "refreshtoken1", "agent", "127.0.0.1"); err != controllers.ErrInvalidRefreshToken {
+		t.Fatalf("unexpected error when refreshing a client session as a first party\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidRefreshToken, err)
+	}
+	if _, _, _, err := controller.RefreshSession(models.Client{ID: "other-client"}, "refreshtoken1", "agent", "127.0.0.1"); err != controllers.ErrInvalidRefreshToken {
+		t.Fatalf("unexpected error when refreshing a session of another client\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidRefreshToken, err)
+	}
+	if _, _, _, err := controller.RefreshSession(models.Client{ID: "client"}, "refreshtoken1", "agent", "127.0.0.1"); err != nil {
+		t.Fatalf("failed to refresh session of the client: %q", err)
+	}
+}
+
+func TestIssuedPairwiseSubjectResolvesToUser(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	user := models.User{ID: testUserID, PublicID: "user-public-id"}
+	userRepo := MockUserRepository{users: map[int]models.User{user.ID: user}, pairwiseSubjects: map[string]int{}}
+	client := models.Client{ID: "partner", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://partner.example.com/callback"}}
+
+	controller, _ := newTestSessionController()
+	controller.UserRepository = userRepo
+	tokens, err := controller.IssueClientTokens(client, user, models.Session{UserID: user.ID, ClientID: client.ID})
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %q", err)
+	}
+
+	claims, err := controllers.TokenController{UserRepository: userRepo}.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("access token with a pairwise subject is not valid: %q", err)
+	}
+	if claims.Subject == user.PublicID {
+		t.Fatalf("pairwise client was issued the public subject")
+	}
+	if userID, err := claims.UserID(); err != nil || userID != user.ID {
+		t.Fatalf("pairwise subject did not resolve to the user\n\texpected: %d\n\tactual: %d", user.ID, userID)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	var notifiedSessions []models.Session
+	controller, repo := newTestSessionController()
+	controller.LogoutNotifier = MockLogoutNotifier{sessions: &notifiedSessions}
+	repo.sessions["other-session"] = models.Session{ID: "other-session", UserID: testUserID}
+	repo.sessions["other-users-session"] = models.Session{ID: "other-users-session", UserID: testUserID + 1}
+
+	if err := controller.RevokeOtherSessions(testUserID, testSessionID); err != nil {
+		t.Fatalf("failed to revoke other sessions: %q", err)
+	}
+
+	if _, err := repo.GetSessionByID(testSessionID); err != nil {
+		t.Fatalf("the current session was revoked")
+	}
+	if _, err := repo.GetSessionByID("other-session"); err == nil {
+		t.Fatalf("another session of the user was not revoked")
+	}
+	if _, err := repo.GetSessionByID("other-users-session"); err != nil {
+		t.Fatalf("a session of another user was revoked")
+	}
+	if len(notifiedSessions) != 1 {
+		t.Fatalf("unexpected sessions notified\n\texpected: 1\n\tactual: %d", len(notifiedSessions))
+	}
+}
+
+func TestGetSessions(t *testing.T) {
+	controller, repo := newTestSessionController()
+	repo.sessions["other-users-session"] = models.Session{ID: "other-users-session", UserID: testUserID + 1}
+
+	sessions, err := controller.GetSessions(testUserID)
+	if err != nil {
+		t.Fatalf("failed to get sessions: %q", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != testSessionID {
+		t.Fatalf("unexpected sessions\n\texpected: [%s]\n\tactual: %v", testSessionID, sessions)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	var notifiedSessions []models.Session
+	controller, repo := newTestSessionController()
+	controller.LogoutNotifier = MockLogoutNotifier{sessions: &notifiedSessions}
+	repo.sessions["client-session"] = models.Session{ID: "client-session", UserID: testUserID, ClientID: "client", ParentSessionID: testSessionID}
+
+	if err := controller.RevokeSession(testUserID, testSessionID); err != nil {
+		t.Fatalf("failed to revoke session: %q", err)
+	}
+
+	if _, err := repo.GetSessionByID(testSessionID); err == nil {
+		t.Fatalf("session was not revoked")
+	}
+	if _, err := repo.GetSessionByID("client-session"); err == nil {
+		t.Fatalf("client session authorized from the revoked session was not ended")
+	}
+	if len(notifiedSessions) != 2 {
+		t.Fatalf("unexpected sessions notified\n\texpected: 2\n\tactual: %d", len(notifiedSessions))
+	}
+}
+
+func TestRevokeSessionFailsForOtherUser(t *testing.T) {
+	controller, repo := newTestSessionController()
+
+	if err := controller.RevokeSession(testUserID+1, testSessionID); err != controllers.ErrSessionNotFound {
+		t.Fatalf("unexpected error when revoking a session of another user\n\texpected: %q\n\tactual: %q", controllers.ErrSessionNotFound, err)
+	}
+	if _, err := repo.GetSessionByID(testSessionID); err != nil {
+		t.Fatalf("session of another user was revoked")
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	var notifiedSessions []models.Session
+	user := models.User{ID: testUserID, PublicID: "user-public-id"}
+	userRepo := MockUserRepository{users: map[int]models.User{user.ID: user}}
+	controller, repo := newTestSessionController()
+	controller.UserRepository = userRepo
+	controller.LogoutNotifier = MockLogoutNotifier{sessions: &notifiedSessions}
+	repo.sessions["other-users-session"] = models.Session{ID: "other-users-session", UserID: testUserID + 1}
+
+	session, _ := repo.GetSessionByID(testSessionID)
+	accessToken, err := models.MintToken(models.NewAccessTokenClaims(user, session, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	if err := controller.RevokeAllSessions(testUserID); err != nil {
+		t.Fatalf("failed to revoke all sessions: %q", err)
+	}
+
+	if version, _ := userRepo.GetTokenVersion(testUserID); version != user.TokenVersion+1 {
+		t.Fatalf("unexpected token version\n\texpected: %d\n\tactual: %d", user.TokenVersion+1, version)
+	}
+	if _, err := (controllers.TokenController{UserRepository: userRepo}).ValidateAccessToken(accessToken); err == nil {
+		t.Fatalf("access token issued before logging out everywhere is still valid")
+	}
+	if _, err := repo.GetSessionByID(testSessionID); err == nil {
+		t.Fatalf("session of the user was not revoked")
+	}
+	if _, err := repo.GetSessionByID("other-users-session"); err != nil {
+		t.Fatalf("a session of another user was revoked")
+	}
+	if len(notifiedSessions) != 1 {
+		t.Fatalf("unexpected sessions notified\n\texpected: 1\n\tactual: %d", len(notifiedSessions))
+	}
+}
@@ -0,0 +1,505 @@
+package controllers
+
+import (
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/utils"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockUserRepository struct {
+	users                  map[int]models.User
+	pairwiseSubjects       map[string]int
+	verificationEmailsSent map[int]time.Time
+	resetEmailsSent        map[int]time.Time
+}
+
+// newTestUserSetup returns a user repository holding the users and a mailer
+// recording the emails sent to them, with the signing key the controllers
+// mint tokens with configured.
+func newTestUserSetup(t *testing.T, users ...models.User) (MockUserRepository, *utils.MemoryMailer) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	repo := MockUserRepository{
+		users:                  map[int]models.User{},
+		pairwiseSubjects:       map[string]int{},
+		verificationEmailsSent: map[int]time.Time{},
+		resetEmailsSent:        map[int]time.Time{},
+	}
+	for _, user := range users {
+		repo.users[user.ID] = user
+	}
+
+	return repo, utils.NewMemoryMailer()
+}
+
+func (repo MockUserRepository) AddUser(user models.User) (models.User, error) {
+	repo.users[user.ID] = user
+	return user, nil
+}
+
+func (repo MockUserRepository) DeleteUser(id int) error {
+	delete(repo.users, id)
+	return nil
+}
+
+func (repo MockUserRepository) GetUserByID(id int) (models.User, error) {
+	user, ok := repo.users[id]
+	if !ok {
+		return user, fmt.Errorf("user not found")
+	}
+
+	return user, nil
+}
+
+func (repo MockUserRepository) GetUserByEmail(email string) (models.User, error) {
+	for _, user := range repo.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return models.User{}, fmt.Errorf("user not found")
+}
+
+func (repo MockUserRepository) GetUserWithCredentials(email string, password string) (models.User, error) {
+	user, err := repo.GetUserByEmail(email)
+	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return models.User{}, fmt.Errorf("invalid credentials")
+	}
+
+	return user, nil
+}
+
+func (repo MockUserRepository) GetTokenVersion(id int) (int, error) {
+	user, err := repo.GetUserByID(id)
+	return user.TokenVersion, err
+}
+
+func (repo MockUserRepository) IncrementTokenVersion(id int) error {
+	user, err := repo.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.TokenVersion++
+	repo.users[id] = user
+	return nil
+}
+
+func (repo MockUserRepository) AddPairwiseSubject(subject string, id int, sectorIdentifier string) error {
+	repo.pairwiseSubjects[subject] = id
+	return nil
+}
+
+func (repo MockUserRepository) GetUserIDForSubject(subject string) (int, error) {
+	for _, user := range repo.users {
+		if user.PublicID == subject {
+			return user.ID, nil
+		}
+	}
+	if id, ok := repo.pairwiseSubjects[subject]; ok {
+		return id, nil
+	}
+
+	return 0, fmt.Errorf("user not found")
+}
+
+func (repo MockUserRepository) SetEmailVerified(id int) error {
+	user, err := repo.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.EmailVerified = true
+	repo.users[id] = user
+	return nil
+}
+
+func (repo MockUserRepository) MarkVerificationEmailSent(id int, notSentSince time.Time) (bool, error) {
+	user, err := repo.GetUserByID(id)
+	if err != nil || user.EmailVerified {
+		return false, err
+	}
+	if sentAt, ok := repo.verificationEmailsSent[id]; ok && !sentAt.Before(notSentSince) {
+		return false, nil
+	}
+
+	repo.verificationEmailsSent[id] = time.Now()
+	return true, nil
+}
+
+func (repo MockUserRepository) MarkPasswordResetEmailSent(id int, notSentSince time.Time) (bool, error) {
+	if _, err := repo.GetUserByID(id); err != nil {
+		return false, err
+	}
+	if sentAt, ok := repo.resetEmailsSent[id]; ok && !sentAt.Before(notSentSince) {
+		return false, nil
+	}
+
+	repo.resetEmailsSent[id] = time.Now()
+	return true, nil
+}
+
+func (repo MockUserRepository) UpdatePassword(id int, passwordHash string) error {
+	user, err := repo.GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	user.Password = passwordHash
+	repo.users[id] = user
+	return nil
+}
+
+var exchangingClient = models.Client{
+	ID:               "orders-api",
+	Name:             "Orders API",
+	GrantTypes:       []string{models.GrantTypeTokenExchange},
+	Scopes:           []string{"orders", "payments"},
+	AllowedAudiences: []string{"payments-api"},
+}
+
+// newTestExchange returns a token controller with a user, and an access
+// token that user's app obtained with the given scope.
+func newTestExchange(t *testing.T, scope string) (controllers.TokenController, string) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	user := models.User{ID: 1, PublicID: "user-public-id", Email: "user@example.com", UserRoles: []models.Roles{models.AdminRole}}
+	tokenController := controllers.TokenController{
+		UserRepository:   MockUserRepository{users: map[int]models.User{user.ID: user}},
+		ClientRepository: MockClientRepository{clients: map[string]models.Client{exchangingClient.ID: exchangingClient}},
+	}
+
+	session := models.Session{ID: "session", ClientID: "web-app", Scope: scope}
+	subjectToken, err := models.MintToken(models.NewAccessTokenClaims(user, session, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint subject token: %q", err)
+	}
+
+	return tokenController, subjectToken
+}
+
+func TestExchangeToken(t *testing.T) {
+	tokenController, subjectToken := newTestExchange(t, "orders payments")
+
+	token, _, err := tokenController.ExchangeToken(exchangingClient, subjectToken, "payments-api", "payments")
+	if err != nil {
+		t.Fatalf("failed to exchange token: %q", err)
+	}
+
+	claims, err := tokenController.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("exchanged token is not valid: %q", err)
+	}
+	if claims.Subject != "user-public-id" || claims.Scope != "payments" || claims.ClientID != exchangingClient.ID {
+		t.Fatalf("unexpected claims in exchanged token: sub %q, scope %q, client_id %q", claims.Subject, claims.Scope, claims.ClientID)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != "payments-api" {
+		t.Fatalf("unexpected audience\n\texpected: [payments-api]\n\tactual: %q", claims.Audience)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != exchangingClient.ID {
+		t.Fatalf("exchanged token does not name the client as its actor")
+	}
+	if len(claims.UserRoles) != 0 {
+		t.Fatalf("exchanged token for a third party client kept the user's roles")
+	}
+	if claims.ExpiresAt.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("exchanged token outlives the subject token")
+	}
+}
+
+func TestExchangeTokenCannotWidenScope(t *testing.T) {
+	tokenController, subjectToken := newTestExchange(t, "orders")
+
+	if _, _, err := tokenController.ExchangeToken(exchangingClient, subjectToken, "payments-api", "orders payments"); err != controllers.ErrScopeNotAllowed {
+		t.Fatalf("unexpected error when widening the scope\n\texpected: %q\n\tactual: %q", controllers.ErrScopeNotAllowed, err)
+	}
+}
+
+func TestExchangeTokenForDisallowedAudience(t *testing.T) {
+	tokenController, subjectToken := newTestExchange(t, "orders")
+
+	if _, _, err := tokenController.ExchangeToken(exchangingClient, subjectToken, "billing-api", ""); err != controllers.ErrAudienceNotAllowed {
+		t.Fatalf("unexpected error for a disallowed audience\n\texpected: %q\n\tactual: %q", controllers.ErrAudienceNotAllowed, err)
+	}
+}
+
+func TestExchangeRestrictedTokenByAnotherClient(t *testing.T) {
+	tokenController, subjectToken := newTestExchange(t, "orders payments")
+
+	token, _, err := tokenController.ExchangeToken(exchangingClient, subjectToken, "payments-api", "")
+	if err != nil {
+		t.Fatalf("failed to exchange token: %q", err)
+	}
+
+	// only payments-api may pass on a token restricted to it
+	if _, _, err := tokenController.ExchangeToken(exchangingClient, token, "payments-api", ""); err != controllers.ErrInvalidSubjectToken {
+		t.Fatalf("unexpected error when exchanging another audience's token\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidSubjectToken, err)
+	}
+}
+
+// newTestIntrospection returns a token controller with a user who has a
+// session with the refresh token "refreshtoken1", and an access token issued
+// for that session.
+func newTestIntrospection(t *testing.T) (controllers.TokenController, string) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	user := models.User{ID: testUserID, PublicID: "user-public-id", UserRoles: []models.Roles{models.UserRole}}
+	_, sessionRepo := newTestSessionController()
+	tokenController := controllers.TokenController{
+		UserRepository:    MockUserRepository{users: map[int]models.User{user.ID: user}},
+		ClientRepository:  MockClientRepository{clients: map[string]models.Client{}},
+		SessionRepository: sessionRepo,
+		Denylist:          repositories.NewMemoryTokenDenylist(),
+	}
+
+	accessToken, err := models.MintToken(models.NewAccessTokenClaims(user, sessionRepo.sessions[testSessionID], time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	return tokenController, accessToken
+}
+
+func TestIntrospectAccessToken(t *testing.T) {
+	tokenController, accessToken := newTestIntrospection(t)
+
+	introspection, err := tokenController.IntrospectToken(accessToken, "")
+	if err != nil || !introspection.Active || introspection.TokenType != "access_token" {
+		t.Fatalf("valid access token was not introspected as an active access token")
+	}
+	if introspection.Sub != "user-public-id" || introspection.Jti == "" || len(introspection.Roles) != 1 {
+		t.Fatalf("unexpected introspection: sub %q, jti %q, roles %v", introspection.Sub, introspection.Jti, introspection.Roles)
+	}
+
+	// the hint only changes the order the token kinds are looked up in
+	if introspection, err := tokenController.IntrospectToken(accessToken, "refresh_token"); err != nil || !introspection.Active {
+		t.Fatalf("access token introspected with a refresh_token hint is not active")
+	}
+}
+
+func TestIntrospectRevokedAccessToken(t *testing.T) {
+	tokenController, accessToken := newTestIntrospection(t)
+
+	claims, err := tokenController.ValidateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("access token is not valid: %q", err)
+	}
+	_ = tokenController.Denylist.RevokeToken(claims.ID, claims.ExpiresAt.Time)
+
+	if introspection, err := tokenController.IntrospectToken(accessToken, ""); err != nil || introspection.Active {
+		t.Fatalf("revoked access token was introspected as active")
+	}
+}
+
+func TestValidateAccessTokenOfRevokedSession(t *testing.T) {
+	tokenController, accessToken := newTestIntrospection(t)
+	sessionController := controllers.SessionController{SessionRepository: tokenController.SessionRepository}
+
+	if err := sessionController.RevokeSession(testUserID, testSessionID); err != nil {
+		t.Fatalf("failed to revoke session: %q", err)
+	}
+
+	if _, err := tokenController.ValidateAccessToken(accessToken); err == nil {
+		t.Fatalf("access token of a revoked session is still valid")
+	}
+}
+
+func TestValidateAccessTokensAfterRevokingOtherSessions(t *testing.T) {
+	tokenController, otherAccessToken, currentAccessToken := newTestRevocation(t)
+	sessionController := controllers.SessionController{SessionRepository: tokenController.SessionRepository}
+
+	if err := sessionController.RevokeOtherSessions(testUserID, testSessionID); err != nil {
+		t.Fatalf("failed to revoke other sessions: %q", err)
+	}
+
+	if _, err := tokenController.ValidateAccessToken(otherAccessToken); err == nil {
+		t.Fatalf("access token of another session is still valid")
+	}
+	if _, err := tokenController.ValidateAccessToken(currentAccessToken); err != nil {
+		t.Fatalf("access token of the current session is no longer valid: %q", err)
+	}
+}
+
+func TestIntrospectRefreshToken(t *testing.T) {
+	tokenController, _ := newTestIntrospection(t)
+
+	introspection, err := tokenController.IntrospectToken("refreshtoken1", "refresh_token")
+	if err != nil || !introspection.Active || introspection.TokenType != "refresh_token" {
+		t.Fatalf("current refresh token was not introspected as an active refresh token")
+	}
+	if introspection.Sub != "user-public-id" {
+		t.Fatalf("unexpected subject\n\texpected: user-public-id\n\tactual: %s", introspection.Sub)
+	}
+
+	if introspection, err := tokenController.IntrospectToken("refreshtoken1", ""); err != nil || !introspection.Active {
+		t.Fatalf("refresh token introspected without a hint is not active")
+	}
+}
+
+func TestIntrospectUnknownToken(t *testing.T) {
+	tokenController, _ := newTestIntrospection(t)
+
+	for _, hint := range []string{"", "access_token", "refresh_token"} {
+		introspection, err := tokenController.IntrospectToken("notatoken", hint)
+		if err != nil || introspection.Active || introspection.TokenType != "" || introspection.Sub != "" {
+			t.Fatalf("unknown token introspected with hint %q was described: %+v", hint, introspection)
+		}
+	}
+}
+
+func TestIntrospectWhenClientRepositoryFails(t *testing.T) {
+	tokenController, _ := newTestIntrospection(t)
+	_, _ = tokenController.SessionRepository.AddSession(models.Session{
+		ID:               "client-session",
+		UserID:           testUserID,
+		ClientID:         "web-app",
+		RefreshTokenHash: utils.HashToken("clientrefreshtoken"),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	})
+	tokenController.ClientRepository = unavailableClientRepository{}
+
+	if _, err := tokenController.IntrospectToken("clientrefreshtoken", "refresh_token"); err == nil {
+		t.Fatalf("no error was thrown when the client of a refresh token could not be looked up")
+	}
+}
+
+var revokingClient = models.Client{ID: "web-app", Name: "Web App"}
+
+// newTestRevocation returns a token controller with a session of
+// revokingClient whose refresh token is "clientrefreshtoken", and an access
+// token issued to the client for that session, next to the first party
+// session and access token of newTestIntrospection.
+func newTestRevocation(t *testing.T) (controllers.TokenController, string, string) {
+	tokenController, firstPartyAccessToken := newTestIntrospection(t)
+
+	clientSession := models.Session{
+		ID:               "client-session",
+		UserID:           testUserID,
+		ClientID:         revokingClient.ID,
+		RefreshTokenHash: utils.HashToken("clientrefreshtoken"),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	_, _ = tokenController.SessionRepository.AddSession(clientSession)
+
+	user, _ := tokenController.UserRepository.GetUserByID(testUserID)
+	clientAccessToken, err := models.MintToken(models.NewAccessTokenClaims(user, clientSession, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	return tokenController, clientAccessToken, firstPartyAccessToken
+}
+
+func TestRevokeOwnTokens(t *testing.T) {
+	tokenController, clientAccessToken, _ := newTestRevocation(t)
+
+	if err := tokenController.RevokeToken(revokingClient, clientAccessToken, ""); err != nil {
+		t.Fatalf("failed to revoke access token: %q", err)
+	}
+	if _, err := tokenController.ValidateAccessToken(clientAccessToken); err == nil {
+		t.Fatalf("revoked access token is still valid")
+	}
+
+	if err := tokenController.RevokeToken(revokingClient, "clientrefreshtoken", "refresh_token"); err != nil {
+		t.Fatalf("failed to revoke refresh token: %q", err)
+	}
+	if _, err := tokenController.SessionRepository.GetSessionByID("client-session"); err == nil {
+		t.Fatalf("session of the revoked refresh token was not ended")
+	}
+}
+
+func TestRevokeTokensOfAnotherClient(t *testing.T) {
+	tokenController, clientAccessToken, _ := newTestRevocation(t)
+	otherClient := models.Client{ID: "other-app"}
+
+	if err := tokenController.RevokeToken(otherClient, clientAccessToken, ""); err != nil {
+		t.Fatalf("unexpected error when revoking another client's access token: %q", err)
+	}
+	if _, err := tokenController.ValidateAccessToken(clientAccessToken); err != nil {
+		t.Fatalf("access token was revoked by another client")
+	}
+
+	if err := tokenController.RevokeToken(otherClient, "clientrefreshtoken", "refresh_token"); err != nil {
+		t.Fatalf("unexpected error when revoking another client's refresh token: %q", err)
+	}
+	if _, err := tokenController.SessionRepository.GetSessionByID("client-session"); err != nil {
+		t.Fatalf("session was ended by another client")
+	}
+}
+
+func TestRevokeFirstPartyTokens(t *testing.T) {
+	tokenController, _, firstPartyAccessToken := newTestRevocation(t)
+
+	if err := tokenController.RevokeToken(revokingClient, firstPartyAccessToken, ""); err != nil {
+		t.Fatalf("unexpected error when revoking a first party access token: %q", err)
+	}
+	if _, err := tokenController.ValidateAccessToken(firstPartyAccessToken); err != nil {
+		t.Fatalf("first party access token was revoked by a client")
+	}
+
+	if err := tokenController.RevokeToken(revokingClient, "refreshtoken1", "refresh_token"); err != nil {
+		t.Fatalf("unexpected error when revoking a first party refresh token: %q", err)
+	}
+	if _, err := tokenController.SessionRepository.GetSessionByID(testSessionID); err != nil {
+		t.Fatalf("first party session was ended by a client")
+	}
+}
+
+func TestValidateLegacyAccessToken(t *testing.T) {
+	tokenController, _ := newTestIntrospection(t)
+	t.Setenv("JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE", time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	// tokens minted before public IDs were introduced carry the user's ID as subject
+	claims := models.NewAccessTokenClaims(models.User{ID: testUserID}, models.Session{ID: testSessionID}, time.Now().Add(time.Minute))
+	claims.Subject = "1"
+	legacyToken, err := models.MintToken(claims)
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	claims, err = tokenController.ValidateAccessToken(legacyToken)
+	if err != nil {
+		t.Fatalf("access token with a legacy subject was rejected: %q", err)
+	}
+	if userID, err := claims.UserID(); err != nil || userID != testUserID {
+		t.Fatalf("legacy subject was not resolved to the user\n\texpected: %d\n\tactual: %d", testUserID, userID)
+	}
+
+	// tokens issued since public IDs were deployed never carry one
+	t.Setenv("JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE", time.Now().Add(-time.Hour).Format(time.RFC3339))
+	if _, err := tokenController.ValidateAccessToken(legacyToken); err == nil {
+		t.Fatalf("access token with a legacy subject issued after the cutoff was accepted")
+	}
+}
+
+func TestValidateAccessTokenRefusesOtherTokens(t *testing.T) {
+	tokenController, _ := newTestIntrospection(t)
+	user := models.User{ID: testUserID, PublicID: "user-public-id", Email: "user@example.com"}
+
+	idToken, _ := models.MintIDToken(models.NewIDTokenClaims(models.NewUserInfo(user.PublicID, user, "openid"), "client1", "", time.Now(), testSessionID))
+	logoutToken, _ := models.MintLogoutToken(models.NewLogoutTokenClaims("client1", user.PublicID, models.Session{ParentSessionID: testSessionID}))
+	mfaChallengeToken, _ := models.MintMFAChallengeToken(models.NewMFAChallengeClaims(user, "laptop"))
+	verificationToken, _ := models.MintEmailVerificationToken(models.NewEmailVerificationClaims(user))
+
+	for name, token := range map[string]string{"ID": idToken, "logout": logoutToken, "MFA challenge": mfaChallengeToken, "email verification": verificationToken} {
+		if token == "" {
+			t.Fatalf("failed to mint %s token", name)
+		}
+		if _, err := tokenController.ValidateAccessToken(token); err == nil {
+			t.Fatalf("%s token was accepted as an access token", name)
+		}
+		if _, err := tokenController.ValidateFirstPartyAccessToken(token); err == nil {
+			t.Fatalf("%s token was accepted as a first party access token", name)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestUserWithPassword(t *testing.T, password string) (controllers.UserController, MockUserRepository) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %q", err)
+	}
+
+	user := unverifiedUser
+	user.Password = string(passwordHash)
+	repo, _ := newTestUserSetup(t, user)
+
+	return controllers.UserController{UserRepository: repo}, repo
+}
+
+func TestChangePassword(t *testing.T) {
+	controller, repo := newTestUserWithPassword(t, "old password")
+
+	if err := controller.ChangePassword(testUserID, "old password", "new password"); err != nil {
+		t.Fatalf("failed to change password: %q", err)
+	}
+
+	if _, err := repo.GetUserWithCredentials(unverifiedUser.Email, "new password"); err != nil {
+		t.Fatalf("new password is not accepted after changing it")
+	}
+	if _, err := repo.GetUserWithCredentials(unverifiedUser.Email, "old password"); err == nil {
+		t.Fatalf("old password is still accepted after changing it")
+	}
+}
+
+func TestChangePasswordFailsIncorrectPassword(t *testing.T) {
+	controller, _ := newTestUserWithPassword(t, "old password")
+
+	if err := controller.ChangePassword(testUserID, "wrong password", "new password"); err != controllers.ErrIncorrectPassword {
+		t.Fatalf("unexpected error for an incorrect current password\n\texpected: %q\n\tactual: %q", controllers.ErrIncorrectPassword, err)
+	}
+}
+
+func TestChangePasswordEnforcesPolicy(t *testing.T) {
+	controller, _ := newTestUserWithPassword(t, "old password")
+
+	if err := controller.ChangePassword(testUserID, "old password", " "); err != controllers.ErrInvalidPassword {
+		t.Fatalf("unexpected error for a blank new password\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPassword, err)
+	}
+}
+
+func newTestUserInfoClaims(scope string) models.TokenClaims {
+	claims := models.NewAccessTokenClaims(unverifiedUser, models.Session{ID: testSessionID, ClientID: "client1", Scope: scope}, time.Now().Add(time.Hour))
+	claims.SetUserID(testUserID)
+
+	return claims
+}
+
+func TestGetUserInfo(t *testing.T) {
+	controller := controllers.UserController{UserRepository: MockUserRepository{users: map[int]models.User{testUserID: unverifiedUser}}}
+
+	info, err := controller.GetUserInfo(newTestUserInfoClaims("openid"))
+	if err != nil {
+		t.Fatalf("failed to get user info: %q", err)
+	}
+	if info.Subject != unverifiedUser.PublicID || info.Email != "" {
+		t.Fatalf("unexpected user info without the email scope: %+v", info)
+	}
+
+	info, err = controller.GetUserInfo(newTestUserInfoClaims("openid email"))
+	if err != nil {
+		t.Fatalf("failed to get user info: %q", err)
+	}
+	if info.Email != unverifiedUser.Email || info.EmailVerified == nil || *info.EmailVerified {
+		t.Fatalf("unexpected user info with the email scope: %+v", info)
+	}
+}
+
+func TestGetUserInfoRequiresOpenIDScope(t *testing.T) {
+	controller := controllers.UserController{UserRepository: MockUserRepository{users: map[int]models.User{testUserID: unverifiedUser}}}
+
+	if _, err := controller.GetUserInfo(newTestUserInfoClaims("email")); err != controllers.ErrOpenIDScopeRequired {
+		t.Fatalf("unexpected error without the openid scope\n\texpected: %q\n\tactual: %q", controllers.ErrOpenIDScopeRequired, err)
+	}
+}
+
+func TestGetUserInfoRejectsClientTokens(t *testing.T) {
+	controller := controllers.UserController{UserRepository: MockUserRepository{users: map[int]models.User{testUserID: unverifiedUser}}}
+	claims := models.NewClientAccessTokenClaims(models.Client{ID: "client1"}, "openid", time.Now().Add(time.Hour))
+
+	if _, err := controller.GetUserInfo(claims); err != controllers.ErrNotUserToken {
+		t.Fatalf("unexpected error for a client token\n\texpected: %q\n\tactual: %q", controllers.ErrNotUserToken, err)
+	}
+}
+
+func TestGetUserInfoFailsForDeletedUser(t *testing.T) {
+	controller := controllers.UserController{UserRepository: MockUserRepository{users: map[int]models.User{}}}
+
+	if _, err := controller.GetUserInfo(newTestUserInfoClaims("openid")); err == nil {
+		t.Fatalf("user info was returned for a deleted user")
+	}
+}
+
+func TestIssueIDToken(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	controller := controllers.UserController{UserRepository: MockUserRepository{users: map[int]models.User{testUserID: unverifiedUser}}}
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	authorizationCode := models.AuthorizationCode{ClientID: "client1", UserID: testUserID, Scope: "openid email", Nonce: "n-0S6_WzA2Mj", AuthTime: authTime, SessionID: testSessionID}
+
+	idToken, err := controller.IssueIDToken(unverifiedUser, models.Client{ID: "client1"}, authorizationCode)
+	if err != nil {
+		t.Fatalf("failed to issue ID token: %q", err)
+	}
+
+	if _, _, err := models.ValidateToken(idToken); err != nil {
+		t.Fatalf("ID token does not validate: %q", err)
+	}
+	var claims models.IDTokenClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(idToken, &claims); err != nil {
+		t.Fatalf("failed to parse ID token: %q", err)
+	}
+	if claims.Subject != unverifiedUser.PublicID || !claims.VerifyAudience("client1", true) {
+		t.Fatalf("unexpected subject or audience: sub %q, aud %q", claims.Subject, claims.Audience)
+	}
+	if claims.Nonce != authorizationCode.Nonce || claims.SessionID != testSessionID || claims.AuthTime != authTime.Unix() {
+		t.Fatalf("ID token does not carry the nonce, session and time of the authorization: %+v", claims)
+	}
+	if claims.Email != unverifiedUser.Email {
+		t.Fatalf("ID token does not release the email granted with the email scope")
+	}
+}
+
+func TestIssueIDTokenRecordsPairwiseSubject(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	repo := MockUserRepository{users: map[int]models.User{testUserID: unverifiedUser}, pairwiseSubjects: map[string]int{}}
+	controller := controllers.UserController{UserRepository: repo}
+	client := models.Client{ID: "client1", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://app.example.com/callback"}}
+
+	idToken, err := controller.IssueIDToken(unverifiedUser, client, models.AuthorizationCode{ClientID: client.ID, UserID: testUserID, Scope: "openid"})
+	if err != nil {
+		t.Fatalf("failed to issue ID token: %q", err)
+	}
+
+	_, claims, err := models.ValidateToken(idToken)
+	if err != nil {
+		t.Fatalf("ID token does not validate: %q", err)
+	}
+	if claims.Subject == unverifiedUser.PublicID {
+		t.Fatalf("ID token of a pairwise client carries the public subject")
+	}
+	if userID, err := repo.GetUserIDForSubject(claims.Subject); err != nil || userID != testUserID {
+		t.Fatalf("pairwise subject of the ID token was not recorded for the user")
+	}
+}
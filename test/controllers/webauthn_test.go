@@ -0,0 +1,369 @@
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"jwt-auth-service/controllers"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const testOrigin = "https://auth.example.com"
+
+type MockWebAuthnRepository struct {
+	challenges  map[string]models.WebAuthnChallenge
+	credentials map[string]models.WebAuthnCredential
+}
+
+func (repo MockWebAuthnRepository) AddChallenge(challenge models.WebAuthnChallenge) error {
+	repo.challenges[challenge.ChallengeHash] = challenge
+	return nil
+}
+
+func (repo MockWebAuthnRepository) ConsumeChallenge(challengeHash string) (models.WebAuthnChallenge, error) {
+	challenge, ok := repo.challenges[challengeHash]
+	if !ok {
+		return challenge, fmt.Errorf("challenge not found")
+	}
+
+	delete(repo.challenges, challengeHash)
+	return challenge, nil
+}
+
+func (repo MockWebAuthnRepository) AddCredential(credential models.WebAuthnCredential) error {
+	if _, ok := repo.credentials[string(credential.ID)]; ok {
+		return repositories.ErrCredentialExists
+	}
+
+	repo.credentials[string(credential.ID)] = credential
+	return nil
+}
+
+func (repo MockWebAuthnRepository) GetCredential(id []byte) (models.WebAuthnCredential, error) {
+	credential, ok := repo.credentials[string(id)]
+	if !ok {
+		return credential, fmt.Errorf("passkey not found")
+	}
+
+	return credential, nil
+}
+
+func (repo MockWebAuthnRepository) GetCredentialsForUser(userID int) ([]models.WebAuthnCredential, error) {
+	credentials := []models.WebAuthnCredential{}
+	for _, credential := range repo.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+
+	return credentials, nil
+}
+
+func (repo MockWebAuthnRepository) UpdateSignCount(id []byte, previousSignCount uint32, signCount uint32) (bool, error) {
+	credential, ok := repo.credentials[string(id)]
+	if !ok || credential.SignCount != previousSignCount {
+		return false, nil
+	}
+
+	credential.SignCount = signCount
+	repo.credentials[string(id)] = credential
+	return true, nil
+}
+
+func (repo MockWebAuthnRepository) DeleteCredential(userID int, id []byte) error {
+	if credential, ok := repo.credentials[string(id)]; !ok || credential.UserID != userID {
+		return fmt.Errorf("passkey not found")
+	}
+
+	delete(repo.credentials, string(id))
+	return nil
+}
+
+// softwareAuthenticator is an authenticator holding a single ES256 passkey in
+// memory, which answers ceremonies the way a browser and security key would.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate passkey: %q", err)
+	}
+
+	credentialID := make([]byte, 16)
+	_, _ = rand.Read(credentialID)
+
+	return &softwareAuthenticator{key: key, credentialID: credentialID, origin: testOrigin}
+}
+
+func (a *softwareAuthenticator) create(t *testing.T, options models.CredentialCreationOptions) models.RegistrationResponse {
+	userHandle, err := models.DecodeBase64URL(options.User.ID)
+	if err != nil {
+		t.Fatalf("user handle is not base64url encoded: %q", err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, _ := cbor.Marshal(map[int]interface{}{
+		1:  2,  // EC2
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	authData := a.authenticatorData(options.RP.ID, 0x01|0x04|0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, _ := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+
+	return models.RegistrationResponse{
+		ID:    models.EncodeBase64URL(a.credentialID),
+		RawID: models.EncodeBase64URL(a.credentialID),
+		Type:  "public-key",
+		Response: models.AuthenticatorAttestationResponse{
+			ClientDataJSON:    models.EncodeBase64URL(a.clientData("webauthn.create", options.Challenge)),
+			AttestationObject: models.EncodeBase64URL(attestationObject),
+		},
+	}
+}
+
+func (a *softwareAuthenticator) get(t *testing.T, options models.CredentialRequestOptions) models.AssertionResponse {
+	a.signCount++
+	authData := a.authenticatorData(options.RPID, 0x01|0x04)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %q", err)
+	}
+
+	return models.AssertionResponse{
+		ID:    models.EncodeBase64URL(a.credentialID),
+		RawID: models.EncodeBase64URL(a.credentialID),
+		Type:  "public-key",
+		Response: models.AuthenticatorAssertionResponse{
+			ClientDataJSON:    models.EncodeBase64URL(clientDataJSON),
+			AuthenticatorData: models.EncodeBase64URL(authData),
+			Signature:         models.EncodeBase64URL(signature),
+			UserHandle:        models.EncodeBase64URL(a.userHandle),
+		},
+	}
+}
+
+func (a *softwareAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.signCount)
+}
+
+func (a *softwareAuthenticator) clientData(ceremonyType string, challenge string) []byte {
+	clientDataJSON, _ := json.Marshal(models.ClientData{Type: ceremonyType, Challenge: challenge, Origin: a.origin})
+	return clientDataJSON
+}
+
+func newTestWebAuthnController(t *testing.T, user models.User) (controllers.WebAuthnController, MockWebAuthnRepository) {
+	t.Setenv("JWT_AUTH_SERVICE_BASE_URL", testOrigin)
+
+	userRepo, _ := newTestUserSetup(t, user)
+	repo := MockWebAuthnRepository{challenges: map[string]models.WebAuthnChallenge{}, credentials: map[string]models.WebAuthnCredential{}}
+	controller := controllers.WebAuthnController{
+		WebAuthnRepository: repo,
+		UserRepository:     userRepo,
+	}
+
+	return controller, repo
+}
+
+// registerTestPasskey registers a passkey of a new software authenticator for
+// the user.
+func registerTestPasskey(t *testing.T, controller controllers.WebAuthnController, user models.User) *softwareAuthenticator {
+	authenticator := newSoftwareAuthenticator(t)
+
+	options, err := controller.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("failed to begin passkey registration: %q", err)
+	}
+	if _, err := controller.FinishRegistration(user, authenticator.create(t, options), "laptop"); err != nil {
+		t.Fatalf("failed to register passkey: %q", err)
+	}
+
+	return authenticator
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	controller, repo := newTestWebAuthnController(t, unverifiedUser)
+	authenticator := registerTestPasskey(t, controller, unverifiedUser)
+
+	credential := repo.credentials[string(authenticator.credentialID)]
+	if credential.UserID != testUserID || credential.Name != "laptop" {
+		t.Fatalf("unexpected passkey stored: user ID %d, name %q", credential.UserID, credential.Name)
+	}
+
+	options, err := controller.BeginLogin()
+	if err != nil {
+		t.Fatalf("failed to begin passkey login: %q", err)
+	}
+	user, methods, err := controller.FinishLogin(authenticator.get(t, options))
+	if err != nil {
+		t.Fatalf("failed to sign in with passkey: %q", err)
+	}
+	if user.ID != testUserID || strings.Join(methods, " ") != "hwk mfa" {
+		t.Fatalf("unexpected outcome of passkey login: user ID %d, methods %q", user.ID, methods)
+	}
+	if repo.credentials[string(authenticator.credentialID)].SignCount != authenticator.signCount {
+		t.Fatalf("signature counter of passkey was not updated")
+	}
+}
+
+func TestPasskeyLoginCannotBeReplayed(t *testing.T) {
+	controller, _ := newTestWebAuthnController(t, unverifiedUser)
+	authenticator := registerTestPasskey(t, controller, unverifiedUser)
+
+	options, _ := controller.BeginLogin()
+	assertion := authenticator.get(t, options)
+	if _, _, err := controller.FinishLogin(assertion); err != nil {
+		t.Fatalf("failed to sign in with passkey: %q", err)
+	}
+	if _, _, err := controller.FinishLogin(assertion); err != controllers.ErrInvalidPasskey {
+		t.Fatalf("unexpected error replaying an assertion\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasskey, err)
+	}
+}
+
+func TestPasskeyLoginFailsSignCountRegression(t *testing.T) {
+	controller, _ := newTestWebAuthnController(t, unverifiedUser)
+	authenticator := registerTestPasskey(t, controller, unverifiedUser)
+
+	options, _ := controller.BeginLogin()
+	if _, _, err := controller.FinishLogin(authenticator.get(t, options)); err != nil {
+		t.Fatalf("failed to sign in with passkey: %q", err)
+	}
+
+	// a clone of the passkey lags behind the original's counter
+	clone := *authenticator
+	clone.signCount = 0
+
+	options, _ = controller.BeginLogin()
+	if _, _, err := controller.FinishLogin(clone.get(t, options)); err != controllers.ErrInvalidPasskey {
+		t.Fatalf("unexpected error signing in with a cloned passkey\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasskey, err)
+	}
+}
+
+func TestPasskeyRegistrationFailsOtherOrigin(t *testing.T) {
+	controller, repo := newTestWebAuthnController(t, unverifiedUser)
+	authenticator := newSoftwareAuthenticator(t)
+	authenticator.origin = "https://auth.example.com.evil.example"
+
+	options, _ := controller.BeginRegistration(unverifiedUser)
+	if _, err := controller.FinishRegistration(unverifiedUser, authenticator.create(t, options), "laptop"); err != controllers.ErrInvalidPasskey {
+		t.Fatalf("unexpected error registering from another origin\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasskey, err)
+	}
+	if len(repo.credentials) != 0 {
+		t.Fatalf("passkey from another origin was stored")
+	}
+}
+
+func TestCompletePasskeyChallenge(t *testing.T) {
+	mfaController, _ := newTestMFAController(t, unverifiedUser)
+	enrollTestUser(t, mfaController, unverifiedUser)
+	webAuthnController, _ := newTestWebAuthnController(t, unverifiedUser)
+	mfaController.WebAuthn = webAuthnController
+	authenticator := registerTestPasskey(t, webAuthnController, unverifiedUser)
+
+	challengeToken, _, err := mfaController.StartChallenge(unverifiedUser, "laptop")
+	if err != nil {
+		t.Fatalf("failed to start MFA challenge: %q", err)
+	}
+	options, err := webAuthnController.BeginSecondFactor(testUserID)
+	if err != nil {
+		t.Fatalf("failed to begin passkey second factor: %q", err)
+	}
+	if len(options.AllowCredentials) != 1 {
+		t.Fatalf("unexpected passkeys allowed for second factor: %v", options.AllowCredentials)
+	}
+
+	// a login challenge is not accepted as a second factor
+	loginOptions, _ := webAuthnController.BeginLogin()
+	if _, _, _, err := mfaController.CompletePasskeyChallenge(challengeToken, authenticator.get(t, loginOptions)); err != controllers.ErrInvalidPasskey {
+		t.Fatalf("unexpected error for a login assertion\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidPasskey, err)
+	}
+
+	challengeToken, _, _ = mfaController.StartChallenge(unverifiedUser, "laptop")
+	user, methods, deviceLabel, err := mfaController.CompletePasskeyChallenge(challengeToken, authenticator.get(t, options))
+	if err != nil {
+		t.Fatalf("failed to complete MFA challenge with passkey: %q", err)
+	}
+	if user.ID != testUserID || deviceLabel != "laptop" || strings.Join(methods, " ") != "pwd hwk mfa" {
+		t.Fatalf("unexpected outcome of MFA challenge: user ID %d, device label %q, methods %q", user.ID, deviceLabel, methods)
+	}
+}
+
+// newTestPasskeyOnlyUser returns an MFA controller for a user whose only
+// second factor is a passkey.
+func newTestPasskeyOnlyUser(t *testing.T) (controllers.MFAController, *softwareAuthenticator) {
+	mfaController, _ := newTestMFAController(t, unverifiedUser)
+	webAuthnController, _ := newTestWebAuthnController(t, unverifiedUser)
+	mfaController.WebAuthn = webAuthnController
+
+	return mfaController, registerTestPasskey(t, webAuthnController, unverifiedUser)
+}
+
+func TestPasskeysEnableMFA(t *testing.T) {
+	mfaController, _ := newTestPasskeyOnlyUser(t)
+
+	if enabled, err := mfaController.MFAEnabled(testUserID); err != nil || !enabled {
+		t.Fatalf("MFA is not enabled for a user with a passkey")
+	}
+
+	// adding an authenticator takes a session signed in with the passkey
+	if _, _, err := mfaController.BeginTOTPEnrollment(unverifiedUser, false); err != controllers.ErrMFAReauthenticationRequired {
+		t.Fatalf("unexpected error enrolling without MFA\n\texpected: %q\n\tactual: %q", controllers.ErrMFAReauthenticationRequired, err)
+	}
+	if _, _, err := mfaController.BeginTOTPEnrollment(unverifiedUser, true); err != nil {
+		t.Fatalf("failed to begin TOTP enrollment with MFA: %q", err)
+	}
+}
+
+func TestCompleteChallengeWithPasskeyOnly(t *testing.T) {
+	mfaController, authenticator := newTestPasskeyOnlyUser(t)
+
+	// there is no code to enter, so a code only uses up the challenge
+	challengeToken, _, _ := mfaController.StartChallenge(unverifiedUser, "laptop")
+	if _, _, _, err := mfaController.CompleteChallenge(challengeToken, "123456"); err != controllers.ErrInvalidMFACode {
+		t.Fatalf("unexpected error for a code of a user without an authenticator\n\texpected: %q\n\tactual: %q", controllers.ErrInvalidMFACode, err)
+	}
+
+	challengeToken, _, _ = mfaController.StartChallenge(unverifiedUser, "laptop")
+	options, err := mfaController.WebAuthn.BeginSecondFactor(testUserID)
+	if err != nil {
+		t.Fatalf("failed to begin passkey second factor: %q", err)
+	}
+	_, methods, _, err := mfaController.CompletePasskeyChallenge(challengeToken, authenticator.get(t, options))
+	if err != nil {
+		t.Fatalf("failed to complete MFA challenge with a passkey alone: %q", err)
+	}
+	if strings.Join(methods, " ") != "pwd hwk mfa" {
+		t.Fatalf("unexpected authentication methods %q", methods)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"jwt-auth-service/models"
+	"testing"
+)
+
+// test vector from RFC 7636 appendix B
+var testCode = models.AuthorizationCode{
+	CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+	CodeChallengeMethod: "S256",
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	if !testCode.VerifyCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk") {
+		t.Fatalf("the code verifier from RFC 7636 did not match its code challenge")
+	}
+}
+
+func TestVerifyCodeVerifierRejectsWrongVerifier(t *testing.T) {
+	if testCode.VerifyCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXK") {
+		t.Fatalf("no error was thrown when presenting the wrong code verifier")
+	}
+
+	if testCode.VerifyCodeVerifier("") {
+		t.Fatalf("no error was thrown when presenting an empty code verifier")
+	}
+}
+
+func TestVerifyCodeVerifierRejectsPlainMethod(t *testing.T) {
+	plainCode := models.AuthorizationCode{
+		CodeChallenge:       "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk",
+		CodeChallengeMethod: "plain",
+	}
+
+	if plainCode.VerifyCodeVerifier("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk") {
+		t.Fatalf("no error was thrown when verifying a code issued with the plain method")
+	}
+}
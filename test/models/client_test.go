@@ -0,0 +1,67 @@
+package models
+
+import (
+	"jwt-auth-service/models"
+	"testing"
+)
+
+func TestRedirectURIValidation(t *testing.T) {
+	for _, redirectURI := range []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/callback", true},
+		{"http://127.0.0.1:8080/callback", true},
+		{"http://[::1]:8080/callback", true},
+		{"http://localhost/callback", true},
+		{"com.example.app:/callback", true},
+		{"http://app.example.com/callback", false},
+		{"https:///callback", false},
+		{"javascript:alert(document.cookie)", false},
+		{"JavaScript://app.example.com/%0aalert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"vbscript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+		{"myapp:/callback", false},
+		{"/callback", false},
+		{"https://app.example.com/callback#fragment", false},
+	} {
+		client := models.Client{
+			Name:         "App",
+			GrantTypes:   []string{models.GrantTypeAuthorizationCode},
+			RedirectURIs: []string{redirectURI.uri},
+		}
+
+		if errors := client.Validate(); (errors == nil) != redirectURI.valid {
+			t.Fatalf("unexpected validation of redirect URI %q\n\texpected valid: %t\n\tactual: %q", redirectURI.uri, redirectURI.valid, errors)
+		}
+	}
+}
+
+func TestLogoutURIValidation(t *testing.T) {
+	for _, logoutURI := range []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://app.example.com/logout", true},
+		{"http://127.0.0.1:8080/logout", true},
+		{"http://app.example.com/logout", false},
+		{"com.example.app:/logout", false},
+		{"javascript:alert(document.cookie)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"vbscript:msgbox(1)", false},
+		{"file:///etc/passwd", false},
+	} {
+		client := models.Client{
+			Name:                  "App",
+			GrantTypes:            []string{models.GrantTypeClientCredentials},
+			BackchannelLogoutURI:  logoutURI.uri,
+			FrontchannelLogoutURI: logoutURI.uri,
+		}
+
+		// the URI is checked once as each kind of logout URI
+		if errors := client.Validate(); (logoutURI.valid && errors != nil) || (!logoutURI.valid && len(errors) != 2) {
+			t.Fatalf("unexpected validation of logout URI %q\n\texpected valid: %t\n\tactual: %q", logoutURI.uri, logoutURI.valid, errors)
+		}
+	}
+}
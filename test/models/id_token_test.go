@@ -0,0 +1,50 @@
+package models
+
+import (
+	"jwt-auth-service/models"
+	"testing"
+	"time"
+)
+
+func TestMintIDToken(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	t.Setenv("JWT_AUTH_SERVICE_BASE_URL", "https://auth.example.com/")
+	models.SetSigningKey(nil)
+
+	user := models.User{ID: 7, Email: "user@example.com"}
+	authTime := time.Now().Add(-time.Hour)
+
+	idToken, err := models.MintIDToken(models.NewIDTokenClaims(models.NewUserInfo("user-public-id", user, "openid email"), "client1", "n-0S6_WzA2Mj", authTime, "session1"))
+	if err != nil {
+		t.Fatalf("failed to mint ID token: %q", err)
+	}
+
+	_, claims, err := models.ValidateToken(idToken)
+	if err != nil {
+		t.Fatalf("failed to validate ID token: %q", err)
+	}
+	if claims.Issuer != "https://auth.example.com" {
+		t.Fatalf("unexpected issuer\n\texpected: https://auth.example.com\n\tactual: %s", claims.Issuer)
+	}
+	if !claims.VerifyAudience("client1", true) || claims.Subject != "user-public-id" {
+		t.Fatalf("unexpected audience or subject: aud %q, sub %q", claims.Audience, claims.Subject)
+	}
+
+	// ID tokens must not be usable as access tokens
+	if claims.TokenType == models.AccessToken {
+		t.Fatalf("ID token was marked as an access token")
+	}
+}
+
+func TestUserInfoReleasesEmailWithEmailScope(t *testing.T) {
+	user := models.User{ID: 7, Email: "user@example.com"}
+
+	if info := models.NewUserInfo("user-public-id", user, "openid"); info.Email != "" || info.EmailVerified != nil {
+		t.Fatalf("email claims were released without the email scope")
+	}
+
+	info := models.NewUserInfo("user-public-id", user, "openid email")
+	if info.Email != user.Email || info.EmailVerified == nil {
+		t.Fatalf("email claims were not released with the email scope")
+	}
+}
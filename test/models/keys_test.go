@@ -0,0 +1,102 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"jwt-auth-service/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyRotationKeepsRetiredKeysVerifying(t *testing.T) {
+	dir := t.TempDir()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %q", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %q", err)
+	}
+	writeKeyFile(t, dir, "2023-01", privateKeyPEM(t, ecKey))
+	writeKeyFile(t, dir, "2023-02", privateKeyPEM(t, edKey))
+	defer models.SetKeyRing(nil)
+
+	ring, err := models.LoadKeyRingFromDir(dir, "2023-01")
+	if err != nil {
+		t.Fatalf("failed to load key ring: %q", err)
+	}
+	models.SetKeyRing(ring)
+
+	oldToken, err := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{}, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint token: %q", err)
+	}
+
+	ring, err = models.LoadKeyRingFromDir(dir, "2023-02")
+	if err != nil {
+		t.Fatalf("failed to load rotated key ring: %q", err)
+	}
+	models.SetKeyRing(ring)
+
+	newToken, err := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{}, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint token after rotation: %q", err)
+	}
+
+	token, _, err := models.ValidateToken(newToken)
+	if err != nil {
+		t.Fatalf("failed to validate token signed with the active key: %q", err)
+	}
+	if token.Header["kid"] != "2023-02" {
+		t.Fatalf("unexpected kid header\n\texpected: 2023-02\n\tactual: %v", token.Header["kid"])
+	}
+
+	if _, _, err := models.ValidateToken(oldToken); err != nil {
+		t.Fatalf("failed to validate token signed with a retired key: %q", err)
+	}
+
+	jwks := ring.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("unexpected number of published keys\n\texpected: 2\n\tactual: %d", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kty != "EC" || jwks.Keys[1].Kty != "OKP" {
+		t.Fatalf("unexpected published key types: %s, %s", jwks.Keys[0].Kty, jwks.Keys[1].Kty)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "2023-01.pem")); err != nil {
+		t.Fatalf("failed to remove retired key: %q", err)
+	}
+	ring, err = models.LoadKeyRingFromDir(dir, "2023-02")
+	if err != nil {
+		t.Fatalf("failed to reload key ring: %q", err)
+	}
+	models.SetKeyRing(ring)
+
+	if _, _, err := models.ValidateToken(oldToken); err == nil {
+		t.Fatalf("no error was thrown when validating a token signed with a removed key")
+	}
+}
+
+func TestLoadKeyRingFailsMissingActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %q", err)
+	}
+	writeKeyFile(t, dir, "2023-01", privateKeyPEM(t, ecKey))
+
+	if _, err := models.LoadKeyRingFromDir(dir, "2023-03"); err == nil {
+		t.Fatalf("no error was thrown when loading a key ring without the active key")
+	}
+}
+
+func writeKeyFile(t *testing.T, dir string, kid string, data []byte) {
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatalf("failed to write key %s: %q", kid, err)
+	}
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"jwt-auth-service/models"
+	"jwt-auth-service/utils"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// the SHA-1 test vectors of RFC 6238 appendix B, truncated to six digits
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unixTime, expected := range vectors {
+		if actual := utils.TOTPCode(secret, utils.TOTPStep(time.Unix(unixTime, 0))); actual != expected {
+			t.Errorf("unexpected TOTP code at %d\n\texpected: %s\n\tactual: %s", unixTime, expected, actual)
+		}
+	}
+
+	if _, ok := utils.MatchTOTPCode(secret, "287082", time.Unix(59+30, 0)); !ok {
+		t.Errorf("code of the previous period was not accepted")
+	}
+	if _, ok := utils.MatchTOTPCode(secret, "287082", time.Unix(59+90, 0)); ok {
+		t.Errorf("code of a period long past was accepted")
+	}
+}
+
+func TestTOTPKeyURI(t *testing.T) {
+	keyURI, err := url.Parse(models.TOTPKeyURI("user@example.com", "JBSWY3DPEHPK3PXP", 6, 30*time.Second))
+	if err != nil {
+		t.Fatalf("key URI does not parse: %q", err)
+	}
+
+	if keyURI.Scheme != "otpauth" || keyURI.Host != "totp" || keyURI.Path != "/jwt-auth-service:user@example.com" {
+		t.Errorf("unexpected key URI %q", keyURI)
+	}
+	if query := keyURI.Query(); query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("unexpected key URI parameters %q", keyURI.RawQuery)
+	}
+}
+
+func TestMFAChallengeTokenIsNotAccessToken(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	challengeToken, err := models.MintMFAChallengeToken(models.NewMFAChallengeClaims(testUser, "laptop"))
+	if err != nil {
+		t.Fatalf("failed to mint MFA challenge token: %q", err)
+	}
+	claims, err := models.ValidateMFAChallengeToken(challengeToken)
+	if err != nil {
+		t.Fatalf("failed to validate MFA challenge token: %q", err)
+	}
+	if claims.Subject != testUser.PublicID || claims.DeviceLabel != "laptop" {
+		t.Errorf("unexpected MFA challenge claims: subject %q, device label %q", claims.Subject, claims.DeviceLabel)
+	}
+
+	accessToken, _ := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{ID: "session"}, time.Now().Add(time.Minute)))
+	if _, err := models.ValidateMFAChallengeToken(accessToken); err == nil {
+		t.Errorf("access token was accepted as an MFA challenge token")
+	}
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"jwt-auth-service/models"
+	"testing"
+	"time"
+)
+
+func TestPairwiseSubjectsDifferBetweenSectors(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+
+	partner := models.Client{ID: "partner", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://partner.example.com/callback"}}
+	partnerApp := models.Client{ID: "partner-app", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://partner.example.com/app/callback"}}
+	other := models.Client{ID: "other", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://other.example.org/callback"}}
+
+	subject, _ := partner.SubjectFor(testUser)
+	if subject == testUser.PublicID || subject == "" {
+		t.Fatalf("pairwise client was given the public subject")
+	}
+	if appSubject, _ := partnerApp.SubjectFor(testUser); appSubject != subject {
+		t.Fatalf("clients of the same sector got different subjects\n\texpected: %s\n\tactual: %s", subject, appSubject)
+	}
+	if otherSubject, _ := other.SubjectFor(testUser); otherSubject == subject {
+		t.Fatalf("clients of different sectors got the same subject")
+	}
+	if otherUserSubject, _ := partner.SubjectFor(models.User{ID: testUser.ID + 1}); otherUserSubject == subject {
+		t.Fatalf("different users got the same subject")
+	}
+}
+
+func TestPairwiseSubjectDependsOnKey(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	subject, _ := models.PairwiseSubject(testUser.ID, "partner.example.com")
+
+	t.Setenv("JWT_AUTH_SERVICE_PAIRWISE_SECRET", "pairwise-secret")
+	if pairwiseKeySubject, _ := models.PairwiseSubject(testUser.ID, "partner.example.com"); pairwiseKeySubject == subject {
+		t.Fatalf("pairwise subject was not keyed with JWT_AUTH_SERVICE_PAIRWISE_SECRET")
+	}
+}
+
+func TestPublicClientsGetPublicID(t *testing.T) {
+	subject, err := models.Client{ID: "web-app"}.SubjectFor(testUser)
+	if err != nil || subject != testUser.PublicID {
+		t.Fatalf("unexpected public subject\n\texpected: %s\n\tactual: %s", testUser.PublicID, subject)
+	}
+}
+
+func TestPairwiseClientOnSeveralHostsRequiresSectorIdentifier(t *testing.T) {
+	client := models.Client{
+		Name:         "Partner",
+		GrantTypes:   []string{models.GrantTypeAuthorizationCode},
+		RedirectURIs: []string{"https://a.example.com/callback", "https://b.example.com/callback"},
+		SubjectType:  models.SubjectTypePairwise,
+	}
+	if errors := client.Validate(); len(errors) != 1 {
+		t.Fatalf("unexpected validation errors\n\texpected: 1 error\n\tactual: %q", errors)
+	}
+
+	client.SectorIdentifier = "example.com"
+	if errors := client.Validate(); errors != nil {
+		t.Fatalf("unexpected validation errors with a sector identifier: %q", errors)
+	}
+	if client.Sector() != "example.com" {
+		t.Fatalf("unexpected sector\n\texpected: example.com\n\tactual: %s", client.Sector())
+	}
+}
+
+func TestSelfRegisteredClientsAreTheirOwnSector(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+
+	partner := models.Client{ID: "partner", SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://partner.example.com/callback"}}
+	registered := models.Client{ID: "registered", Name: "Registered", GrantTypes: []string{models.GrantTypeAuthorizationCode}, SubjectType: models.SubjectTypePairwise, RedirectURIs: []string{"https://partner.example.com/other"}, RegistrationTokenHash: "hash"}
+
+	if registered.Sector() != registered.ID {
+		t.Fatalf("unexpected sector of a self-registered client\n\texpected: %s\n\tactual: %s", registered.ID, registered.Sector())
+	}
+
+	subject, _ := partner.SubjectFor(testUser)
+	if registeredSubject, _ := registered.SubjectFor(testUser); registeredSubject == subject {
+		t.Fatalf("a self-registered client got the subjects of another client by registering a redirect URI on its host")
+	}
+
+	registered.RedirectURIs = append(registered.RedirectURIs, "https://registered.example.org/callback")
+	if errors := registered.Validate(); errors != nil {
+		t.Fatalf("unexpected validation errors for a self-registered client on several hosts: %q", errors)
+	}
+}
+
+func TestLegacySubjectUserID(t *testing.T) {
+	issuedAt := time.Now()
+	if _, ok := models.LegacySubjectUserID("42", issuedAt); ok {
+		t.Fatalf("legacy subject was read without a cutoff configured")
+	}
+
+	t.Setenv("JWT_AUTH_SERVICE_LEGACY_SUBJECTS_BEFORE", issuedAt.Add(time.Hour).Format(time.RFC3339))
+	if userID, ok := models.LegacySubjectUserID("42", issuedAt); !ok || userID != 42 {
+		t.Fatalf("legacy subject was not read as a user ID\n\texpected: 42\n\tactual: %d", userID)
+	}
+	if _, ok := models.LegacySubjectUserID("42", issuedAt.Add(2*time.Hour)); ok {
+		t.Fatalf("legacy subject of a token issued after the cutoff was read as a user ID")
+	}
+	if _, ok := models.LegacySubjectUserID("42", time.Time{}); ok {
+		t.Fatalf("legacy subject of a token without an issue time was read as a user ID")
+	}
+
+	for _, subject := range []string{"", "0", "-1", "042", "+42", "user-public-id", "12345678901234567890123456789012"} {
+		if _, ok := models.LegacySubjectUserID(subject, issuedAt); ok {
+			t.Fatalf("subject %q was read as a legacy user ID", subject)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"jwt-auth-service/models"
+	"testing"
+	"time"
+)
+
+var testUser = models.User{ID: 7, PublicID: "public-7", UserRoles: []models.Roles{models.UserRole}}
+
+func TestMintAndValidateAsymmetricTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %q", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %q", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %q", err)
+	}
+
+	testKeys := map[string]interface{}{
+		"RS256": rsaKey,
+		"ES256": ecKey,
+		"EdDSA": edKey,
+	}
+
+	for alg, privateKey := range testKeys {
+		key, err := models.ParseSigningKeyPEM(privateKeyPEM(t, privateKey))
+		if err != nil {
+			t.Fatalf("failed to parse %s signing key: %q", alg, err)
+		}
+		if key.Method.Alg() != alg {
+			t.Fatalf("unexpected signing method\n\texpected: %s\n\tactual: %s", alg, key.Method.Alg())
+		}
+
+		models.SetSigningKey(key)
+		tokenStr, err := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{}, time.Now().Add(time.Minute)))
+		if err != nil {
+			t.Fatalf("failed to mint %s token: %q", alg, err)
+		}
+
+		verifyKey, err := models.ParseVerificationKeyPEM(publicKeyPEM(t, key.PublicKey))
+		if err != nil {
+			t.Fatalf("failed to parse %s verification key: %q", alg, err)
+		}
+
+		models.SetSigningKey(verifyKey)
+		_, claims, err := models.ValidateToken(tokenStr)
+		if err != nil {
+			t.Fatalf("failed to validate %s token with public key: %q", alg, err)
+		}
+		if claims.Subject != testUser.PublicID {
+			t.Fatalf("unexpected subject\n\texpected: %s\n\tactual: %s", testUser.PublicID, claims.Subject)
+		}
+
+		if _, err := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{}, time.Now().Add(time.Minute))); err == nil {
+			t.Fatalf("no error was thrown when minting a %s token with a verify-only key", alg)
+		}
+	}
+
+	models.SetSigningKey(nil)
+}
+
+func TestValidateTokenRejectsUnexpectedAlgorithm(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+	hmacToken, err := models.MintToken(models.NewAccessTokenClaims(testUser, models.Session{}, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint HS256 token: %q", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA key: %q", err)
+	}
+	key, err := models.ParseSigningKeyPEM(privateKeyPEM(t, ecKey))
+	if err != nil {
+		t.Fatalf("failed to parse ES256 signing key: %q", err)
+	}
+
+	models.SetSigningKey(key)
+	defer models.SetSigningKey(nil)
+
+	if _, _, err := models.ValidateToken(hmacToken); err == nil {
+		t.Fatalf("no error was thrown when validating an HS256 token against an ES256 key")
+	}
+}
+
+func privateKeyPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %q", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicKeyPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %q", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestClientSubjectIsNotAUser(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+
+	client := models.Client{ID: "7"}
+	tokenStr, err := models.MintToken(models.NewClientAccessTokenClaims(client, "reports:read", time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint client token: %q", err)
+	}
+
+	_, claims, err := models.ValidateToken(tokenStr)
+	if err != nil {
+		t.Fatalf("failed to validate client token: %q", err)
+	}
+	if !claims.IsClientSubject() || claims.Subject != client.ID || claims.Scope != "reports:read" {
+		t.Fatalf("unexpected client token claims: sub_type %q, sub %q, scope %q", claims.SubjectType, claims.Subject, claims.Scope)
+	}
+
+	// a numeric client ID must still not be mistaken for a user ID
+	if _, err := claims.UserID(); err == nil {
+		t.Fatalf("no error was thrown when reading a user ID from a client token")
+	}
+}
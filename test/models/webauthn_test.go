@@ -0,0 +1,54 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"jwt-auth-service/models"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+func TestParseCOSEKeyEd25519(t *testing.T) {
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	encoded, _ := cbor.Marshal(map[int]interface{}{1: 1, 3: models.COSEAlgorithmEdDSA, -1: 6, -2: []byte(publicKey)})
+
+	key, err := models.ParseCOSEKey(encoded)
+	if err != nil {
+		t.Fatalf("failed to parse Ed25519 COSE key: %q", err)
+	}
+
+	data := []byte("authenticator data")
+	if err := key.Verify(data, ed25519.Sign(privateKey, data)); err != nil {
+		t.Fatalf("failed to verify Ed25519 signature: %q", err)
+	}
+	if err := key.Verify([]byte("other data"), ed25519.Sign(privateKey, data)); err == nil {
+		t.Fatalf("signature over other data was verified")
+	}
+}
+
+func TestParseCOSEKeyFailsUnsupportedAlgorithm(t *testing.T) {
+	// ES384 on P-384
+	encoded, _ := cbor.Marshal(map[int]interface{}{1: 2, 3: -35, -1: 2, -2: make([]byte, 48), -3: make([]byte, 48)})
+
+	if _, err := models.ParseCOSEKey(encoded); err == nil {
+		t.Fatalf("COSE key of an unsupported algorithm was parsed")
+	}
+}
+
+func TestVerifyClientDataFailsOtherOrigin(t *testing.T) {
+	rp := models.RelyingParty{ID: "auth.example.com", Origins: []string{"https://auth.example.com"}}
+
+	clientData := models.ClientData{Type: "webauthn.get", Challenge: "challenge", Origin: "https://auth.example.com"}
+	if err := rp.VerifyClientData(clientData, "webauthn.get"); err != nil {
+		t.Fatalf("failed to verify client data: %q", err)
+	}
+	if err := rp.VerifyClientData(clientData, "webauthn.create"); err == nil {
+		t.Fatalf("client data of another ceremony was verified")
+	}
+
+	clientData.Origin = "http://auth.example.com"
+	if err := rp.VerifyClientData(clientData, "webauthn.get"); err == nil {
+		t.Fatalf("client data of another origin was verified")
+	}
+}
@@ -0,0 +1,39 @@
+package repositories
+
+import (
+	"jwt-auth-service/repositories"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenDenylistRevokeToken(t *testing.T) {
+	denylist := repositories.NewMemoryTokenDenylist()
+
+	if err := denylist.RevokeToken("jti0", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to revoke token: %q", err)
+	}
+
+	revoked, err := denylist.IsTokenRevoked("jti0")
+	if err != nil {
+		t.Fatalf("failed to check revoked token: %q", err)
+	}
+	if !revoked {
+		t.Fatalf("revoked token was not reported as revoked")
+	}
+
+	revoked, _ = denylist.IsTokenRevoked("jti1")
+	if revoked {
+		t.Fatalf("token that was never revoked was reported as revoked")
+	}
+}
+
+func TestMemoryTokenDenylistForgetsExpiredTokens(t *testing.T) {
+	denylist := repositories.NewMemoryTokenDenylist()
+
+	_ = denylist.RevokeToken("jti0", time.Now().Add(-time.Second))
+
+	revoked, _ := denylist.IsTokenRevoked("jti0")
+	if revoked {
+		t.Fatalf("token was still reported as revoked after it expired")
+	}
+}
@@ -132,7 +132,7 @@ func TestAddUser(t *testing.T) {
 	}
 
 	if !cmp.Equal(addedUser, expectedUser) {
-		t.Fatalf("added user had unexpected values: \n\tactual: %q\n\texpected: %q", addedUser, expectedUser)
+		t.Fatalf("added user had unexpected values: \n\tactual: %v\n\texpected: %v", addedUser, expectedUser)
 	}
 }
 
@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"jwt-auth-service/middleware"
+	"jwt-auth-service/models"
+	"jwt-auth-service/repositories"
+	"jwt-auth-service/routes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter returns the service's routes without a database, which
+// requests refused before any lookup never reach.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Setenv("JWT_AUTH_SERVICE_SECRET_KEY", "secret")
+	models.SetSigningKey(nil)
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middleware.EnvMiddleware(models.Env{Denylist: repositories.NewMemoryTokenDenylist()}))
+
+	pubv1 := router.Group("/v1")
+	routes.AddAuthRoutes(pubv1)
+	routes.AddSessionRoutes(pubv1)
+	routes.AddConsentRoutes(pubv1)
+	routes.AddAccountRoutes(pubv1)
+	routes.AddAdminRoutes(pubv1)
+	routes.AddOAuthRoutes(pubv1)
+
+	return router
+}
+
+func TestClientTokensAreRefusedByFirstPartyRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	// even a first party client acting for an admin who signed in with MFA
+	user := models.User{ID: 1, PublicID: "user-public-id", UserRoles: []models.Roles{models.UserRole, models.AdminRole}}
+	session := models.Session{ID: "session", ClientID: "web-app", AuthMethods: []string{models.AuthMethodPassword, models.AuthMethodMFA}}
+	clientToken, err := models.MintToken(models.NewAccessTokenClaims(user, session, time.Now().Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("failed to mint access token: %q", err)
+	}
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/auth/sessions"},
+		{http.MethodDelete, "/v1/auth/sessions/session"},
+		{http.MethodPost, "/v1/auth/logout-all"},
+		{http.MethodGet, "/v1/auth/consents"},
+		{http.MethodDelete, "/v1/auth/consents/web-app"},
+		{http.MethodGet, "/v1/account/mfa"},
+		{http.MethodPost, "/v1/account/password"},
+		{http.MethodGet, "/v1/admin/clients"},
+	} {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer "+clientToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("unexpected status for a client's token at %s %s\n\texpected: %d\n\tactual: %d", route.method, route.path, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func TestLogoutRefusesTokensOtherThanAccessTokens(t *testing.T) {
+	router := newTestRouter(t)
+
+	// a client holding the user's ID token must not sign them out of their browser session
+	user := models.User{ID: 1, PublicID: "user-public-id"}
+	idToken, err := models.MintIDToken(models.NewIDTokenClaims(models.NewUserInfo(user.PublicID, user, "openid"), "client1", "", time.Now(), "browser-session"))
+	if err != nil {
+		t.Fatalf("failed to mint ID token: %q", err)
+	}
+	logoutToken, err := models.MintLogoutToken(models.NewLogoutTokenClaims("client1", user.PublicID, models.Session{ParentSessionID: "browser-session"}))
+	if err != nil {
+		t.Fatalf("failed to mint logout token: %q", err)
+	}
+
+	// the router has no database, so ending a session would not get this far
+	for _, token := range []string{idToken, logoutToken} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth/logout", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("unexpected status for logging out with a token that is not an access token\n\texpected: %d\n\tactual: %d", http.StatusUnauthorized, w.Code)
+		}
+	}
+}
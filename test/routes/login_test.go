@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var csrfTokenPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestLoginFormIsBoundToBrowser(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/oauth/device", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status for the login form\n\texpected: %d\n\tactual: %d", http.StatusOK, w.Code)
+	}
+
+	var loginNonce *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "loginnonce" {
+			loginNonce = cookie
+		}
+	}
+	if loginNonce == nil || !loginNonce.HttpOnly {
+		t.Fatalf("login form did not set an HttpOnly loginnonce cookie")
+	}
+	match := csrfTokenPattern.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("login form has no CSRF token")
+	}
+
+	for _, attempt := range []struct {
+		name      string
+		csrfToken string
+		cookie    *http.Cookie
+	}{
+		{"without a CSRF token", "", loginNonce},
+		{"without the loginnonce cookie", match[1], nil},
+		{"with another browser's CSRF token", match[1], &http.Cookie{Name: "loginnonce", Value: "another-browser"}},
+	} {
+		form := url.Values{"email": {"user@example.com"}, "password": {"password"}, "csrf_token": {attempt.csrfToken}}
+		req := httptest.NewRequest(http.MethodPost, "/v1/oauth/device", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if attempt.cookie != nil {
+			req.AddCookie(attempt.cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("unexpected status for a login %s\n\texpected: %d\n\tactual: %d", attempt.name, http.StatusForbidden, w.Code)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistrationRefusesInternalBackchannelLogoutURIs(t *testing.T) {
+	t.Setenv("JWT_AUTH_SERVICE_INITIAL_ACCESS_TOKEN", "initial-token")
+	router := newTestRouter(t)
+
+	for _, logoutURI := range []string{
+		"http://app.example.com/logout",
+		"https://other.example.com/logout",
+		"https://localhost/logout",
+		"https://127.0.0.1/logout",
+		"https://10.0.0.1/logout",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/logout",
+	} {
+		body := `{"client_name": "App", "redirect_uris": ["https://app.example.com/callback", "https://localhost/callback", "https://127.0.0.1/callback", ` +
+			`"https://10.0.0.1/callback", "https://169.254.169.254/callback", "https://[::1]/callback"], "backchannel_logout_uri": "` + logoutURI + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/oauth/register", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer initial-token")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_client_metadata") {
+			t.Fatalf("unexpected response registering backchannel logout URI %s\n\texpected: %d invalid_client_metadata\n\tactual: %d %s", logoutURI, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	}
+}
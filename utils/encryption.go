@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// EncryptSecret encrypts a secret the service has to be able to read back,
+// such as a TOTP secret, before it is stored. It uses AES-256-GCM with a key
+// derived from JWT_AUTH_SERVICE_ENCRYPTION_KEY, or from
+// JWT_AUTH_SERVICE_SECRET_KEY when that is not set, so a database dump alone
+// does not reveal the secrets.
+func EncryptSecret(plaintext []byte) (string, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// DecryptSecret reverses EncryptSecret.
+func DecryptSecret(ciphertext string) ([]byte, error) {
+	aead, err := secretCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted secret is too short")
+	}
+
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+// KeyedHash returns the hex encoded HMAC-SHA256 of a value, for values others
+// must not be able to compute or check guesses against without the key, such
+// as CSRF tokens. The key is derived for the purpose from the same key as
+// EncryptSecret uses, so hashes for different purposes are unrelated.
+func KeyedHash(purpose string, value string) (string, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	derivedKey := sha256.Sum256([]byte("jwt-auth-service keyed hash\x00" + purpose + "\x00" + key))
+	mac := hmac.New(sha256.New, derivedKey[:])
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func secretCipher() (cipher.AEAD, error) {
+	key, err := encryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey := sha256.Sum256([]byte("jwt-auth-service secret encryption\x00" + key))
+	block, err := aes.NewCipher(derivedKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptionKey() (string, error) {
+	key := os.Getenv("JWT_AUTH_SERVICE_ENCRYPTION_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_AUTH_SERVICE_SECRET_KEY")
+	}
+	if key == "" {
+		return "", fmt.Errorf("no key configured for encrypting secrets")
+	}
+
+	return key, nil
+}
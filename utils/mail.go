@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a plain text message to a single recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SMTPMailer sends emails through an SMTP server, authenticating with
+// Username and Password when they are set. The connection is upgraded with
+// STARTTLS when the server supports it.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (mailer SMTPMailer) SendMail(email Email) error {
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		host, _, err := net.SplitHostPort(mailer.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, host)
+	}
+
+	return smtp.SendMail(mailer.Addr, auth, mailer.From, []string{email.To}, formatMessage(mailer.From, email))
+}
+
+// FileMailer writes each email to a file in Dir instead of sending it, for
+// development and for deployments where another process delivers the mail.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (mailer FileMailer) SendMail(email Email) error {
+	if err := os.MkdirAll(mailer.Dir, 0o700); err != nil {
+		return err
+	}
+
+	name, err := GenerateRandomString(8)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(mailer.Dir, fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), name))
+
+	return os.WriteFile(path, formatMessage(mailer.From, email), 0o600)
+}
+
+// MemoryMailer keeps the emails it is asked to send, so tests can check
+// what would have been sent.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Email
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (mailer *MemoryMailer) SendMail(email Email) error {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	mailer.sent = append(mailer.sent, email)
+	return nil
+}
+
+// Sent returns the emails sent so far, oldest first.
+func (mailer *MemoryMailer) Sent() []Email {
+	mailer.mu.Lock()
+	defer mailer.mu.Unlock()
+
+	return append([]Email(nil), mailer.sent...)
+}
+
+// formatMessage returns the email as an RFC 5322 message. Line breaks are
+// removed from header values so they cannot add headers of their own.
+func formatMessage(from string, email Email) []byte {
+	headerValue := strings.NewReplacer("\r", "", "\n", "").Replace
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&msg, "To: %s\r\n", headerValue(email.To))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", headerValue(email.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(email.Body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return msg.Bytes()
+}
@@ -2,40 +2,124 @@ package utils
 
 import (
 	"fmt"
-	"log"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GetAuthCookiesFromContext(c *gin.Context) (string, string, error) {
-	/* Get auth token */
+func GetBearerTokenFromContext(c *gin.Context) (string, error) {
+	authHeader := c.Request.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", fmt.Errorf("missing authorization header")
+	}
+
+	authToken := strings.TrimPrefix(authHeader, "Bearer ")
+	if authToken == authHeader {
+		return "", fmt.Errorf("malformed authorization header")
+	}
+
+	return authToken, nil
+}
+
+func GetRefreshTokenCookieFromContext(c *gin.Context) (string, error) {
+	refreshTokenCookie, err := c.Request.Cookie("refreshtoken")
+	if err != nil {
+		return "", err
+	}
+
+	return refreshTokenCookie.Value, nil
+}
+
+func SetRefreshTokenCookie(c *gin.Context, refreshToken string, expires time.Time) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("refreshtoken", refreshToken, int(time.Until(expires).Seconds()), "/v1/auth", "", true, true)
+}
+
+func ClearRefreshTokenCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("refreshtoken", "", -1, "/v1/auth", "", true, true)
+}
+
+// GetClientCredentialsFromContext returns the OAuth client credentials sent
+// with HTTP Basic authentication, or failing that in the form body, as allowed
+// by RFC 6749 section 2.3.1.
+func GetClientCredentialsFromContext(c *gin.Context) (string, string, bool) {
+	if clientID, clientSecret, ok := c.Request.BasicAuth(); ok {
+		// Basic credentials are form-urlencoded before being base64 encoded
+		decodedID, err := url.QueryUnescape(clientID)
+		if err != nil {
+			return "", "", false
+		}
+		decodedSecret, err := url.QueryUnescape(clientSecret)
+		if err != nil {
+			return "", "", false
+		}
+
+		return decodedID, decodedSecret, true
+	}
+
+	clientID := c.PostForm("client_id")
+	if clientID == "" {
+		return "", "", false
+	}
+
+	return clientID, c.PostForm("client_secret"), true
+}
+
+// SetAuthTokenCookie keeps the browser signed in to the authorization pages.
+// SameSite=Lax lets the cookie through on the top level redirects that bring
+// the user here from a client application.
+func SetAuthTokenCookie(c *gin.Context, authToken string, expires time.Time) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("authtoken", authToken, int(time.Until(expires).Seconds()), "/", "", true, true)
+}
+
+func ClearAuthTokenCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("authtoken", "", -1, "/", "", true, true)
+}
+
+func GetAuthTokenCookieFromContext(c *gin.Context) (string, error) {
 	authTokenCookie, err := c.Request.Cookie("authtoken")
 	if err != nil {
-		log.Println(err.Error())
-		return "", "", err
+		return "", err
 	}
 
-	/* Get session token */
-	refreshTokenCookie, err := c.Request.Cookie("refreshtoken")
+	return authTokenCookie.Value, nil
+}
+
+// SetLoginNonceCookie binds the login form to the browser that loaded it,
+// since there is no session to bind it to before the user signs in.
+func SetLoginNonceCookie(c *gin.Context, nonce string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie("loginnonce", nonce, 0, "/", "", true, true)
+}
+
+func GetLoginNonceCookieFromContext(c *gin.Context) (string, error) {
+	loginNonceCookie, err := c.Request.Cookie("loginnonce")
 	if err != nil {
-		log.Println(err.Error())
-		return "", "", err
+		return "", err
 	}
 
-	return authTokenCookie.Value, refreshTokenCookie.Value, nil
+	return loginNonceCookie.Value, nil
 }
 
-func GetBearerTokenFromContext(c *gin.Context) (string, error) {
-	authHeader := c.Request.Header.Get("Authorization")
-	if authHeader == "" {
-		return "", fmt.Errorf("missing authorization header")
+// GetBaseURL returns the URL the service is reached at, for links that must
+// be absolute. JWT_AUTH_SERVICE_BASE_URL should be set when running behind a
+// proxy, otherwise the URL is guessed from the request.
+func GetBaseURL(c *gin.Context) string {
+	if baseURL := os.Getenv("JWT_AUTH_SERVICE_BASE_URL"); baseURL != "" {
+		return strings.TrimSuffix(baseURL, "/")
 	}
 
-	authToken := strings.TrimPrefix(authHeader, "Bearer ")
-	if authToken == authHeader {
-		return "", fmt.Errorf("malformed authorization header")
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
 	}
 
-	return authToken, nil
+	return scheme + "://" + c.Request.Host
 }
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateRandomString returns n cryptographically random bytes encoded as
+// unpadded base64url, suitable for identifiers and opaque tokens.
+func GenerateRandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of an opaque token. Only the
+// hash is persisted so a database dump does not contain usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// userCodeCharset has no vowels, so user codes cannot spell words, and no
+// characters that are easily confused with each other.
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// GenerateUserCode returns a random code of n characters that is easy for
+// people to read and type, as recommended by RFC 8628 section 6.1.
+func GenerateUserCode(n int) (string, error) {
+	// bytes at or above the largest multiple of the charset length are
+	// skipped so that every character is equally likely
+	limit := 256 - 256%len(userCodeCharset)
+
+	code := make([]byte, 0, n)
+	b := make([]byte, 1)
+	for len(code) < n {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		if int(b[0]) < limit {
+			code = append(code, userCodeCharset[int(b[0])%len(userCodeCharset)])
+		}
+	}
+
+	return string(code), nil
+}